@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net"
 	"time"
 
+	"mqttbench/internal/ack"
+	"mqttbench/internal/broker"
+	"mqttbench/internal/chaos"
+	"mqttbench/internal/credentials"
 	"mqttbench/internal/db"
+	"mqttbench/internal/diagnostics"
 	"mqttbench/internal/master"
 	"mqttbench/internal/message"
+	"mqttbench/internal/metrics"
 	"mqttbench/internal/models"
+	"mqttbench/internal/payload"
 	"mqttbench/internal/performance"
+	"mqttbench/internal/ramp"
+	"mqttbench/internal/testplan"
+	"mqttbench/internal/topic"
+	"mqttbench/internal/workload"
 
 	"gorm.io/gorm"
 )
@@ -23,6 +32,7 @@ type App struct {
 	masterServer       *master.Server
 	performanceService *performance.Service
 	messageService     *message.Service
+	testPlanService    *testplan.Service
 	db                 *gorm.DB
 }
 
@@ -39,10 +49,13 @@ func NewApp() *App {
 	app.masterServer = master.NewServer()
 
 	// 创建性能测试服务实例
-	app.performanceService = performance.NewService()
+	app.performanceService = performance.NewService(app.masterServer)
 
 	// 创建消息测试服务实例
-	app.messageService = message.NewService()
+	app.messageService = message.NewService(app.masterServer)
+
+	// 创建测试计划服务实例
+	app.testPlanService = testplan.NewService(app.masterServer)
 
 	return app
 }
@@ -53,7 +66,9 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
 	// 启动master服务器
-	a.masterServer.Start(ctx)
+	if err := a.masterServer.Start(ctx); err != nil {
+		log.Printf("启动master服务器失败: %v", err)
+	}
 }
 
 // GetSlaves 获取所有Slave
@@ -222,204 +237,374 @@ func (a *App) UpdateSlave(id int64, name string, mqttHost string, mqttPort int,
 	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(slave)
 }
 
+// UpdateSlavePublishConfig 更新Slave的发布模式配置
+func (a *App) UpdateSlavePublishConfig(id int64, mode string, pubTopic string, pubRate float64, payloadSize int, pubQoS int) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	// 校验模式
+	switch mode {
+	case "":
+		mode = existingSlave.Mode
+	case workload.ModeSubscribe, workload.ModePublish, workload.ModeBoth:
+	default:
+		return fmt.Errorf("invalid mode: %s", mode)
+	}
+
+	// 发布主题为空时使用Topic，因此允许清空
+	existingSlave.Mode = mode
+	existingSlave.PubTopic = pubTopic
+
+	// 对于数值字段，如果传入的是-1，则保持原有值
+	if pubRate != -1 {
+		existingSlave.PubRate = pubRate
+	}
+
+	if payloadSize != -1 {
+		existingSlave.PayloadSize = payloadSize
+	}
+
+	if pubQoS != -1 {
+		existingSlave.PubQoS = pubQoS
+	}
+
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
+
 // DeleteSlave 删除Slave
 func (a *App) DeleteSlave(id int64) error {
 	return a.masterServer.GetSlaveModel().Delete(id)
 }
 
-// DeployConfig 下发配置到指定的Slave
-func (a *App) DeployConfig(slaveIDs []int64) error {
+// DeployConfig 下发配置到指定的Slave，返回每个Slave的确认结果
+func (a *App) DeployConfig(slaveIDs []int64) []master.CommandResult {
 	return a.masterServer.DeployConfigToSlaves(slaveIDs)
 }
 
-// StartSlave 启动指定的Slave
-func (a *App) StartSlave(slaveID int64) error {
-	// 首先获取slave信息
-	slave, err := a.masterServer.GetSlaveModel().GetByID(slaveID)
+// DeployFleet 将totalClients个客户端按选中的在线Slave拆分ClientID区间并下发配置，
+// weighted为true时按Slave的Capacity加权拆分，否则平均拆分
+func (a *App) DeployFleet(slaveIDs []int64, totalClients int, clientIDPrefix string, weighted bool) ([]*models.Slave, error) {
+	return a.masterServer.DeployPartitioned(slaveIDs, totalClients, clientIDPrefix, weighted)
+}
+
+// SetSlaveCapacity 设置Slave的容量权重，用于按容量拆分客户端
+func (a *App) SetSlaveCapacity(id int64, capacity int) error {
+	if capacity < 0 {
+		return fmt.Errorf("invalid capacity: %d", capacity)
+	}
+
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
 		return err
 	}
 
-	if slave == nil {
-		return fmt.Errorf("slave %d not found", slaveID)
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	existingSlave.Capacity = capacity
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
+
+// UpdateSlaveRampConfig 更新Slave的建连策略
+func (a *App) UpdateSlaveRampConfig(id int64, strategy string, rate float64, duration int, batchSize int, batchPause int) error {
+	ramp := &ramp.Config{
+		Strategy:   strategy,
+		Rate:       rate,
+		Duration:   duration,
+		BatchSize:  batchSize,
+		BatchPause: batchPause,
+	}
+	if err := ramp.Validate(); err != nil {
+		return err
 	}
 
-	// 构造带有启动命令的配置数据
-	configData := master.ConfigData{
-		MqttHost: slave.MqttHost,
-		MqttPort: slave.MqttPort,
-		Topic:    slave.Topic,
-		QoS:      slave.QoS,
-		ClientID: slave.ClientID,
-		Start:    slave.Start,
-		Step:     slave.Step,
-		Command:  "start",        // 添加启动命令
-		AckTopic: slave.AckTopic, // 添加ACK主题
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
+	if err != nil {
+		return err
 	}
 
-	// 构造消息结构
-	message := struct {
-		Type    string            `json:"type"`
-		Content master.ConfigData `json:"content"`
-	}{
-		Type:    "config",
-		Content: configData,
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
 	}
 
-	// 将消息序列化为JSON
-	data, err := json.Marshal(message)
+	existingSlave.RampStrategy = strategy
+	existingSlave.RampRate = rate
+	existingSlave.RampDuration = duration
+	existingSlave.RampBatchSize = batchSize
+	existingSlave.RampBatchPause = batchPause
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
+
+// UpdateSlaveProtocolConfig 更新Slave的MQTT协议版本和MQTT 5.0连接参数
+func (a *App) UpdateSlaveProtocolConfig(id int64, protocolVersion int, sessionExpiry int64, receiveMaximum int, topicAliasMaximum int, topicAlias bool, userProperties map[string]string) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config data: %v", err)
+		return err
 	}
 
-	// 添加调试日志
-	log.Printf("Sending config data to slave %d: %s", slaveID, string(data))
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
+	}
 
-	// 构造slave的配置URL
-	configURL := net.JoinHostPort(slave.SlaveHost, fmt.Sprintf("%d", slave.SlavePort))
+	existingSlave.ProtocolVersion = protocolVersion
+	existingSlave.SessionExpiry = sessionExpiry
+	existingSlave.ReceiveMaximum = receiveMaximum
+	existingSlave.TopicAliasMaximum = topicAliasMaximum
+	existingSlave.TopicAlias = topicAlias
+	existingSlave.UserProperties = userProperties
+	if err := master.ValidateProtocolConfig(existingSlave); err != nil {
+		return err
+	}
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
 
-	// 创建TCP连接
-	conn, err := net.DialTimeout("tcp", configURL, 10*time.Second)
+// UpdateSlaveTLSConfig 更新Slave连接broker的TLS配置，证书和私钥为PEM文本。
+// 私钥不会返回给界面，clientKey为空且仍设置了客户端证书时保留已保存的私钥
+func (a *App) UpdateSlaveTLSConfig(id int64, enabled bool, caCert string, clientCert string, clientKey string, serverName string, minVersion string, insecureSkipVerify bool) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
-		// 更新slave状态为离线
-		slave.Status = "offline"
-		updateErr := a.masterServer.GetSlaveModel().UpdateWithoutConnections(slave)
-		if updateErr != nil {
-			log.Printf("Failed to update slave status to offline: %v", updateErr)
-		}
-		return fmt.Errorf("failed to connect to slave %d at %s: %v", slaveID, configURL, err)
+		return err
+	}
+
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	existingSlave.TLSEnabled = enabled
+	existingSlave.TLSCACert = caCert
+	existingSlave.TLSClientCert = clientCert
+	if clientKey != "" || clientCert == "" {
+		existingSlave.TLSClientKey = clientKey
+	}
+	existingSlave.TLSServerName = serverName
+	existingSlave.TLSMinVersion = minVersion
+	existingSlave.TLSInsecureSkipVerify = insecureSkipVerify
+	if err := master.NewTLSConfig(existingSlave).Validate(); err != nil {
+		return err
 	}
-	defer conn.Close()
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
 
-	// 发送JSON数据并在末尾添加换行符
-	_, err = conn.Write(append(data, '\n'))
+// UpdateSlaveTransportConfig 更新Slave连接broker的传输方式和WebSocket参数
+func (a *App) UpdateSlaveTransportConfig(id int64, transport string, wsPath string, wsHeaders map[string]string) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
-		// 更新slave状态为离线
-		slave.Status = "offline"
-		updateErr := a.masterServer.GetSlaveModel().UpdateWithoutConnections(slave)
-		if updateErr != nil {
-			log.Printf("Failed to update slave status to offline: %v", updateErr)
-		}
-		return fmt.Errorf("failed to send config to slave %d: %v", slaveID, err)
+		return err
 	}
 
-	// 确保数据被刷新到网络
-	if tcpConn, ok := conn.(*net.TCPConn); ok {
-		tcpConn.CloseWrite()
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
 	}
 
-	// 等待更长时间确保数据被接收和处理
-	time.Sleep(500 * time.Millisecond)
+	existingSlave.Transport = transport
+	existingSlave.WSPath = wsPath
+	existingSlave.WSHeaders = wsHeaders
+	if err := master.ValidateTransport(existingSlave); err != nil {
+		return err
+	}
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
 
-	// 更新slave状态为运行中
-	slave.Status = "running"
-	updateErr := a.masterServer.GetSlaveModel().UpdateWithoutConnections(slave)
-	if updateErr != nil {
-		log.Printf("Failed to update slave status to running: %v", updateErr)
+// UpdateSlaveCredentialConfig 更新Slave连接broker的认证方式，凭据文件内容随配置下发。
+// 密码和签名密钥不会返回给界面，认证方式不变且传入为空时保留已保存的值
+func (a *App) UpdateSlaveCredentialConfig(id int64, config *credentials.Config) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
 	}
 
-	log.Printf("Start command deployed successfully to slave %d at %s", slaveID, configURL)
-	return nil
+	if config.Mode == existingSlave.CredentialMode {
+		if config.Password == "" {
+			config.Password = existingSlave.CredentialPassword
+		}
+		if config.TokenSecret == "" {
+			config.TokenSecret = existingSlave.TokenSecret
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	existingSlave.CredentialMode = config.Mode
+	existingSlave.CredentialUsername = config.Username
+	existingSlave.CredentialPassword = config.Password
+	existingSlave.CredentialFile = config.File
+	existingSlave.CredentialFileFormat = config.FileFormat
+	existingSlave.TokenSecret = config.TokenSecret
+	existingSlave.TokenAlgorithm = config.TokenAlgorithm
+	existingSlave.TokenTTL = config.TokenTTL
+	existingSlave.TokenIssuer = config.TokenIssuer
+	existingSlave.TokenAudience = config.TokenAudience
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
 }
 
-// StopSlave 停止指定的Slave
-func (a *App) StopSlave(slaveID int64) error {
-	log.Printf("StopSlave方法被调用，slaveID: %d", slaveID)
-	// 首先获取slave信息
-	slave, err := a.masterServer.GetSlaveModel().GetByID(slaveID)
+// UpdateSlavePayloadConfig 更新Slave发布消息的生成方式，样本文件内容随配置下发
+func (a *App) UpdateSlavePayloadConfig(id int64, config payload.Config) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
-		log.Printf("获取slave信息失败: %v", err)
 		return err
 	}
 
-	if slave == nil {
-		log.Printf("未找到slave %d", slaveID)
-		return fmt.Errorf("slave %d not found", slaveID)
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
 	}
 
-	log.Printf("获取到slave信息: ID=%d, Name=%s, SlaveHost=%s, SlavePort=%d", slave.ID, slave.Name, slave.SlaveHost, slave.SlavePort)
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	existingSlave.PayloadType = config.Type
+	existingSlave.PayloadContent = config.Content
+	existingSlave.PayloadTemplate = config.Template
+	existingSlave.PayloadSamples = config.Samples
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
 
-	// 构造带有停止命令的配置数据
-	configData := master.ConfigData{
-		Command: "stop", // 添加停止命令
+// UpdateSlaveAckConfig 更新Slave回复ACK的主题模板和方式
+func (a *App) UpdateSlaveAckConfig(id int64, ackTopic string, config *ack.Config) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
+	if err != nil {
+		return err
 	}
 
-	// 构造消息结构
-	message := struct {
-		Type    string            `json:"type"`
-		Content master.ConfigData `json:"content"`
-	}{
-		Type:    "config",
-		Content: configData,
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	existingSlave.AckTopic = ackTopic
+	existingSlave.AckMode = config.Mode
+	existingSlave.AckFields = config.Fields
+	existingSlave.AckQoS = config.QoS
+	existingSlave.AckDelay = config.Delay
+	if err := master.ValidateAck(existingSlave); err != nil {
+		return err
 	}
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
 
-	// 将消息序列化为JSON
-	data, err := json.Marshal(message)
+// UpdateSlaveTopicConfig 更新Slave每个客户端的订阅列表和{{group}}的分组大小
+func (a *App) UpdateSlaveTopicConfig(id int64, subscriptions []models.Subscription, groupSize int) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
-		log.Printf("序列化配置数据失败: %v", err)
-		return fmt.Errorf("failed to marshal config data: %v", err)
+		return err
 	}
 
-	// 添加调试日志
-	log.Printf("发送停止命令到slave %d: %s", slaveID, string(data))
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
+	}
 
-	// 构造slave的配置URL
-	configURL := net.JoinHostPort(slave.SlaveHost, fmt.Sprintf("%d", slave.SlavePort))
-	log.Printf("构造的配置URL: %s", configURL)
+	existingSlave.Subscriptions = subscriptions
+	existingSlave.TopicGroupSize = groupSize
+	if err := master.ValidateTopics(existingSlave); err != nil {
+		return err
+	}
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
 
-	// 创建TCP连接
-	log.Printf("尝试连接到slave %d at %s", slaveID, configURL)
-	conn, err := net.DialTimeout("tcp", configURL, 10*time.Second)
+// UpdateSlaveWillConfig 更新Slave客户端的遗嘱消息，主题为空时不设置遗嘱消息
+func (a *App) UpdateSlaveWillConfig(id int64, will topic.WillConfig) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
-		log.Printf("连接到slave失败: %v", err)
-		// 更新slave状态为离线
-		slave.Status = "offline"
-		slave.Connections = 0 // 将连接数归零
-		updateErr := a.masterServer.GetSlaveModel().UpdateWithoutConnections(slave)
-		if updateErr != nil {
-			log.Printf("更新slave状态为离线失败: %v", updateErr)
-		}
-		return fmt.Errorf("failed to connect to slave %d at %s: %v", slaveID, configURL, err)
+		return err
+	}
+
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
 	}
-	defer conn.Close()
-	log.Printf("成功连接到slave %d", slaveID)
 
-	// 发送JSON数据并在末尾添加换行符
-	log.Printf("发送数据到slave: %s", string(data))
-	_, err = conn.Write(append(data, '\n'))
+	existingSlave.WillTopic = will.Topic
+	existingSlave.WillPayload = will.Payload
+	existingSlave.WillQoS = will.QoS
+	existingSlave.WillRetain = will.Retain
+	if err := master.ValidateTopics(existingSlave); err != nil {
+		return err
+	}
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
+
+// UpdateSlaveBrokerConfig 更新Slave连接的broker集群节点和客户端分配方式，节点列表为空时连接MqttHost:MqttPort
+func (a *App) UpdateSlaveBrokerConfig(id int64, brokers []models.BrokerNode, policy string) error {
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
 	if err != nil {
-		log.Printf("发送配置到slave失败: %v", err)
-		// 更新slave状态为离线
-		slave.Status = "offline"
-		slave.Connections = 0 // 将连接数归零
-		updateErr := a.masterServer.GetSlaveModel().UpdateWithoutConnections(slave)
-		if updateErr != nil {
-			log.Printf("更新slave状态为离线失败: %v", updateErr)
-		}
-		return fmt.Errorf("failed to send config to slave %d: %v", slaveID, err)
+		return err
 	}
-	log.Printf("成功发送数据到slave %d", slaveID)
 
-	// 确保数据被刷新到网络
-	if tcpConn, ok := conn.(*net.TCPConn); ok {
-		log.Printf("关闭TCP写入端")
-		tcpConn.CloseWrite()
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
 	}
 
-	// 等待更长时间确保数据被接收和处理
-	log.Printf("等待500ms确保数据被接收和处理")
-	time.Sleep(500 * time.Millisecond)
+	existingSlave.Brokers = brokers
+	existingSlave.BrokerPolicy = policy
+	if err := master.ValidateBrokers(existingSlave); err != nil {
+		return err
+	}
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
 
-	// 更新slave状态为离线
-	slave.Status = "offline"
-	slave.Connections = 0 // 将连接数归零
-	updateErr := a.masterServer.GetSlaveModel().UpdateWithoutConnections(slave)
-	if updateErr != nil {
-		log.Printf("更新slave状态为离线失败: %v", updateErr)
+// UpdateSlaveSourceConfig 更新Slave客户端绑定的本地源地址，每项为IP或CIDR，为空时由系统选择源地址
+func (a *App) UpdateSlaveSourceConfig(id int64, sourceIPs []string) error {
+	if err := broker.ValidateSourceIPs(sourceIPs); err != nil {
+		return err
 	}
 
-	log.Printf("停止命令成功部署到slave %d at %s", slaveID, configURL)
-	return nil
+	existingSlave, err := a.masterServer.GetSlaveModel().GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if existingSlave == nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	existingSlave.SourceIPs = sourceIPs
+	return a.masterServer.GetSlaveModel().UpdateWithoutConnections(existingSlave)
+}
+
+// GetRampProgress 获取Slave最近一次上报的建连进度
+func (a *App) GetRampProgress(slaveID int64) *master.RampProgress {
+	return a.masterServer.GetRampProgress(slaveID)
+}
+
+// QuerySlaveClients 查询Slave上各客户端的连接记录，按状态、错误类别、客户端ID和broker节点过滤
+func (a *App) QuerySlaveClients(slaveID int64, query diagnostics.Query) (*diagnostics.QueryResult, error) {
+	return a.masterServer.QueryClients(slaveID, query)
+}
+
+// RunSlaveChaos 对Slave当前已连接的客户端执行故障注入，返回动作ID
+func (a *App) RunSlaveChaos(slaveID int64, action chaos.Action) (int64, error) {
+	return a.masterServer.RunChaos(slaveID, action)
+}
+
+// GetChaosReports 获取Slave最近的故障注入进度和重连耗时
+func (a *App) GetChaosReports(slaveID int64) []master.ChaosReport {
+	return a.masterServer.GetChaosReports(slaveID)
+}
+
+// StartSlave 启动指定的Slave
+func (a *App) StartSlave(slaveID int64) error {
+	return a.masterServer.StartSlave(slaveID)
+}
+
+// StopSlave 停止指定的Slave
+func (a *App) StopSlave(slaveID int64) error {
+	return a.masterServer.StopSlave(slaveID)
+}
+
+// GetMetricSamples 获取指定Slave最近windowSeconds秒内的指标采样，slaveID为0时返回所有Slave的采样
+func (a *App) GetMetricSamples(slaveID int64, windowSeconds int) ([]*models.MetricSample, error) {
+	if windowSeconds <= 0 {
+		return nil, fmt.Errorf("invalid window: %d", windowSeconds)
+	}
+	return a.masterServer.GetMetricSamples(slaveID, time.Duration(windowSeconds)*time.Second)
 }
 
 // GetConfigResult 获取指定Slave的配置结果
@@ -432,12 +617,92 @@ func (a *App) ClearConfigResult(slaveID int) {
 	a.masterServer.ClearConfigResult(slaveID)
 }
 
+// GetFleetLatency 获取所有Slave合并后的延迟统计
+func (a *App) GetFleetLatency() *metrics.LatencyStats {
+	return a.masterServer.GetFleetLatency()
+}
+
 // GetPerformanceTests 获取所有性能测试记录
 func (a *App) GetPerformanceTests() ([]*models.Performance, error) {
 	return a.performanceService.GetPerformanceTests()
 }
 
+// CreatePerformanceTest 创建性能测试，messageRate为所有客户端每秒发布的总消息数
+func (a *App) CreatePerformanceTest(testDuration int, messageRate int, messageSize int, qosLevel int, slaveIDs []int64) (*models.Performance, error) {
+	return a.performanceService.CreatePerformanceTest(testDuration, messageRate, messageSize, qosLevel, slaveIDs)
+}
+
+// StartPerformanceTest 启动性能测试
+func (a *App) StartPerformanceTest(id int64) error {
+	return a.performanceService.StartPerformanceTest(id)
+}
+
+// StopPerformanceTest 停止性能测试
+func (a *App) StopPerformanceTest(id int64) error {
+	return a.performanceService.StopPerformanceTest(id)
+}
+
+// DeletePerformanceTest 删除性能测试
+func (a *App) DeletePerformanceTest(id int64) error {
+	return a.performanceService.DeletePerformanceTest(id)
+}
+
 // GetMessageTests 获取所有消息测试记录
 func (a *App) GetMessageTests() ([]*models.Message, error) {
 	return a.messageService.GetMessageTests()
 }
+
+// CreateMessageTest 创建消息测试，messageType为json/text/binary
+func (a *App) CreateMessageTest(payloadSize int, messageType string, retained bool, duplicate bool, qosLevel int) (*models.Message, error) {
+	return a.messageService.CreateMessageTest(payloadSize, messageType, retained, duplicate, qosLevel)
+}
+
+// RunMessageTest 在指定的Slave上运行消息测试
+func (a *App) RunMessageTest(id int64, slaveIDs []int64) error {
+	return a.messageService.RunMessageTest(id, slaveIDs)
+}
+
+// GetMessageTestResults 获取消息测试的用例结果
+func (a *App) GetMessageTestResults(id int64) ([]*models.MessageTestResult, error) {
+	return a.messageService.GetMessageTestResults(id)
+}
+
+// DeleteMessageTest 删除消息测试
+func (a *App) DeleteMessageTest(id int64) error {
+	return a.messageService.DeleteMessageTest(id)
+}
+
+// GetTestPlans 获取所有测试计划
+func (a *App) GetTestPlans() ([]*models.TestPlan, error) {
+	return a.testPlanService.GetTestPlans()
+}
+
+// CreateTestPlan 创建测试计划，content为YAML或JSON格式的计划内容
+func (a *App) CreateTestPlan(content string) (*models.TestPlan, error) {
+	return a.testPlanService.CreateTestPlan(content)
+}
+
+// UpdateTestPlan 修改测试计划的内容
+func (a *App) UpdateTestPlan(id int64, content string) (*models.TestPlan, error) {
+	return a.testPlanService.UpdateTestPlan(id, content)
+}
+
+// StartTestPlan 在指定的Slave上按阶段运行测试计划
+func (a *App) StartTestPlan(id int64, slaveIDs []int64) error {
+	return a.testPlanService.StartTestPlan(id, slaveIDs)
+}
+
+// StopTestPlan 停止测试计划
+func (a *App) StopTestPlan(id int64) error {
+	return a.testPlanService.StopTestPlan(id)
+}
+
+// GetTestPlanPhases 获取测试计划最近一次运行的各阶段状态
+func (a *App) GetTestPlanPhases(id int64) ([]*models.TestPlanPhase, error) {
+	return a.testPlanService.GetTestPlanPhases(id)
+}
+
+// DeleteTestPlan 删除测试计划
+func (a *App) DeleteTestPlan(id int64) error {
+	return a.testPlanService.DeleteTestPlan(id)
+}
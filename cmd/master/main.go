@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"mqttbench/internal/db"
+	"mqttbench/internal/master"
+	"mqttbench/internal/models"
+	"mqttbench/internal/performance"
+)
+
+// Version information set at build time
+var (
+	Version   string
+	BuildTime string
+)
+
+// 退出码
+const (
+	exitPassed    = 0 // 测试完成且满足所有SLA
+	exitSLAFailed = 1 // 测试完成但未满足SLA，或测试未正常完成
+	exitError     = 2 // 计划无效、slave不足或运行出错
+)
+
+// slave在该时间内有心跳才视为可用
+const slaveAliveWindow = 30 * time.Second
+
+// Result 测试结果，写入-output指定的文件
+type Result struct {
+	Passed      bool                `json:"passed"`
+	Plan        *Plan               `json:"plan,omitempty"`
+	SlaveIDs    []int64             `json:"slave_ids"`
+	Performance *models.Performance `json:"performance,omitempty"`
+	Checks      []SLACheck          `json:"checks"`
+	Error       string              `json:"error,omitempty"`
+}
+
+func main() {
+	// 定义命令行参数
+	planFlag := flag.String("plan", "", "测试计划文件（YAML或JSON）")
+	slavesFlag := flag.Int("slaves", 1, "开始测试前需要等待的slave数量")
+	waitFlag := flag.Duration("wait", 5*time.Minute, "等待slave注册的最长时间")
+	outputFlag := flag.String("output", "result.json", "结果文件，-表示输出到标准输出")
+	listenFlag := flag.String("listen", ":8888", "slave注册和控制通道的监听地址")
+	versionFlag := flag.Bool("version", false, "显示版本信息")
+
+	flag.Parse()
+
+	// 检查是否请求版本信息
+	if *versionFlag {
+		fmt.Printf("Master Version: %s\n", Version)
+		fmt.Printf("Build Time: %s\n", BuildTime)
+		return
+	}
+
+	// 检查是否提供了必要参数
+	if *planFlag == "" || *slavesFlag <= 0 {
+		fmt.Println("用法: master -plan=计划文件 [-slaves=数量] [-wait=等待时间] [-output=结果文件] [-listen=监听地址]")
+		fmt.Println("示例: master -plan=plan.json -slaves=3 -output=result.json")
+		os.Exit(exitError)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	result := run(ctx, *planFlag, *slavesFlag, *waitFlag, *listenFlag)
+	if err := writeResult(*outputFlag, result); err != nil {
+		log.Printf("写入结果失败: %v", err)
+		os.Exit(exitError)
+	}
+
+	switch {
+	case result.Error != "":
+		log.Printf("测试失败: %s", result.Error)
+		os.Exit(exitError)
+	case !result.Passed:
+		log.Println("测试未满足SLA")
+		os.Exit(exitSLAFailed)
+	}
+	log.Println("测试通过")
+	os.Exit(exitPassed)
+}
+
+// run 等待slave注册，下发计划并运行测试，返回测试结果
+func run(ctx context.Context, planPath string, slaveCount int, wait time.Duration, listenAddr string) *Result {
+	result := &Result{}
+	fail := func(err error) *Result {
+		result.Error = err.Error()
+		return result
+	}
+
+	plan, err := loadPlan(planPath)
+	if err != nil {
+		return fail(err)
+	}
+	result.Plan = plan.redacted()
+
+	// 初始化数据库并启动master服务器，服务器在中断后继续运行，以便停止测试并收集结果
+	db.InitDB()
+	serverCtx, stopServer := context.WithCancel(context.Background())
+	defer stopServer()
+	server := master.NewServer()
+	server.SetListenAddr(listenAddr)
+	if err := server.Start(serverCtx); err != nil {
+		return fail(err)
+	}
+
+	slaves, err := waitForSlaves(ctx, server, slaveCount, wait)
+	if err != nil {
+		return fail(err)
+	}
+	for _, slave := range slaves {
+		result.SlaveIDs = append(result.SlaveIDs, slave.ID)
+	}
+	log.Printf("%d个slave已就绪: %v", len(slaves), result.SlaveIDs)
+
+	// 应用MQTT配置并拆分客户端
+	for _, slave := range slaves {
+		plan.apply(slave)
+		if err := server.GetSlaveModel().UpdateWithoutConnections(slave); err != nil {
+			return fail(fmt.Errorf("failed to save slave %d: %v", slave.ID, err))
+		}
+	}
+	if _, err := server.DeployPartitioned(result.SlaveIDs, plan.Clients.Total, plan.Clients.Prefix, plan.Clients.Weighted); err != nil {
+		return fail(fmt.Errorf("failed to deploy plan: %v", err))
+	}
+
+	// 创建并运行性能测试
+	performanceService := performance.NewService(server)
+	test, err := performanceService.CreatePerformanceTest(plan.Duration, plan.MessageRate, plan.MessageSize, plan.PubQoS, result.SlaveIDs)
+	if err != nil {
+		return fail(err)
+	}
+	if err := performanceService.StartPerformanceTest(test.ID); err != nil {
+		return fail(err)
+	}
+	log.Printf("性能测试 %d 已启动，时长 %d 秒", test.ID, plan.Duration)
+
+	waitForTest(ctx, performanceService, test.ID)
+
+	test, err = performanceService.GetPerformanceTest(test.ID)
+	if err != nil {
+		return fail(err)
+	}
+	result.Performance = test
+	result.Checks = plan.SLA.evaluate(test)
+
+	result.Passed = test.Status == models.PerformanceStatusCompleted
+	for _, check := range result.Checks {
+		log.Printf("SLA %s: 阈值 %v，实际 %v，通过 %v", check.Name, check.Threshold, check.Actual, check.Passed)
+		if !check.Passed {
+			result.Passed = false
+		}
+	}
+	return result
+}
+
+// waitForSlaves 等待至少count个slave在线，返回ID最小的count个
+func waitForSlaves(ctx context.Context, server *master.Server, count int, wait time.Duration) ([]*models.Slave, error) {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		slaves, err := server.GetAllSlaves()
+		if err != nil {
+			return nil, err
+		}
+
+		alive := make([]*models.Slave, 0, len(slaves))
+		for _, slave := range slaves {
+			if slave.Status != "offline" && time.Since(slave.UpdatedAt) < slaveAliveWindow {
+				alive = append(alive, slave)
+			}
+		}
+		if len(alive) >= count {
+			sort.Slice(alive, func(i, j int) bool { return alive[i].ID < alive[j].ID })
+			return alive[:count], nil
+		}
+		log.Printf("等待slave注册: %d/%d", len(alive), count)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, fmt.Errorf("only %d of %d slaves registered within %v", len(alive), count, wait)
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForTest 等待测试结束，收到中断信号时提前停止测试
+func waitForTest(ctx context.Context, service *performance.Service, id int64) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	done := ctx.Done()
+	for service.IsRunning(id) {
+		select {
+		case <-done:
+			log.Printf("收到中断信号，停止性能测试 %d", id)
+			if err := service.StopPerformanceTest(id); err != nil {
+				log.Printf("停止性能测试失败: %v", err)
+			}
+			// 只停止一次，之后等待测试收集结果
+			done = nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeResult 将结果以JSON格式写入文件，path为-时输出到标准输出
+func writeResult(path string, result *Result) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
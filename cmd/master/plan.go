@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"mqttbench/internal/credentials"
+	"mqttbench/internal/models"
+	"mqttbench/internal/testplan"
+	"mqttbench/internal/workload"
+)
+
+// Plan 无界面运行的测试计划，YAML和JSON格式使用相同的字段名
+type Plan struct {
+	// MQTT配置，应用到所有参与测试的slave
+	testplan.Config
+	Mode string `json:"mode"` // subscribe/publish/both，为空时为both
+
+	// 客户端拆分
+	Clients testplan.Clients `json:"clients"`
+
+	// 性能测试参数
+	Duration    int `json:"duration"`     // 测试时长（秒）
+	MessageRate int `json:"message_rate"` // 所有客户端每秒发布的消息总数
+	MessageSize int `json:"message_size"` // 消息大小（字节）
+	PubQoS      int `json:"pub_qos"`      // 发布消息的QoS
+
+	SLA SLA `json:"sla"`
+}
+
+// SLA 测试通过的阈值，未设置的阈值不检查
+type SLA struct {
+	MaxP99Ms           *float64 `json:"max_p99_ms,omitempty"`
+	MaxP999Ms          *float64 `json:"max_p999_ms,omitempty"`
+	MaxLatencyMs       *float64 `json:"max_latency_ms,omitempty"`
+	MinThroughput      *float64 `json:"min_throughput,omitempty"`       // 每秒发布的消息数
+	MaxPublishFailures *int64   `json:"max_publish_failures,omitempty"` // 发布失败的消息数
+	MinDeliveryRatio   *float64 `json:"min_delivery_ratio,omitempty"`   // 接收数/发布数，多个客户端订阅同一主题时会大于1
+	MaxLost            *int64   `json:"max_lost,omitempty"`             // 按序号检查丢失、且不能由发布失败解释的消息数
+	MaxDuplicates      *int64   `json:"max_duplicates,omitempty"`       // 重复收到的消息数，QoS 2下应为0
+	MaxOutOfOrder      *int64   `json:"max_out_of_order,omitempty"`     // 乱序到达的消息数
+}
+
+// SLACheck 单项阈值的检查结果
+type SLACheck struct {
+	Name      string  `json:"name"`
+	Threshold float64 `json:"threshold"`
+	Actual    float64 `json:"actual"`
+	Passed    bool    `json:"passed"`
+}
+
+// loadPlan 读取并校验测试计划文件
+func loadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %v", err)
+	}
+
+	// 命令行只运行单个性能测试，多阶段计划需要导入主节点界面后运行
+	if testplan.HasPhases(data) {
+		return nil, fmt.Errorf("multi-phase test plans (with phases) are not supported by the CLI, import them in the master UI instead")
+	}
+
+	plan := &Plan{}
+	if err := testplan.Decode(data, plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %v", err)
+	}
+
+	if plan.Mode == "" {
+		plan.Mode = workload.ModeBoth
+	}
+	if err := plan.validate(); err != nil {
+		return nil, err
+	}
+	if err := plan.Config.Load(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// redacted 返回写入结果的计划副本，不包含密码、签名密钥和凭据文件内容
+func (p *Plan) redacted() *Plan {
+	plan := *p
+	if c := p.Credentials; c != nil {
+		plan.Credentials = &testplan.Credentials{
+			Config: credentials.Config{
+				Mode:           c.Mode,
+				Username:       c.Username,
+				FileFormat:     c.FileFormat,
+				TokenAlgorithm: c.TokenAlgorithm,
+				TokenTTL:       c.TokenTTL,
+				TokenIssuer:    c.TokenIssuer,
+				TokenAudience:  c.TokenAudience,
+			},
+			FilePath: c.FilePath,
+		}
+	}
+	return &plan
+}
+
+// validate 校验客户端拆分和性能测试参数，MQTT配置由Config.Load校验
+func (p *Plan) validate() error {
+	switch {
+	case p.Clients.Total <= 0:
+		return fmt.Errorf("invalid clients.total: %d", p.Clients.Total)
+	case p.Clients.Prefix == "":
+		return fmt.Errorf("clients.prefix is required")
+	case p.PubQoS < 0 || p.PubQoS > 2:
+		return fmt.Errorf("invalid pub_qos: %d", p.PubQoS)
+	case p.Duration <= 0:
+		return fmt.Errorf("invalid duration: %d", p.Duration)
+	case p.MessageRate <= 0:
+		return fmt.Errorf("invalid message_rate: %d", p.MessageRate)
+	}
+
+	switch p.Mode {
+	case workload.ModeSubscribe, workload.ModePublish, workload.ModeBoth:
+	default:
+		return fmt.Errorf("invalid mode: %s", p.Mode)
+	}
+	return nil
+}
+
+// apply 将计划中的MQTT配置和发布参数应用到slave
+func (p *Plan) apply(slave *models.Slave) {
+	p.Config.Apply(slave)
+	slave.Mode = p.Mode
+
+	// 下发配置时slave会校验发布速率，与性能测试一样按客户端平均分配总速率
+	slave.PubRate = float64(p.MessageRate) / float64(p.Clients.Total)
+	slave.PayloadSize = p.MessageSize
+	slave.PubQoS = p.PubQoS
+}
+
+// evaluate 按SLA检查测试结果
+func (s SLA) evaluate(performance *models.Performance) []SLACheck {
+	var checks []SLACheck
+
+	atMost := func(name string, threshold *float64, actual float64) {
+		if threshold != nil {
+			checks = append(checks, SLACheck{Name: name, Threshold: *threshold, Actual: actual, Passed: actual <= *threshold})
+		}
+	}
+	atLeast := func(name string, threshold *float64, actual float64) {
+		if threshold != nil {
+			checks = append(checks, SLACheck{Name: name, Threshold: *threshold, Actual: actual, Passed: actual >= *threshold})
+		}
+	}
+	atMostCount := func(name string, threshold *int64, actual int64) {
+		if threshold != nil {
+			value := float64(*threshold)
+			atMost(name, &value, float64(actual))
+		}
+	}
+
+	atMost("max_p99_ms", s.MaxP99Ms, performance.LatencyP99)
+	atMost("max_p999_ms", s.MaxP999Ms, performance.LatencyP999)
+	atMost("max_latency_ms", s.MaxLatencyMs, performance.LatencyMax)
+	atLeast("min_throughput", s.MinThroughput, performance.Throughput)
+
+	atMostCount("max_publish_failures", s.MaxPublishFailures, performance.PublishFailures)
+	// 发布失败的消息在订阅端同样表现为丢失，只有超出发布失败数的部分是broker丢失的
+	atMostCount("max_lost", s.MaxLost, max(performance.LostCount-performance.PublishFailures, 0))
+	atMostCount("max_duplicates", s.MaxDuplicates, performance.DuplicateCount)
+	atMostCount("max_out_of_order", s.MaxOutOfOrder, performance.OutOfOrderCount)
+
+	if s.MinDeliveryRatio != nil {
+		ratio := 0.0
+		if performance.PublishedCount > 0 {
+			ratio = float64(performance.ReceivedCount) / float64(performance.PublishedCount)
+		}
+		atLeast("min_delivery_ratio", s.MinDeliveryRatio, ratio)
+	}
+
+	return checks
+}
@@ -8,12 +8,22 @@ import (
 	"log"
 	"net/http"
 	"net/http/pprof"
+	"net/netip"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"mqttbench/internal/broker"
+	"mqttbench/internal/chaos"
+	"mqttbench/internal/diagnostics"
+	"mqttbench/internal/messagetest"
+	"mqttbench/internal/metrics"
+	"mqttbench/internal/ramp"
 	"mqttbench/internal/slave"
+	"mqttbench/internal/topic"
+	"mqttbench/internal/workload"
 )
 
 // Version information set at build time
@@ -26,6 +36,8 @@ var (
 var (
 	activeClients = make(map[string]*slave.MQTTClient)
 	clientsMutex  = sync.RWMutex{}
+	// 每次断开所有连接时递增，用于中止正在按速率建立连接的过程
+	connectGeneration atomic.Int64
 )
 
 // 用于存储Master连接信息
@@ -42,6 +54,28 @@ type ConfigResult struct {
 	FailureCount int    `json:"failure_count"`
 	Connections  int    `json:"connections"` // 添加连接数字段
 	Message      string `json:"message"`
+
+	PublishCount        int64 `json:"publish_count"`         // 发布成功的消息数
+	PublishFailureCount int64 `json:"publish_failure_count"` // 发布失败的消息数
+	PublishSkippedCount int64 `json:"publish_skipped_count"` // 因等待确认的消息过多而跳过的发布次数
+	ReceivedCount       int64 `json:"received_count"`        // 接收到的消息数
+	AckCount            int64 `json:"ack_count"`             // 发布成功的ACK消息数
+	Stopped             bool  `json:"stopped"`               // 是否为停止后的最终结果
+
+	Latency *metrics.LatencyStats `json:"latency,omitempty"` // 本次运行的端到端延迟统计
+
+	ReasonCodes []broker.ReasonCodeCount `json:"reason_codes,omitempty"` // 本次运行中broker返回的各原因码次数
+
+	TLSHandshake         *metrics.LatencyStats `json:"tls_handshake,omitempty"` // 本次运行的TLS握手耗时统计，不包含TCP建连和MQTT CONNECT
+	TLSHandshakeFailures int64                 `json:"tls_handshake_failures"`  // 本次运行TLS握手失败的次数
+
+	Sequence *metrics.SequenceStats `json:"sequence,omitempty"` // 本次运行的消息丢失、重复和乱序统计
+
+	Sources []broker.SourceStats `json:"sources,omitempty"` // 各本地源地址的连接数和失败数，未指定源地址时为空
+
+	Brokers []broker.Stats `json:"brokers,omitempty"` // 各broker节点的连接数、失败数和收发消息数
+
+	Failures []diagnostics.FailureCount `json:"failures,omitempty"` // 本次运行按原因统计的连接失败数和订阅失败数
 }
 
 func main() {
@@ -76,6 +110,7 @@ func main() {
 		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.HandleFunc("/metrics", slave.MetricsHandler)
 
 		log.Printf("pprof服务器启动在端口 %d", *pprofPortFlag)
 		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *pprofPortFlag), mux))
@@ -118,16 +153,25 @@ func main() {
 		fmt.Println("成功注册到master")
 	}
 
+	// 建立到master的控制通道，命令、心跳和结果优先通过该通道传输
+	slave.StartControlChannel(masterIP, masterPort, slaveID, port, messageChan, configChan)
+
+	// 每秒推送一次指标采样到master
+	slave.StartMetricsReporter(masterIP, masterPort, slaveID, time.Second)
+
 	// 设置Master连接信息供network.go使用
 	slave.SetMasterInfo(masterIP, masterPort, slaveID)
 	// 设置停止函数供network.go使用
 	log.Println("设置停止函数: stopSlaveWithoutStatusChange")
 	slave.SetStopFunc(stopSlaveWithoutStatusChange)
+	// 设置命令处理函数，处理结果回复给master
+	slave.SetCommandHandler(handleCommand)
 
 	fmt.Printf("Slave ID: %d\n", slaveID)
 	fmt.Printf("监听端口: %d\n", port)
 	fmt.Printf("Master地址: %s:%d\n", masterIP, masterPort)
 	fmt.Printf("pprof地址: http://localhost:%d/debug/pprof/\n", *pprofPortFlag)
+	fmt.Printf("Prometheus指标: http://localhost:%d/metrics\n", *pprofPortFlag)
 	if Version != "" {
 		fmt.Printf("版本: %s\n", Version)
 	}
@@ -181,35 +225,6 @@ func main() {
 		}
 	}()
 
-	// 在单独的goroutine中处理配置下发
-	go func() {
-		for config := range configChan {
-			log.Printf("处理下发的配置: %+v", config)
-			// 实现实际的MQTT连接和订阅逻辑
-			// 使用ClientID的值和Start的值开始，到Step结束的循环去连接和订阅
-			processConfig(config, masterIP, masterPort, slaveID)
-
-			// 检查是否有启动命令
-			if config.Command == "start" {
-				log.Printf("收到启动命令，开始连接MQTT服务器")
-				// 重置连接计数器
-				slave.ResetConnectionCount()
-
-				// 获取最新的配置
-				configMutex.RLock()
-				if pendingConfig != nil {
-					// 在新的goroutine中启动MQTT连接，避免阻塞配置处理
-					go func(cfg slave.ConfigData) {
-						successCount, failureCount := connectMQTT(cfg)
-						message := fmt.Sprintf("MQTT连接完成，成功%d个，失败%d个", successCount, failureCount)
-						sendConfigResult(masterIP, masterPort, slaveID, successCount, failureCount, message)
-					}(*pendingConfig)
-				}
-				configMutex.RUnlock()
-			}
-		}
-	}()
-
 	// 主goroutine保持运行
 	select {}
 }
@@ -218,10 +233,76 @@ func main() {
 var pendingConfig *slave.ConfigData
 var configMutex = sync.RWMutex{}
 
-// processConfig 处理下发的配置
-func processConfig(config slave.ConfigData, masterIP string, masterPort int, slaveID int) {
-	log.Printf("开始处理配置: MQTT地址=%s:%d, Topic=%s, QoS=%d, ClientID=%s, Start=%d, Step=%d",
-		config.MqttHost, config.MqttPort, config.Topic, config.QoS, config.ClientID, config.Start, config.Step)
+// handleCommand 处理master下发的命令，返回错误表示拒绝执行。
+// MQTT连接和消息测试耗时较长，在后台执行，结果通过配置结果和消息测试结果上报
+func handleCommand(config slave.ConfigData) error {
+	log.Printf("处理下发的配置: %+v", config)
+	// 停止命令已在接收时处理，不需要再作为配置处理
+	if config.Command == "stop" {
+		return nil
+	}
+
+	// 发布命令只调整已连接客户端的发布参数，不重新连接
+	if config.Command == "publish" {
+		return updatePublishing(config)
+	}
+
+	// 消息测试命令不改变当前配置，在后台执行并上报结果
+	if config.Command == "message_test" {
+		if config.MessageTest == nil {
+			return fmt.Errorf("missing message test parameters")
+		}
+		go runMessageTest(config)
+		return nil
+	}
+
+	// 故障注入命令作用于当前已连接的客户端，在后台执行并上报进度
+	if config.Command == "chaos" {
+		return startChaos(config)
+	}
+	// 实现实际的MQTT连接和订阅逻辑
+	// 使用ClientID的值和Start的值开始，到Step结束的循环去连接和订阅
+	if err := processConfig(config, masterIP, masterPort, slaveID); err != nil {
+		return err
+	}
+
+	// 检查是否有启动命令
+	if config.Command == "start" {
+		log.Printf("收到启动命令，开始连接MQTT服务器")
+		// 重置连接计数器
+		slave.ResetConnectionCount()
+		slave.ResetPublishCount()
+		slave.ResetMessageCount()
+		slave.ResetAckMessageCount()
+		slave.ResetLatency()
+		slave.ResetReasonCodeCounts()
+		slave.ResetTLSHandshakeStats()
+		slave.ResetSequenceStats()
+		slave.ResetSourceFailures()
+		slave.ResetBrokerStats()
+		slave.ResetClientRecords()
+		slave.ResetFailureCounts()
+		slave.ResetChaosStats()
+
+		// 获取最新的配置
+		configMutex.RLock()
+		if pendingConfig != nil {
+			// 在新的goroutine中启动MQTT连接，避免阻塞命令处理
+			go func(cfg slave.ConfigData) {
+				successCount, failureCount := connectMQTT(cfg)
+				message := fmt.Sprintf("MQTT连接完成，成功%d个，失败%d个", successCount, failureCount)
+				sendConfigResult(masterIP, masterPort, slaveID, successCount, failureCount, message)
+			}(*pendingConfig)
+		}
+		configMutex.RUnlock()
+	}
+	return nil
+}
+
+// processConfig 处理下发的配置，配置无效时返回错误
+func processConfig(config slave.ConfigData, masterIP string, masterPort int, slaveID int) error {
+	log.Printf("开始处理配置: MQTT地址=%s:%d, Topic=%s, QoS=%d, ClientID=%s, Start=%d, Step=%d, Mode=%s",
+		config.MqttHost, config.MqttPort, config.Topic, config.QoS, config.ClientID, config.Start, config.Step, config.Mode)
 	log.Printf("配置数据详情: %+v", config)
 
 	// 计算总客户端数：Step值即为客户端数量
@@ -230,11 +311,110 @@ func processConfig(config slave.ConfigData, masterIP string, masterPort int, sla
 		log.Printf("警告: 配额设置无效，Step(%d) 应该大于 0", config.Step)
 		// 发送配置结果反馈给master
 		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "配额设置无效")
-		return
+		return fmt.Errorf("invalid step %d, must be greater than 0", config.Step)
 	}
 
 	log.Printf("配额信息: 起始值 %d，客户端数量 %d", config.Start, totalClients)
 
+	// 检查建连策略
+	if err := config.Ramp.Validate(); err != nil {
+		log.Printf("警告: 建连策略设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "建连策略设置无效")
+		return err
+	}
+
+	// 检查协议版本和MQTT 5.0参数
+	err := broker.ValidateProtocolVersion(config.ProtocolVersion)
+	if err == nil {
+		err = config.MQTT5.Validate()
+	}
+	if err != nil {
+		log.Printf("警告: 协议版本设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "协议版本设置无效")
+		return err
+	}
+
+	// 检查传输方式
+	if err := slave.ValidateTransport(config); err != nil {
+		log.Printf("警告: 传输方式设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "传输方式设置无效")
+		return err
+	}
+
+	// 检查认证方式，凭据文件在这里解析一次，所有客户端共用
+	if _, err := config.Credentials.Provider(); err != nil {
+		log.Printf("警告: 认证方式设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "认证方式设置无效: "+err.Error())
+		return err
+	}
+
+	// 检查broker节点列表
+	if err := config.ValidateBrokers(); err != nil {
+		log.Printf("警告: broker节点设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "broker节点设置无效: "+err.Error())
+		return err
+	}
+	if len(config.Brokers) > 0 {
+		log.Printf("broker节点: 共 %d 个，分配方式 %s", len(config.Brokers), config.BrokerPolicy)
+	}
+
+	// 检查本地源地址，确保所有地址都能绑定
+	sources, err := broker.ParseSourceIPs(config.SourceIPs)
+	if err == nil {
+		err = slave.CheckSourceIPs(sources)
+	}
+	if err != nil {
+		log.Printf("警告: 源地址设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "源地址设置无效: "+err.Error())
+		return err
+	}
+	if len(sources) > 0 {
+		log.Printf("源地址: 共 %d 个，客户端按序号轮流绑定", len(sources))
+	}
+
+	// 检查订阅和发布主题模板
+	if err := config.ValidateTopics(); err != nil {
+		log.Printf("警告: 主题设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "主题设置无效: "+err.Error())
+		return err
+	}
+
+	// 检查ACK配置，主题和字段模板在这里解析一次，所有客户端共用
+	if _, err := config.Ack.Responder(config.AckTopic); err != nil {
+		log.Printf("警告: ACK设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "ACK设置无效: "+err.Error())
+		return err
+	}
+
+	// 检查TLS配置，证书和私钥在这里解析一次，所有客户端共用
+	if _, err := config.TLS.ClientConfig(config.MqttHost); err != nil {
+		log.Printf("警告: TLS配置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "TLS配置无效: "+err.Error())
+		return err
+	}
+
+	// 不再按端口号自动启用TLS，明文连接8883端口时提示检查传输方式
+	for _, node := range slave.PlaintextTLSPorts(config) {
+		log.Printf("警告: 使用明文TCP连接 %s，该端口通常用于TLS，如需TLS请将传输方式设置为ssl或启用TLS", node.Address())
+	}
+
+	// 发布模式下检查发布速率
+	if workload.IsPublishMode(config.Mode) {
+		if err := workload.ValidatePublishRate(config.PubRate, false); err != nil {
+			log.Printf("警告: 发布速率设置无效: %v", err)
+			sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "发布速率设置无效")
+			return err
+		}
+		log.Printf("发布信息: 每个客户端每秒 %v 条，消息大小 %d 字节，QoS %d", config.PubRate, config.PayloadSize, config.PubQoS)
+	}
+
+	// 检查消息生成方式，connect模式下也可能通过publish命令开始发布
+	if err := config.Payload.Validate(); err != nil {
+		log.Printf("警告: 消息内容设置无效: %v", err)
+		sendConfigResult(masterIP, masterPort, slaveID, 0, 0, "消息内容设置无效: "+err.Error())
+		return err
+	}
+
 	// 保存配置数据以备后用
 	configMutex.Lock()
 	pendingConfig = &config
@@ -243,65 +423,144 @@ func processConfig(config slave.ConfigData, masterIP string, masterPort int, sla
 	// 发送配置接收确认给master，表示配置已接收并保存
 	message := fmt.Sprintf("配置已接收并保存，共%d个客户端", totalClients)
 	sendConfigResult(masterIP, masterPort, slaveID, totalClients, 0, message)
+	return nil
 }
 
-// connectMQTT 连接到MQTT服务器
+// connectMQTT 按建连策略连接到MQTT服务器，建连期间定时上报进度
 func connectMQTT(config slave.ConfigData) (int, int) {
-	// 真实的MQTT连接逻辑
-	successCount := 0
-	failureCount := 0
-	var successMutex sync.Mutex // 用于保护successCount和failureCount的互斥锁
-
 	// 断开所有现有连接
 	disconnectAllClients()
+	generation := connectGeneration.Load()
 
 	// 设置期望的连接数
 	slave.SetExpectedConnections(config.Step)
 
-	// 创建WaitGroup
-	var wg sync.WaitGroup
+	if config.Ramp != nil {
+		log.Printf("建连策略: %+v，共 %d 个客户端", *config.Ramp, config.Step)
+	}
+
+	// 连接期间收到停止或新的启动命令时不再建立剩余的连接
+	aborted := func() bool {
+		return connectGeneration.Load() != generation
+	}
+
+	// 上报建连进度，失败时只记录日志，不影响建连
+	report := func(progress ramp.Progress) {
+		progress.SlaveID = slaveID
+		if err := slave.SendRampProgress(masterIP, masterPort, progress); err != nil {
+			log.Printf("发送建连进度到master失败: %v", err)
+		}
+	}
+
+	// 源地址已在processConfig中校验
+	sources, _ := broker.ParseSourceIPs(config.SourceIPs)
 
 	// 从Start开始创建Step个客户端
-	for i := 0; i < config.Step; i++ {
+	progress := slave.RunRamp(config.Ramp, config.Step, func(index int) error {
 		// 使用符合规范的客户端ID格式：数据库中的client_id + "_" + 7位数字序号
-		clientID := fmt.Sprintf("%s_%07d", config.ClientID, config.Start+i)
+		id := fmt.Sprintf("%s_%07d", config.ClientID, config.Start+index)
 
-		// 增加WaitGroup计数器
-		wg.Add(1)
+		// 创建MQTT客户端，按客户端ID、序号和slave ID展开主题模板
+		mqttClient := slave.NewMQTTClient(config, topic.Vars{ClientID: id, Index: config.Start + index, SlaveID: slaveID})
 
-		// 为每个客户端启动一个goroutine
-		go func(id string, index int) {
-			// goroutine结束时减少WaitGroup计数器
-			defer wg.Done()
+		// 按分配方式选择broker节点
+		node := config.PickBroker(index, id)
+		mqttClient.SetBroker(node)
 
-			// 创建MQTT客户端
-			mqttClient := slave.NewMQTTClient(config)
+		// 按序号轮流绑定源地址，使每个源地址上的连接数大致相同
+		var source netip.Addr
+		if len(sources) > 0 {
+			source = sources[index%len(sources)]
+			mqttClient.SetSourceIP(source)
+		}
 
-			// 连接到MQTT服务器
-			err := mqttClient.Connect(id)
-			if err != nil {
-				log.Printf("创建MQTT客户端 %s 失败: %v", id, err)
-				successMutex.Lock()
-				failureCount++
-				successMutex.Unlock()
-				return
-			}
+		// 连接到MQTT服务器
+		if err := mqttClient.Connect(id); err != nil {
+			log.Printf("创建MQTT客户端 %s 失败: %v", id, err)
+			slave.CountSourceFailed(source)
+			slave.CountBrokerFailed(node)
+			return err
+		}
+
+		// 连接期间所有连接已被断开，丢弃新建立的连接
+		if aborted() {
+			mqttClient.Disconnect()
+			return slave.ErrRampAborted
+		}
+
+		// 存储活跃的客户端
+		setActiveClient(id, mqttClient)
 
-			// 存储活跃的客户端
-			setActiveClient(id, mqttClient)
+		// 发布模式下开始按配置速率发布消息
+		if workload.IsPublishMode(config.Mode) {
+			mqttClient.StartPublishing(id)
+		}
+		return nil
+	}, aborted, report)
+
+	log.Printf("MQTT连接完成，成功创建 %d 个客户端，失败 %d 个客户端，用时 %.1f 秒", progress.Connected, progress.Failed, progress.Elapsed)
+	return progress.Connected, progress.Failed
+}
 
-			// log.Printf("成功创建并连接MQTT客户端: %s", id)
-			successMutex.Lock()
-			successCount++
-			successMutex.Unlock()
-		}(clientID, i)
+// updatePublishing 按publish命令的参数调整所有已连接客户端的发布速率，速率为0时停止发布
+func updatePublishing(config slave.ConfigData) error {
+	if err := workload.ValidatePublishRate(config.PubRate, true); err != nil {
+		return err
+	}
+	if err := config.Payload.Validate(); err != nil {
+		return err
+	}
+	if err := config.ValidateTopics(); err != nil {
+		return err
 	}
 
-	// 等待所有goroutine完成
-	wg.Wait()
+	clients := getAllActiveClients()
+	for clientID, client := range clients {
+		client.UpdatePublishing(clientID, config)
+	}
+	log.Printf("已更新 %d 个客户端的发布速率: 每个客户端每秒 %v 条", len(clients), config.PubRate)
+	return nil
+}
 
-	log.Printf("MQTT连接完成，成功创建 %d 个客户端，失败 %d 个客户端", successCount, failureCount)
-	return successCount, failureCount
+// startChaos 对当前的客户端开始故障注入，进度上报给master
+func startChaos(config slave.ConfigData) error {
+	if config.Chaos == nil {
+		return fmt.Errorf("missing chaos parameters")
+	}
+
+	active := getAllActiveClients()
+	clients := make([]*slave.MQTTClient, 0, len(active))
+	for _, client := range active {
+		clients = append(clients, client)
+	}
+
+	return slave.StartChaos(clients, *config.Chaos, func(report chaos.Report) {
+		report.SlaveID = slaveID
+		if err := slave.SendChaosReport(masterIP, masterPort, report); err != nil {
+			log.Printf("发送故障注入进度失败: %v", err)
+		}
+	})
+}
+
+// runMessageTest 执行消息测试并上报结果给master
+func runMessageTest(config slave.ConfigData) {
+	if config.MessageTest == nil {
+		log.Println("收到消息测试命令，但缺少测试参数")
+		return
+	}
+
+	log.Printf("开始执行消息测试 %d", config.MessageTest.TestID)
+	report := messagetest.Report{
+		SlaveID: slaveID,
+		TestID:  config.MessageTest.TestID,
+		Results: slave.RunMessageTests(config),
+	}
+
+	if err := slave.SendMessageTestReport(masterIP, masterPort, report); err != nil {
+		log.Printf("发送消息测试结果到master失败: %v", err)
+		return
+	}
+	log.Printf("消息测试 %d 结果已发送到master", config.MessageTest.TestID)
 }
 
 // stopSlaveWithoutStatusChange 停止Slave但不改变状态
@@ -318,6 +577,9 @@ func stopSlaveWithoutStatusChange() {
 func disconnectAllClients() {
 	log.Println("disconnectAllClients函数被调用，当前活跃连接数:", getActiveClientsCount())
 
+	connectGeneration.Add(1)
+	slave.StopChaos()
+
 	clientsMutex.Lock()
 	defer clientsMutex.Unlock()
 
@@ -380,36 +642,28 @@ func sendConfigResult(masterIP string, masterPort int, slaveID int, successCount
 		FailureCount: failureCount,
 		Connections:  connections, // 添加连接数
 		Message:      message,
-	}
 
-	// 将数据序列化为JSON
-	data, err := json.Marshal(configResult)
-	if err != nil {
-		log.Printf("序列化配置结果失败: %v", err)
-		return
+		PublishCount:        slave.GetPublishCount(),
+		PublishFailureCount: slave.GetPublishFailureCount(),
+		PublishSkippedCount: slave.GetPublishSkippedCount(),
+		ReceivedCount:       slave.GetMessageCount(),
+		AckCount:            slave.GetAckMessageCount(),
+		Latency:             latencyStats(),
+		ReasonCodes:         slave.GetReasonCodeCounts(),
+
+		TLSHandshake:         tlsHandshakeStats(),
+		TLSHandshakeFailures: slave.GetTLSHandshakeFailures(),
+
+		Sequence: sequenceStats(),
+		Sources:  slave.GetSourceStats(),
+		Brokers:  slave.GetBrokerStats(),
+		Failures: slave.GetFailureCounts(),
 	}
 
-	// 构造master的配置结果URL
-	configResultURL := fmt.Sprintf("http://%s:%d/config-result", masterIP, masterPort)
-
-	// 创建HTTP客户端，设置超时时间
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// 发送POST请求
-	resp, err := client.Post(configResultURL, "application/json", bytes.NewBuffer(data))
-	if err != nil {
+	if err := postConfigResult(masterIP, masterPort, configResult); err != nil {
 		log.Printf("发送配置结果到master失败: %v", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	// 检查响应状态
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("发送配置结果到master失败，状态码: %d", resp.StatusCode)
-		return
-	}
 
 	log.Printf("配置结果已发送到master: 成功%d个, 失败%d个, 连接数%d个, 消息: %s", successCount, failureCount, connections, message)
 }
@@ -426,13 +680,43 @@ func sendConfigResultWithoutStatusChange() {
 		FailureCount: 0,
 		Connections:  connections, // 添加连接数
 		Message:      "Slave已停止，所有连接已断开",
+
+		PublishCount:        slave.GetPublishCount(),
+		PublishFailureCount: slave.GetPublishFailureCount(),
+		PublishSkippedCount: slave.GetPublishSkippedCount(),
+		ReceivedCount:       slave.GetMessageCount(),
+		AckCount:            slave.GetAckMessageCount(),
+		Latency:             latencyStats(),
+		ReasonCodes:         slave.GetReasonCodeCounts(),
+		Stopped:             true,
+
+		TLSHandshake:         tlsHandshakeStats(),
+		TLSHandshakeFailures: slave.GetTLSHandshakeFailures(),
+
+		Sequence: sequenceStats(),
+		Sources:  slave.GetSourceStats(),
+		Brokers:  slave.GetBrokerStats(),
+		Failures: slave.GetFailureCounts(),
+	}
+
+	if err := postConfigResult(masterIP, masterPort, configResult); err != nil {
+		log.Printf("发送配置结果到master失败: %v", err)
+		return
+	}
+
+	log.Printf("配置结果已发送到master: 连接数%d个, 消息: %s", connections, "Slave已停止，所有连接已断开")
+}
+
+// postConfigResult 发送配置结果，控制通道已连接时通过控制通道发送，否则使用HTTP
+func postConfigResult(masterIP string, masterPort int, configResult ConfigResult) error {
+	if err := slave.SendControlMessage("config_result", configResult); err == nil {
+		return nil
 	}
 
 	// 将数据序列化为JSON
 	data, err := json.Marshal(configResult)
 	if err != nil {
-		log.Printf("序列化配置结果失败: %v", err)
-		return
+		return fmt.Errorf("序列化配置结果失败: %v", err)
 	}
 
 	// 构造master的配置结果URL
@@ -446,16 +730,40 @@ func sendConfigResultWithoutStatusChange() {
 	// 发送POST请求
 	resp, err := client.Post(configResultURL, "application/json", bytes.NewBuffer(data))
 	if err != nil {
-		log.Printf("发送配置结果到master失败: %v", err)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("发送配置结果到master失败，状态码: %d", resp.StatusCode)
-		return
+		return fmt.Errorf("状态码: %d", resp.StatusCode)
 	}
+	return nil
+}
 
-	log.Printf("配置结果已发送到master: 连接数%d个, 消息: %s", connections, "Slave已停止，所有连接已断开")
+// latencyStats 获取本次运行的延迟统计，没有样本时返回nil
+func latencyStats() *metrics.LatencyStats {
+	stats := slave.GetLatencyStats()
+	if stats.Count == 0 {
+		return nil
+	}
+	return &stats
+}
+
+// tlsHandshakeStats 获取本次运行的TLS握手耗时统计，没有样本时返回nil
+func tlsHandshakeStats() *metrics.LatencyStats {
+	stats := slave.GetTLSHandshakeStats()
+	if stats.Count == 0 {
+		return nil
+	}
+	return &stats
+}
+
+// sequenceStats 获取本次运行的消息序号检查结果，没有检查任何消息流时返回nil
+func sequenceStats() *metrics.SequenceStats {
+	stats := slave.GetSequenceStats()
+	if stats.Streams == 0 {
+		return nil
+	}
+	return &stats
 }
@@ -0,0 +1,238 @@
+package ack
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 订阅端回复ACK的方式
+const (
+	ModeEEW      = "eew"      // 按EEW协议回复，字段1~5（默认）
+	ModeTemplate = "template" // 按字段映射模板构造ACK
+	ModeOff      = "off"      // 不回复ACK
+)
+
+// DefaultTopic 未设置ACK主题时使用的主题
+const DefaultTopic = "EEW/ACK/Channel1"
+
+// ACK中时间字段的格式
+const timeLayout = "2006-01-02 15:04:05.999"
+
+// eewFields EEW协议的ACK字段：原样返回请求中的1、2字段，附带接收时间、发送时间和客户端ID
+var eewFields = map[string]string{
+	"1": "{{req.1}}",
+	"2": "{{req.2}}",
+	"3": "{{recv_time}}",
+	"4": "{{send_time}}",
+	"5": "{{client_id}}",
+}
+
+// ACK主题和字段模板中的占位符，格式为{{名称}}：
+//
+//	{{req.FIELD}}           请求消息中FIELD字段的值，不存在时为空字符串
+//	{{client_id}}           回复ACK的客户端ID
+//	{{topic}}               收到请求消息的主题
+//	{{recv_time}}           收到请求的时间（2006-01-02 15:04:05.999格式）
+//	{{send_time}}           发送ACK的时间（2006-01-02 15:04:05.999格式）
+//	{{recv_timestamp_ms}}   收到请求的时间（Unix毫秒）
+//	{{send_timestamp_ms}}   发送ACK的时间（Unix毫秒）
+//
+// 字段模板只包含一个占位符时保留请求字段的JSON类型，否则拼接为字符串
+
+// Config ACK配置，master和slave共用，ACK主题模板单独下发
+type Config struct {
+	Mode   string            `json:"mode"`          // 回复方式：eew/template/off，为空时为eew
+	Fields map[string]string `json:"fields"`        // template：ACK字段名到取值模板的映射
+	QoS    *int              `json:"qos,omitempty"` // ACK的QoS，为空时与收到的消息相同
+	Delay  int               `json:"delay"`         // 收到消息后延迟发送ACK的时间（毫秒）
+
+	// 同一份配置的所有客户端共用解析后的模板
+	once      sync.Once
+	responder *Responder
+	err       error
+}
+
+// Responder 按配置构造ACK的主题和内容
+type Responder struct {
+	QoS   int           // ACK的QoS，为负数时与收到的消息相同
+	Delay time.Duration // 收到消息后延迟发送ACK的时间
+
+	topic  fieldTemplate
+	fields map[string]fieldTemplate
+}
+
+// Context 构造ACK时可用的数据
+type Context struct {
+	Request  map[string]interface{} // 请求消息
+	ClientID string                 // 回复ACK的客户端ID
+	Topic    string                 // 收到请求消息的主题
+	RecvTime time.Time              // 收到请求的时间
+	SendTime time.Time              // 发送ACK的时间
+}
+
+// Responder 校验配置并返回ACK构造器，不回复ACK时返回nil。
+// topic为ACK主题模板，同一份配置的所有客户端使用相同的主题模板
+func (c *Config) Responder(topic string) (*Responder, error) {
+	if c == nil {
+		return newResponder(topic, &Config{})
+	}
+
+	c.once.Do(func() {
+		c.responder, c.err = newResponder(topic, c)
+	})
+	return c.responder, c.err
+}
+
+// Validate 校验ACK主题模板、回复方式及其参数，为nil时只检查主题模板
+func (c *Config) Validate(topic string) error {
+	_, err := c.Responder(topic)
+	return err
+}
+
+// newResponder 解析ACK主题和字段模板
+func newResponder(topic string, c *Config) (*Responder, error) {
+	fields := eewFields
+	switch c.Mode {
+	case "", ModeEEW:
+	case ModeTemplate:
+		if len(c.Fields) == 0 {
+			return nil, fmt.Errorf("ack template has no fields")
+		}
+		fields = c.Fields
+	case ModeOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported ack mode: %s", c.Mode)
+	}
+
+	if c.QoS != nil && (*c.QoS < 0 || *c.QoS > 2) {
+		return nil, fmt.Errorf("invalid ack qos %d, must be 0, 1 or 2", *c.QoS)
+	}
+	if c.Delay < 0 {
+		return nil, fmt.Errorf("invalid ack delay %d, must not be negative", c.Delay)
+	}
+
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	r := &Responder{
+		QoS:    -1,
+		Delay:  time.Duration(c.Delay) * time.Millisecond,
+		fields: make(map[string]fieldTemplate, len(fields)),
+	}
+	if c.QoS != nil {
+		r.QoS = *c.QoS
+	}
+
+	var err error
+	if r.topic, err = parseTemplate(topic); err != nil {
+		return nil, fmt.Errorf("invalid ack topic: %v", err)
+	}
+	for name, template := range fields {
+		if name == "" {
+			return nil, fmt.Errorf("ack field name is empty")
+		}
+		if r.fields[name], err = parseTemplate(template); err != nil {
+			return nil, fmt.Errorf("invalid ack field %s: %v", name, err)
+		}
+	}
+	return r, nil
+}
+
+// Build 构造ACK的主题和内容
+func (r *Responder) Build(ctx *Context) (string, map[string]interface{}) {
+	data := make(map[string]interface{}, len(r.fields))
+	for name, template := range r.fields {
+		data[name] = template.value(ctx)
+	}
+	return fmt.Sprint(r.topic.value(ctx)), data
+}
+
+// segment ACK模板的一段，name为空时为原样输出的文本，否则为占位符
+type segment struct {
+	literal string
+	name    string
+	field   string // req：请求消息的字段名
+}
+
+// fieldTemplate 解析后的ACK模板
+type fieldTemplate []segment
+
+// parseTemplate 将ACK模板拆分为文本和占位符
+func parseTemplate(template string) (fieldTemplate, error) {
+	var segments fieldTemplate
+	for template != "" {
+		start := strings.Index(template, "{{")
+		if start < 0 {
+			segments = append(segments, segment{literal: template})
+			break
+		}
+		if start > 0 {
+			segments = append(segments, segment{literal: template[:start]})
+		}
+
+		end := strings.Index(template[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder")
+		}
+		name := strings.TrimSpace(template[start+2 : start+end])
+		s := segment{name: name}
+		switch {
+		case strings.HasPrefix(name, "req."):
+			s.name, s.field = "req", strings.TrimPrefix(name, "req.")
+			if s.field == "" {
+				return nil, fmt.Errorf("placeholder req requires a field name")
+			}
+		case name == "client_id", name == "topic", name == "recv_time", name == "send_time",
+			name == "recv_timestamp_ms", name == "send_timestamp_ms":
+		default:
+			return nil, fmt.Errorf("unknown placeholder: %s", name)
+		}
+		segments = append(segments, s)
+		template = template[start+end+2:]
+	}
+	return segments, nil
+}
+
+// value 计算模板的值，只包含一个占位符时返回占位符的原始值，否则拼接为字符串
+func (t fieldTemplate) value(ctx *Context) interface{} {
+	if len(t) == 1 && t[0].name != "" {
+		return t[0].value(ctx)
+	}
+
+	var builder strings.Builder
+	for _, s := range t {
+		if s.name == "" {
+			builder.WriteString(s.literal)
+		} else {
+			fmt.Fprint(&builder, s.value(ctx))
+		}
+	}
+	return builder.String()
+}
+
+// value 计算占位符的值
+func (s segment) value(ctx *Context) interface{} {
+	switch s.name {
+	case "req":
+		if value, exists := ctx.Request[s.field]; exists {
+			return value
+		}
+		return ""
+	case "client_id":
+		return ctx.ClientID
+	case "topic":
+		return ctx.Topic
+	case "recv_time":
+		return ctx.RecvTime.Format(timeLayout)
+	case "send_time":
+		return ctx.SendTime.Format(timeLayout)
+	case "recv_timestamp_ms":
+		return ctx.RecvTime.UnixMilli()
+	case "send_timestamp_ms":
+		return ctx.SendTime.UnixMilli()
+	}
+	return s.literal
+}
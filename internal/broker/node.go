@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"strconv"
+)
+
+// 客户端分配到broker节点的方式
+const (
+	PolicyRoundRobin = "round_robin" // 按客户端序号轮流分配（默认）
+	PolicyRandom     = "random"      // 每个客户端随机选择一个节点
+	PolicyWeighted   = "weighted"    // 按节点权重的比例，按客户端序号依次分配
+	PolicyHash       = "hash"        // 按客户端ID的哈希分配，同一客户端ID总是连接同一节点
+)
+
+// Node 集群中的一个broker节点
+type Node struct {
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Weight int    `json:"weight"` // weighted：节点的权重，为0时不分配客户端
+}
+
+// Address 返回节点的host:port地址，用于统计和日志
+func (n Node) Address() string {
+	return net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+}
+
+// Stats 一个broker节点的连接和消息统计，由slave上报
+type Stats struct {
+	Broker    string `json:"broker"`    // 节点的host:port地址
+	Connected int64  `json:"connected"` // 当前处于连接状态的客户端数
+	Failed    int64  `json:"failed"`    // 本次运行建立连接失败的客户端数
+	Published int64  `json:"published"` // 本次运行发布成功的消息数
+	Received  int64  `json:"received"`  // 本次运行收到的消息数
+}
+
+// ValidateNodes 校验broker节点列表和分配方式
+func ValidateNodes(nodes []Node, policy string) error {
+	switch policy {
+	case "", PolicyRoundRobin, PolicyRandom, PolicyHash:
+	case PolicyWeighted:
+		if len(nodes) > 0 && totalWeight(nodes) == 0 {
+			return fmt.Errorf("weighted broker policy requires at least one node with a positive weight")
+		}
+	default:
+		return fmt.Errorf("unsupported broker policy: %s", policy)
+	}
+
+	for _, node := range nodes {
+		if node.Host == "" {
+			return fmt.Errorf("broker host is empty")
+		}
+		if node.Port <= 0 || node.Port > 65535 {
+			return fmt.Errorf("invalid port %d for broker %s", node.Port, node.Host)
+		}
+		if node.Weight < 0 {
+			return fmt.Errorf("invalid weight %d for broker %s, must not be negative", node.Weight, node.Address())
+		}
+	}
+	return nil
+}
+
+// Pick 按分配方式为客户端选择broker节点，index为客户端在本slave中的序号，nodes不能为空
+func Pick(nodes []Node, policy string, index int, clientID string) Node {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+
+	switch policy {
+	case PolicyRandom:
+		return nodes[rand.IntN(len(nodes))]
+	case PolicyWeighted:
+		if total := totalWeight(nodes); total > 0 {
+			position := index % total
+			for _, node := range nodes {
+				if position < node.Weight {
+					return node
+				}
+				position -= node.Weight
+			}
+		}
+	case PolicyHash:
+		hash := fnv.New32a()
+		hash.Write([]byte(clientID))
+		return nodes[hash.Sum32()%uint32(len(nodes))]
+	}
+	return nodes[index%len(nodes)]
+}
+
+// totalWeight 返回所有节点的权重之和
+func totalWeight(nodes []Node) int {
+	total := 0
+	for _, node := range nodes {
+		total += node.Weight
+	}
+	return total
+}
@@ -0,0 +1,103 @@
+package broker
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestPick(t *testing.T) {
+	a := Node{Host: "a", Port: 1883, Weight: 2}
+	b := Node{Host: "b", Port: 1883, Weight: 1}
+	c := Node{Host: "c", Port: 1883, Weight: 0}
+
+	tests := []struct {
+		name   string
+		nodes  []Node
+		policy string
+		want   []Node // 客户端序号0, 1, 2...依次分配到的节点
+	}{
+		{"default is round robin", []Node{a, b, c}, "", []Node{a, b, c, a, b, c}},
+		{"round robin", []Node{a, b, c}, PolicyRoundRobin, []Node{a, b, c, a}},
+		{"single node", []Node{c}, PolicyWeighted, []Node{c, c, c}},
+		{"weighted", []Node{a, b}, PolicyWeighted, []Node{a, a, b, a, a, b}},
+		{"weighted skips zero weight", []Node{c, a, b}, PolicyWeighted, []Node{a, a, b, a}},
+		{"weighted without weights falls back to round robin", []Node{c, {Host: "d", Port: 1883}}, PolicyWeighted, []Node{c, {Host: "d", Port: 1883}, c}},
+		{"unknown policy falls back to round robin", []Node{a, b}, "unknown", []Node{a, b, a}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for index, want := range tt.want {
+				if got := Pick(tt.nodes, tt.policy, index, "client"); got != want {
+					t.Errorf("Pick(index %d) = %s, want %s", index, got.Address(), want.Address())
+				}
+			}
+		})
+	}
+}
+
+func TestPickSpread(t *testing.T) {
+	nodes := []Node{{Host: "a", Port: 1883}, {Host: "b", Port: 1883}, {Host: "c", Port: 1883}}
+
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"random", PolicyRandom},
+		{"hash", PolicyHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := make(map[Node]int)
+			for index := 0; index < 300; index++ {
+				clientID := "client-" + strconv.Itoa(index)
+				node := Pick(nodes, tt.policy, index, clientID)
+				if !slices.Contains(nodes, node) {
+					t.Fatalf("Pick returned unknown node %s", node.Address())
+				}
+				used[node]++
+
+				// 哈希分配只取决于客户端ID
+				if tt.policy == PolicyHash {
+					if again := Pick(nodes, tt.policy, index+1, clientID); again != node {
+						t.Errorf("client %s moved from %s to %s", clientID, node.Address(), again.Address())
+					}
+				}
+			}
+			if len(used) != len(nodes) {
+				t.Errorf("300 clients used %d of %d nodes: %v", len(used), len(nodes), used)
+			}
+		})
+	}
+}
+
+func TestValidateNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []Node
+		policy  string
+		wantErr bool
+	}{
+		{"no nodes", nil, "", false},
+		{"round robin", []Node{{Host: "a", Port: 1883}, {Host: "b", Port: 8883}}, PolicyRoundRobin, false},
+		{"weighted", []Node{{Host: "a", Port: 1883, Weight: 1}, {Host: "b", Port: 1883}}, PolicyWeighted, false},
+		{"weighted without nodes", nil, PolicyWeighted, false},
+		{"weighted all zero", []Node{{Host: "a", Port: 1883}, {Host: "b", Port: 1883}}, PolicyWeighted, true},
+		{"unknown policy", []Node{{Host: "a", Port: 1883}}, "least_connections", true},
+		{"empty host", []Node{{Port: 1883}}, "", true},
+		{"zero port", []Node{{Host: "a"}}, "", true},
+		{"port out of range", []Node{{Host: "a", Port: 65536}}, "", true},
+		{"negative weight", []Node{{Host: "a", Port: 1883, Weight: -1}}, PolicyHash, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNodes(tt.nodes, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
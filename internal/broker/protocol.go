@@ -0,0 +1,49 @@
+package broker
+
+import "fmt"
+
+// MQTT协议版本，与CONNECT报文中的协议级别一致
+const (
+	ProtocolMQTT31  = 3 // MQTT 3.1
+	ProtocolMQTT311 = 4 // MQTT 3.1.1
+	ProtocolMQTT5   = 5 // MQTT 5.0
+)
+
+// MQTT5Config MQTT 5.0连接参数，仅在协议版本为5时使用
+type MQTT5Config struct {
+	SessionExpiry     uint32            `json:"session_expiry"`      // 会话过期时间（秒），0表示连接断开时会话结束
+	ReceiveMaximum    uint16            `json:"receive_maximum"`     // 同时处理的QoS 1/2消息数上限，0表示使用协议默认值65535
+	TopicAliasMaximum uint16            `json:"topic_alias_maximum"` // 接受broker使用的主题别名数上限，0表示不接受
+	TopicAlias        bool              `json:"topic_alias"`         // 发布时使用主题别名，数量不超过broker在CONNACK中允许的上限
+	UserProperties    map[string]string `json:"user_properties"`     // CONNECT和PUBLISH中携带的用户属性
+}
+
+// ReasonCodeCount broker返回的某个原因码的次数
+type ReasonCodeCount struct {
+	Packet string `json:"packet"` // 报文类型：connack/suback/puback/pubrec/pubcomp/disconnect
+	Code   byte   `json:"code"`   // 原因码，MQTT 3.1.1为CONNACK返回码和SUBACK的授予QoS
+	Reason string `json:"reason"` // 原因码说明
+	Count  int64  `json:"count"`
+}
+
+// ValidateProtocolVersion 校验协议版本，0表示使用MQTT 3.1.1（broker不支持时回退到3.1）
+func ValidateProtocolVersion(version int) error {
+	switch version {
+	case 0, ProtocolMQTT31, ProtocolMQTT311, ProtocolMQTT5:
+		return nil
+	}
+	return fmt.Errorf("unsupported protocol version: %d", version)
+}
+
+// Validate 校验MQTT 5.0连接参数，为nil时不检查
+func (c *MQTT5Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for key := range c.UserProperties {
+		if key == "" {
+			return fmt.Errorf("user property name must not be empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package broker
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// MaxSourceAddresses 源地址列表最多展开的地址数
+const MaxSourceAddresses = 65536
+
+// SourceStats 一个本地源地址的连接统计，由slave上报
+type SourceStats struct {
+	SourceIP  string `json:"source_ip"`
+	Connected int64  `json:"connected"` // 当前处于连接状态的客户端数
+	Failed    int64  `json:"failed"`    // 本次运行建立连接失败的客户端数
+}
+
+// ParseSourceIPs 解析本地源地址列表，每项为IP或CIDR。
+// IPv4 CIDR中前缀长度不超过30时跳过网络地址和广播地址，重复的地址只保留一个
+func ParseSourceIPs(entries []string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	seen := make(map[netip.Addr]bool)
+	add := func(addr netip.Addr) error {
+		if seen[addr] {
+			return nil
+		}
+		if len(addrs) >= MaxSourceAddresses {
+			return fmt.Errorf("too many source addresses, at most %d", MaxSourceAddresses)
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+		return nil
+	}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid source address: %s", entry)
+			}
+			if err := add(addr.Unmap()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source CIDR: %s", entry)
+		}
+		prefix = prefix.Masked()
+		first, last := prefix.Addr(), lastAddr(prefix)
+		if first.Is4() && prefix.Bits() <= 30 {
+			first, last = first.Next(), last.Prev()
+		}
+		for addr := first; addr.IsValid() && addr.Compare(last) <= 0; addr = addr.Next() {
+			if err := add(addr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// ValidateSourceIPs 校验本地源地址列表的格式。
+// 地址能否绑定取决于slave所在主机的网络配置，由slave在收到配置时检查
+func ValidateSourceIPs(entries []string) error {
+	_, err := ParseSourceIPs(entries)
+	return err
+}
+
+// lastAddr 返回CIDR中的最后一个地址
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
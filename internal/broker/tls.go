@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+)
+
+// TLSConfig broker连接的TLS配置，master和slave共用，证书和私钥以PEM文本随配置下发
+type TLSConfig struct {
+	Enabled            bool   `json:"enabled"`
+	CACert             string `json:"ca_cert"`              // CA证书，为空时使用系统根证书
+	ClientCert         string `json:"client_cert"`          // 客户端证书，与ClientKey同时设置时启用双向认证
+	ClientKey          string `json:"client_key"`           // 客户端私钥
+	ServerName         string `json:"server_name"`          // SNI及证书校验使用的服务器名，为空时使用MQTT服务器地址
+	MinVersion         string `json:"min_version"`          // 最低TLS版本：1.0/1.1/1.2/1.3，为空时为1.2
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // 不校验服务器证书
+
+	// 同一份配置的所有客户端共用解析后的tls.Config
+	once      sync.Once
+	tlsConfig *tls.Config
+	err       error
+}
+
+// TLS版本名称
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ClientConfig 解析证书并返回客户端使用的tls.Config，未启用TLS时返回nil
+func (c *TLSConfig) ClientConfig(host string) (*tls.Config, error) {
+	if c == nil || !c.Enabled {
+		return nil, nil
+	}
+
+	c.once.Do(func() {
+		c.tlsConfig, c.err = c.build(host)
+	})
+	return c.tlsConfig, c.err
+}
+
+// Validate 校验TLS版本并解析证书，为nil或未启用时不检查
+func (c *TLSConfig) Validate() error {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+	_, err := c.build("")
+	return err
+}
+
+// build 根据配置构造tls.Config
+func (c *TLSConfig) build(host string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version: %s", c.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, fmt.Errorf("no valid certificate found in CA bundle")
+		}
+		config.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,39 @@
+package broker
+
+import "fmt"
+
+// 连接broker的传输方式
+const (
+	TransportTCP = "tcp" // MQTT over TCP
+	TransportSSL = "ssl" // MQTT over TLS
+	TransportWS  = "ws"  // MQTT over WebSocket
+	TransportWSS = "wss" // MQTT over WebSocket + TLS
+)
+
+// WebSocketConfig WebSocket传输参数，仅在传输方式为ws或wss时使用
+type WebSocketConfig struct {
+	Path    string            `json:"path"`    // 请求路径，为空时为/mqtt
+	Headers map[string]string `json:"headers"` // 握手请求中附加的HTTP头
+}
+
+// ValidateTransport 校验传输方式和WebSocket参数，明文传输不能与TLS配置同时使用
+func ValidateTransport(transport string, tls *TLSConfig, webSocket *WebSocketConfig) error {
+	switch transport {
+	case "", TransportSSL, TransportWSS:
+	case TransportTCP, TransportWS:
+		if tls != nil && tls.Enabled {
+			return fmt.Errorf("TLS requires ssl or wss transport, got %s", transport)
+		}
+	default:
+		return fmt.Errorf("unsupported transport: %s", transport)
+	}
+
+	if webSocket != nil {
+		for key := range webSocket.Headers {
+			if key == "" {
+				return fmt.Errorf("WebSocket header name must not be empty")
+			}
+		}
+	}
+	return nil
+}
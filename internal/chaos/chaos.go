@@ -0,0 +1,75 @@
+package chaos
+
+import (
+	"fmt"
+
+	"mqttbench/internal/metrics"
+)
+
+// 故障注入动作
+const (
+	Disconnect = "disconnect" // 客户端发送DISCONNECT断开连接后重新连接
+	Drop       = "drop"       // 不发送DISCONNECT直接关闭连接，broker会发布遗嘱消息
+	Flap       = "flap"       // 按间隔反复直接关闭连接，持续指定时长
+	Pause      = "pause"      // 暂停读取指定时长，使broker的发送缓冲区积压
+)
+
+// DefaultTimeout 动作结束后等待客户端重连的默认时间（秒）
+const DefaultTimeout = 60
+
+// Action 故障注入参数，master和slave共用
+type Action struct {
+	ID       int64   `json:"id"`       // 动作ID，由master在下发时分配，上报进度时原样返回
+	Type     string  `json:"type"`     // disconnect/drop/flap/pause
+	Percent  float64 `json:"percent"`  // 受影响的已连接客户端比例（%），flap每一轮重新选择
+	Interval int     `json:"interval"` // flap：两轮断开之间的间隔（毫秒）
+	Duration int     `json:"duration"` // flap：持续时长；pause：暂停读取的时长（毫秒）
+	Timeout  int     `json:"timeout"`  // 动作结束后等待客户端重连的最长时间（秒），为0时为60
+}
+
+// Report 故障注入的进度和重连耗时，执行期间由slave定时上报给master
+type Report struct {
+	SlaveID       int                   `json:"slave_id"`
+	ActionID      int64                 `json:"action_id"`
+	Type          string                `json:"type"`
+	Rounds        int64                 `json:"rounds"`                   // 已执行的轮数，flap每个间隔一轮，其他动作为1
+	Affected      int64                 `json:"affected"`                 // 被断开或暂停的连接数，flap按轮累计
+	Disconnected  int64                 `json:"disconnected"`             // 断开的连接数，pause时为暂停期间被broker断开的连接数
+	Reconnected   int64                 `json:"reconnected"`              // 断开后重连成功的连接数
+	Pending       int64                 `json:"pending"`                  // 尚未重连的连接数，结束时为超时未重连的连接数
+	ReconnectTime *metrics.LatencyStats `json:"reconnect_time,omitempty"` // 从连接断开到重新收到CONNACK的耗时
+	Elapsed       float64               `json:"elapsed"`                  // 已用时间（秒）
+	Done          bool                  `json:"done"`                     // 是否已结束
+	Aborted       bool                  `json:"aborted"`                  // 是否因停止命令提前结束
+}
+
+// Validate 校验故障注入参数
+func (a *Action) Validate() error {
+	if a == nil {
+		return fmt.Errorf("missing chaos action")
+	}
+	if a.Percent <= 0 || a.Percent > 100 {
+		return fmt.Errorf("invalid chaos percent %v, must be in (0, 100]", a.Percent)
+	}
+	if a.Timeout < 0 {
+		return fmt.Errorf("invalid chaos timeout %d, must not be negative", a.Timeout)
+	}
+
+	switch a.Type {
+	case Disconnect, Drop:
+	case Flap:
+		if a.Interval <= 0 {
+			return fmt.Errorf("invalid flap interval %d, must be greater than 0", a.Interval)
+		}
+		if a.Duration < a.Interval {
+			return fmt.Errorf("invalid flap duration %d, must not be less than the interval", a.Duration)
+		}
+	case Pause:
+		if a.Duration <= 0 {
+			return fmt.Errorf("invalid pause duration %d, must be greater than 0", a.Duration)
+		}
+	default:
+		return fmt.Errorf("unsupported chaos action: %s", a.Type)
+	}
+	return nil
+}
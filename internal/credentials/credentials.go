@@ -0,0 +1,290 @@
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 连接broker使用的认证方式
+const (
+	ModeClientID = "client_id" // 用户名和密码均为客户端ID（默认）
+	ModeStatic   = "static"    // 所有客户端使用相同的用户名和密码
+	ModeTemplate = "template"  // 用户名和密码由模板根据客户端ID生成
+	ModeFile     = "file"      // 按客户端ID从凭据文件中查找用户名和密码
+	ModeToken    = "token"     // 密码为HMAC签名的JWT，每次连接时重新签发
+)
+
+// 凭据文件格式
+const (
+	FileCSV  = "csv"  // 每行为client_id,username,password，第一行可以是表头
+	FileJSON = "json" // [{"client_id": "", "username": "", "password": ""}]
+)
+
+// token签名算法
+var tokenAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// 未设置有效期时token的有效期（秒）
+const defaultTokenTTL = 3600
+
+// Config 认证方式配置，master和slave共用，凭据文件内容随配置下发
+type Config struct {
+	Mode       string `json:"mode"`        // 认证方式，为空时为client_id
+	Username   string `json:"username"`    // static：用户名；template/token：用户名模板，token为空时为{client_id}
+	Password   string `json:"password"`    // static：密码；template：密码模板
+	File       string `json:"file"`        // file：凭据文件内容
+	FileFormat string `json:"file_format"` // file：凭据文件格式csv/json，为空时为csv
+
+	TokenSecret    string `json:"token_secret"`    // token：签名密钥
+	TokenAlgorithm string `json:"token_algorithm"` // token：签名算法HS256/HS384/HS512，为空时为HS256
+	TokenTTL       int    `json:"token_ttl"`       // token：有效期（秒），为0时为3600
+	TokenIssuer    string `json:"token_issuer"`    // token：iss声明，为空时不设置
+	TokenAudience  string `json:"token_audience"`  // token：aud声明，为空时不设置
+
+	// 同一份配置的所有客户端共用解析后的凭据
+	once     sync.Once
+	provider Provider
+	err      error
+}
+
+// Entry 凭据文件中一个客户端的用户名和密码
+type Entry struct {
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Provider 为客户端生成连接使用的用户名和密码，断线重连时会重新获取
+type Provider interface {
+	Credentials(clientID string) (username, password string, err error)
+}
+
+// Provider 校验配置并返回凭据提供者，为nil时用户名和密码均为客户端ID
+func (c *Config) Provider() (Provider, error) {
+	if c == nil {
+		return clientIDCredentials{}, nil
+	}
+
+	c.once.Do(func() {
+		c.provider, c.err = c.build()
+	})
+	return c.provider, c.err
+}
+
+// Validate 校验认证方式及其参数，为nil时不检查
+func (c *Config) Validate() error {
+	_, err := c.Provider()
+	return err
+}
+
+// build 根据认证方式构造凭据提供者
+func (c *Config) build() (Provider, error) {
+	switch c.Mode {
+	case "", ModeClientID:
+		return clientIDCredentials{}, nil
+	case ModeStatic:
+		if c.Username == "" {
+			return nil, fmt.Errorf("static credentials require a username")
+		}
+		return staticCredentials{username: c.Username, password: c.Password}, nil
+	case ModeTemplate:
+		if c.Username == "" {
+			return nil, fmt.Errorf("credential template requires a username template")
+		}
+		return templateCredentials{username: c.Username, password: c.Password}, nil
+	case ModeFile:
+		entries, err := ParseFile(c.File, c.FileFormat)
+		if err != nil {
+			return nil, err
+		}
+		return fileCredentials(entries), nil
+	case ModeToken:
+		return c.buildToken()
+	}
+	return nil, fmt.Errorf("unsupported credential mode: %s", c.Mode)
+}
+
+// buildToken 构造token凭据提供者
+func (c *Config) buildToken() (Provider, error) {
+	if c.TokenSecret == "" {
+		return nil, fmt.Errorf("token credentials require a secret")
+	}
+
+	algorithm := c.TokenAlgorithm
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+	newHash, ok := tokenAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported token algorithm: %s", c.TokenAlgorithm)
+	}
+
+	if c.TokenTTL < 0 {
+		return nil, fmt.Errorf("invalid token ttl %d, must not be negative", c.TokenTTL)
+	}
+	ttl := c.TokenTTL
+	if ttl == 0 {
+		ttl = defaultTokenTTL
+	}
+
+	username := c.Username
+	if username == "" {
+		username = "{client_id}"
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	return &tokenCredentials{
+		username: username,
+		header:   base64.RawURLEncoding.EncodeToString(header),
+		secret:   []byte(c.TokenSecret),
+		newHash:  newHash,
+		ttl:      time.Duration(ttl) * time.Second,
+		issuer:   c.TokenIssuer,
+		audience: c.TokenAudience,
+	}, nil
+}
+
+// ParseFile 解析凭据文件，返回以客户端ID为键的凭据
+func ParseFile(content, format string) (map[string]Entry, error) {
+	var entries []Entry
+	switch format {
+	case "", FileCSV:
+		reader := csv.NewReader(strings.NewReader(content))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse credential file: %v", err)
+			}
+			// 第一行为表头时跳过
+			if line == 1 && strings.EqualFold(record[0], "client_id") {
+				continue
+			}
+			if len(record) != 3 {
+				return nil, fmt.Errorf("credential file line %d: expected client_id,username,password", line)
+			}
+			entries = append(entries, Entry{ClientID: record[0], Username: record[1], Password: record[2]})
+		}
+	case FileJSON:
+		decoder := json.NewDecoder(strings.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entries); err != nil {
+			return nil, fmt.Errorf("failed to parse credential file: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported credential file format: %s", format)
+	}
+
+	result := make(map[string]Entry, len(entries))
+	for i, entry := range entries {
+		if entry.ClientID == "" {
+			return nil, fmt.Errorf("credential file entry %d: client_id is empty", i+1)
+		}
+		if _, exists := result[entry.ClientID]; exists {
+			return nil, fmt.Errorf("credential file entry %d: duplicate client_id %s", i+1, entry.ClientID)
+		}
+		result[entry.ClientID] = entry
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("credential file is empty")
+	}
+	return result, nil
+}
+
+// clientIDCredentials 用户名和密码均为客户端ID
+type clientIDCredentials struct{}
+
+func (clientIDCredentials) Credentials(clientID string) (string, string, error) {
+	return clientID, clientID, nil
+}
+
+// staticCredentials 所有客户端使用相同的用户名和密码
+type staticCredentials struct {
+	username string
+	password string
+}
+
+func (s staticCredentials) Credentials(clientID string) (string, string, error) {
+	return s.username, s.password, nil
+}
+
+// templateCredentials 将模板中的{client_id}替换为客户端ID
+type templateCredentials struct {
+	username string
+	password string
+}
+
+func (t templateCredentials) Credentials(clientID string) (string, string, error) {
+	return expandTemplate(t.username, clientID), expandTemplate(t.password, clientID), nil
+}
+
+// expandTemplate 替换凭据模板中的{client_id}
+func expandTemplate(template, clientID string) string {
+	return strings.ReplaceAll(template, "{client_id}", clientID)
+}
+
+// fileCredentials 按客户端ID查找凭据文件中的用户名和密码
+type fileCredentials map[string]Entry
+
+func (f fileCredentials) Credentials(clientID string) (string, string, error) {
+	entry, ok := f[clientID]
+	if !ok {
+		return "", "", fmt.Errorf("no credentials for client %s in credential file", clientID)
+	}
+	return entry.Username, entry.Password, nil
+}
+
+// tokenCredentials 以HMAC签名的JWT作为密码，sub为客户端ID
+type tokenCredentials struct {
+	username string // 用户名模板
+	header   string // 编码后的JWT头
+	secret   []byte
+	newHash  func() hash.Hash
+	ttl      time.Duration
+	issuer   string
+	audience string
+}
+
+func (t *tokenCredentials) Credentials(clientID string) (string, string, error) {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"sub": clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(t.ttl).Unix(),
+	}
+	if t.issuer != "" {
+		claims["iss"] = t.issuer
+	}
+	if t.audience != "" {
+		claims["aud"] = t.audience
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", "", err
+	}
+
+	signingInput := t.header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(t.newHash, t.secret)
+	mac.Write([]byte(signingInput))
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return expandTemplate(t.username, clientID), token, nil
+}
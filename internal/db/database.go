@@ -2,6 +2,7 @@ package db
 
 import (
 	"log"
+	"mqttbench/internal/broker"
 	"mqttbench/internal/models"
 	"os"
 	"path/filepath"
@@ -51,11 +52,22 @@ func InitDB() {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(0) // 连接可复用 forever
 
+	// 旧版本连接8883端口时自动使用TLS，没有传输方式字段。升级时将这些从节点的传输方式设为ssl，避免改用明文连接
+	legacyTLSPort := DB.Migrator().HasTable(&models.Slave{}) && !DB.Migrator().HasColumn(&models.Slave{}, "transport")
+
 	// Auto migrate the schema
-	err = DB.AutoMigrate(&models.Performance{}, &models.Message{}, &models.Slave{})
+	err = DB.AutoMigrate(&models.Performance{}, &models.Message{}, &models.MessageTestResult{}, &models.MetricSample{}, &models.TestPlan{}, &models.TestPlanPhase{}, &models.Slave{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	if legacyTLSPort {
+		result := DB.Model(&models.Slave{}).Where("mqtt_port = ?", 8883).Update("transport", broker.TransportSSL)
+		if result.Error != nil {
+			log.Fatal("Failed to migrate slave transport:", result.Error)
+		}
+		log.Printf("Set transport to ssl for %d slaves using port 8883", result.RowsAffected)
+	}
+
 	log.Println("Database initialized successfully")
 }
@@ -0,0 +1,120 @@
+package diagnostics
+
+import (
+	"fmt"
+	"time"
+)
+
+// 客户端的连接状态
+const (
+	StateConnecting   = "connecting"   // 正在建立首次连接
+	StateConnected    = "connected"    // 已连接
+	StateReconnecting = "reconnecting" // 连接丢失后正在自动重连
+	StateFailed       = "failed"       // 首次连接失败，不再重试
+	StateDisconnected = "disconnected" // 已主动断开
+)
+
+// 连接错误的类别，每个类别包括若干更具体的失败原因
+const (
+	CategoryTimeout = "timeout" // 建立连接或等待CONNACK超时
+	CategoryRefused = "refused" // TCP连接被拒绝，或broker以认证以外的原因拒绝连接
+	CategoryAuth    = "auth"    // broker因用户名密码错误或未授权拒绝连接
+	CategoryTLS     = "tls"     // TLS握手或证书校验失败
+	CategoryNetwork = "network" // 其他网络错误，例如连接被重置、地址不可达、域名解析失败
+	CategoryOther   = "other"   // 其他错误
+)
+
+// 连接失败的原因
+const (
+	FailureDNS                = "dns"                 // 域名解析失败
+	FailureTCPRefused         = "tcp_refused"         // TCP连接被拒绝
+	FailureTCPTimeout         = "tcp_timeout"         // TCP建连超时
+	FailureNetwork            = "network"             // 连接被重置、地址不可达等其他网络错误
+	FailureTLSHandshake       = "tls_handshake"       // TLS握手或证书校验失败
+	FailureWebSocketHandshake = "websocket_handshake" // WebSocket握手失败
+	FailureBadCredentials     = "bad_credentials"     // CONNACK：用户名密码或认证方法错误
+	FailureNotAuthorized      = "not_authorized"      // CONNACK：未授权或已被禁止
+	FailureServerUnavailable  = "server_unavailable"  // CONNACK：服务不可用、服务繁忙或超出配额
+	FailureConnackRejected    = "connack_rejected"    // CONNACK：以其他原因拒绝连接，例如协议版本或客户端ID
+	FailureConnectTimeout     = "connect_timeout"     // 在超时时间内未完成连接，例如等待CONNACK超时
+	FailureSubscribe          = "subscribe_failed"    // 连接后订阅失败
+	FailureCredentials        = "credentials"         // 获取连接凭据失败
+	FailureOther              = "other"               // 其他错误
+)
+
+// Record 一个客户端的连接生命周期记录，耗时为0表示尚未完成该阶段
+type Record struct {
+	ClientID      string    `json:"client_id"`
+	Broker        string    `json:"broker"`              // 连接的broker节点地址
+	SourceIP      string    `json:"source_ip,omitempty"` // 绑定的本地源地址，为空时由系统选择
+	State         string    `json:"state"`               // connecting/connected/reconnecting/failed/disconnected
+	TCPConnectMs  float64   `json:"tcp_connect_ms"`      // 最近一次TCP建连耗时
+	ConnackMs     float64   `json:"connack_ms"`          // 首次连接从开始连接到收到CONNACK的耗时，包括TLS握手和失败后的重试
+	SubscribeMs   float64   `json:"subscribe_ms"`        // 最近一次连接后完成所有订阅的耗时
+	Reconnects    int64     `json:"reconnects"`          // 自动重连的次数
+	LastError     string    `json:"last_error,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty"` // 最近一次错误的原因
+	ErrorCategory string    `json:"error_category,omitempty"` // 最近一次错误的类别
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// FailureCount 一种失败原因的计数
+type FailureCount struct {
+	Reason   string `json:"reason"`
+	Category string `json:"category"` // 失败原因所属的错误类别
+	Count    int64  `json:"count"`
+}
+
+// Query 查询客户端记录的过滤条件，为空的条件不过滤
+type Query struct {
+	ClientID string `json:"client_id"` // 客户端ID包含的字符串
+	State    string `json:"state"`
+	Category string `json:"category"` // 最近一次错误的类别
+	Broker   string `json:"broker"`
+	Offset   int    `json:"offset"`
+	Limit    int    `json:"limit"` // 返回的记录数，0时为100，最多1000
+}
+
+// QueryResult 客户端记录的查询结果
+type QueryResult struct {
+	Total   int            `json:"total"`   // 符合过滤条件的记录数
+	States  map[string]int `json:"states"`  // 所有客户端按状态的计数，不受过滤条件影响
+	Records []Record       `json:"records"` // 按客户端ID排序，从Offset开始最多Limit条
+}
+
+// Category 返回失败原因所属的错误类别
+func Category(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case FailureTCPTimeout, FailureConnectTimeout:
+		return CategoryTimeout
+	case FailureTCPRefused, FailureServerUnavailable, FailureConnackRejected:
+		return CategoryRefused
+	case FailureBadCredentials, FailureNotAuthorized:
+		return CategoryAuth
+	case FailureTLSHandshake:
+		return CategoryTLS
+	case FailureDNS, FailureNetwork, FailureWebSocketHandshake:
+		return CategoryNetwork
+	}
+	return CategoryOther
+}
+
+// Validate 校验查询条件中的状态和错误类别
+func (q Query) Validate() error {
+	switch q.State {
+	case "", StateConnecting, StateConnected, StateReconnecting, StateFailed, StateDisconnected:
+	default:
+		return fmt.Errorf("unsupported client state: %s", q.State)
+	}
+	switch q.Category {
+	case "", CategoryTimeout, CategoryRefused, CategoryAuth, CategoryTLS, CategoryNetwork, CategoryOther:
+	default:
+		return fmt.Errorf("unsupported error category: %s", q.Category)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return fmt.Errorf("offset and limit must not be negative")
+	}
+	return nil
+}
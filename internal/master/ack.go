@@ -0,0 +1,24 @@
+package master
+
+import (
+	"mqttbench/internal/ack"
+	"mqttbench/internal/models"
+)
+
+// NewAckConfig 根据slave记录构造ACK配置，按EEW协议立即回复且QoS与收到的消息相同时返回nil
+func NewAckConfig(slave *models.Slave) *ack.Config {
+	if (slave.AckMode == "" || slave.AckMode == ack.ModeEEW) && slave.AckQoS == nil && slave.AckDelay == 0 {
+		return nil
+	}
+	return &ack.Config{
+		Mode:   slave.AckMode,
+		Fields: slave.AckFields,
+		QoS:    slave.AckQoS,
+		Delay:  slave.AckDelay,
+	}
+}
+
+// ValidateAck 校验slave的ACK主题模板和ACK配置
+func ValidateAck(slave *models.Slave) error {
+	return NewAckConfig(slave).Validate(slave.AckTopic)
+}
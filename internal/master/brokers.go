@@ -0,0 +1,23 @@
+package master
+
+import (
+	"mqttbench/internal/broker"
+	"mqttbench/internal/models"
+)
+
+// NewBrokerNodes 根据slave记录构造broker节点列表，未设置时返回nil，客户端连接MqttHost:MqttPort
+func NewBrokerNodes(slave *models.Slave) []broker.Node {
+	if len(slave.Brokers) == 0 {
+		return nil
+	}
+	nodes := make([]broker.Node, len(slave.Brokers))
+	for i, node := range slave.Brokers {
+		nodes[i] = broker.Node{Host: node.Host, Port: node.Port, Weight: node.Weight}
+	}
+	return nodes
+}
+
+// ValidateBrokers 校验slave的broker节点列表和分配方式
+func ValidateBrokers(slave *models.Slave) error {
+	return broker.ValidateNodes(NewBrokerNodes(slave), slave.BrokerPolicy)
+}
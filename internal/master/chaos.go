@@ -0,0 +1,157 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mqttbench/internal/chaos"
+)
+
+// 每个slave保留的故障注入记录数
+const maxChaosReports = 20
+
+// ChaosReport slave上报的故障注入进度，附带master记录的下发参数和收到进度的时间
+type ChaosReport struct {
+	chaos.Report
+
+	Action    *chaos.Action `json:"action,omitempty"` // 下发的参数，由master记录
+	UpdatedAt time.Time     `json:"updated_at"`       // master收到进度的时间
+}
+
+// RunChaos 向slave发送故障注入命令，slave对当前已连接的客户端执行并异步上报进度，返回动作ID
+func (s *Server) RunChaos(slaveID int64, action chaos.Action) (int64, error) {
+	if err := action.Validate(); err != nil {
+		return 0, err
+	}
+
+	slave, err := s.slaveModel.GetByID(slaveID)
+	if err != nil {
+		return 0, err
+	}
+	if slave == nil {
+		return 0, fmt.Errorf("slave %d not found", slaveID)
+	}
+
+	// 使用命令序号作为动作ID，同时下发的动作也不会重复
+	action.ID = int64(s.commandSeq.Add(1))
+	log.Printf("Sending chaos action %d to slave %d: type=%s, percent=%v", action.ID, slaveID, action.Type, action.Percent)
+	if err := s.sendConfig(slave, ConfigData{Command: "chaos", Chaos: &action}); err != nil {
+		return 0, err
+	}
+
+	// slave接受后先记录动作，收到第一次进度前也能看到
+	s.saveChaosReport(chaos.Report{SlaveID: int(slaveID), ActionID: action.ID, Type: action.Type}, &action)
+	return action.ID, nil
+}
+
+// saveChaosReport 保存slave上报的故障注入进度，同一动作只保留最新的进度，action为nil时沿用已记录的下发参数
+func (s *Server) saveChaosReport(progress chaos.Report, action *chaos.Action) {
+	report := ChaosReport{Report: progress, Action: action, UpdatedAt: time.Now()}
+	if report.Done {
+		log.Printf("Slave %d finished chaos action %d (%s): affected=%d, disconnected=%d, reconnected=%d, pending=%d, aborted=%v",
+			report.SlaveID, report.ActionID, report.Type, report.Affected, report.Disconnected, report.Reconnected, report.Pending, report.Aborted)
+	}
+
+	s.chaosMutex.Lock()
+	defer s.chaosMutex.Unlock()
+
+	slaveID := int64(report.SlaveID)
+	reports := s.chaosReports[slaveID]
+	for i, existing := range reports {
+		if existing.ActionID == report.ActionID {
+			if report.Action == nil {
+				report.Action = existing.Action
+			}
+			reports[i] = &report
+			return
+		}
+	}
+	reports = append(reports, &report)
+	if len(reports) > maxChaosReports {
+		reports = reports[len(reports)-maxChaosReports:]
+	}
+	s.chaosReports[slaveID] = reports
+}
+
+// GetChaosReports 获取slave最近的故障注入记录，按下发时间从新到旧排列
+func (s *Server) GetChaosReports(slaveID int64) []ChaosReport {
+	s.chaosMutex.RLock()
+	defer s.chaosMutex.RUnlock()
+
+	reports := s.chaosReports[slaveID]
+	result := make([]ChaosReport, len(reports))
+	for i, report := range reports {
+		result[len(reports)-1-i] = *report
+	}
+	return result
+}
+
+// handleChaosReport 处理slave上报的故障注入进度
+func (s *Server) handleChaosReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析故障注入进度数据
+	var report chaos.Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		log.Printf("Error decoding chaos report data: %v", err)
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// 验证数据
+	if report.SlaveID == 0 || report.ActionID == 0 {
+		http.Error(w, "Invalid chaos report data", http.StatusBadRequest)
+		return
+	}
+
+	s.saveChaosReport(report, nil)
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Chaos report received"))
+}
+
+// handleChaos GET查询slave最近的故障注入记录，POST按请求体中的参数执行故障注入，slave_id必填
+func (s *Server) handleChaos(w http.ResponseWriter, r *http.Request) {
+	slaveID, err := strconv.ParseInt(r.URL.Query().Get("slave_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid slave_id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.GetChaosReports(slaveID))
+
+	case http.MethodPost:
+		var action chaos.Action
+		if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+			http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+			return
+		}
+		if err := action.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		actionID, err := s.RunChaos(slaveID, action)
+		if err != nil {
+			log.Printf("Error running chaos action on slave %d: %v", slaveID, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"action_id": actionID})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,93 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"mqttbench/internal/diagnostics"
+)
+
+// QueryClients 查询slave上各客户端的连接记录，记录保存在slave上，每次启动时清空
+func (s *Server) QueryClients(slaveID int64, query diagnostics.Query) (*diagnostics.QueryResult, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	slave, err := s.slaveModel.GetByID(slaveID)
+	if err != nil {
+		return nil, err
+	}
+	if slave == nil {
+		return nil, fmt.Errorf("slave %d not found", slaveID)
+	}
+
+	reply, err := s.sendCommand(slave, "query_clients", query)
+	if err != nil {
+		return nil, err
+	}
+	if err := commandReplyError(slave.ID, "query_clients", reply); err != nil {
+		return nil, err
+	}
+
+	var ack CommandAck
+	if err := json.Unmarshal(reply.Content, &ack); err != nil {
+		return nil, fmt.Errorf("invalid reply from slave %d: %v", slaveID, err)
+	}
+	var result diagnostics.QueryResult
+	if err := json.Unmarshal(ack.Result, &result); err != nil {
+		return nil, fmt.Errorf("invalid client query result from slave %d: %v", slaveID, err)
+	}
+	return &result, nil
+}
+
+// handleClients 按查询参数查询slave上的客户端记录，slave_id必填，
+// 其余参数client_id、state、category、broker、offset、limit与diagnostics.Query一致
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	slaveID, err := strconv.ParseInt(params.Get("slave_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid slave_id", http.StatusBadRequest)
+		return
+	}
+	query := diagnostics.Query{
+		ClientID: params.Get("client_id"),
+		State:    params.Get("state"),
+		Category: params.Get("category"),
+		Broker:   params.Get("broker"),
+	}
+	if value := params.Get("offset"); value != "" {
+		if query.Offset, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := query.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.QueryClients(slaveID, query)
+	if err != nil {
+		log.Printf("Error querying clients of slave %d: %v", slaveID, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,374 @@
+package master
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"mqttbench/internal/chaos"
+	"mqttbench/internal/messagetest"
+	"mqttbench/internal/models"
+	"mqttbench/internal/ramp"
+
+	"github.com/gorilla/websocket"
+)
+
+// 控制通道参数
+const (
+	controlWriteTimeout = 10 * time.Second // 单条消息的写超时
+	controlPingInterval = 30 * time.Second // master发送ping的间隔
+	controlReadTimeout  = 90 * time.Second // 超过该时间未收到任何数据视为连接断开
+	commandTimeout      = 30 * time.Second // 等待slave确认命令的时间
+)
+
+// controlMessage 控制通道上传输的消息，Type与TCP配置消息保持一致。
+// master下发的命令带有ID，slave以相同ID回复ack或error
+type controlMessage struct {
+	Type    string          `json:"type"`
+	ID      uint64          `json:"id,omitempty"`
+	Content json.RawMessage `json:"content"`
+}
+
+// CommandAck slave对命令的回复内容，Error不为空表示slave拒绝执行命令，查询类命令的结果放在Result中
+type CommandAck struct {
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// CommandError slave收到命令但拒绝执行
+type CommandError struct {
+	SlaveID int64
+	Command string
+	Reason  string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("slave %d rejected %s command: %s", e.SlaveID, e.Command, e.Reason)
+}
+
+// CommandResult 单个slave执行命令的结果，返回给GUI
+type CommandResult struct {
+	SlaveID int64  `json:"slave_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// commandReplyError 解析slave的回复，ack返回nil，error返回CommandError
+func commandReplyError(slaveID int64, command string, reply controlMessage) error {
+	if command == "" {
+		command = "config"
+	}
+
+	switch reply.Type {
+	case "ack":
+		return nil
+	case "error":
+		var ack CommandAck
+		if err := json.Unmarshal(reply.Content, &ack); err != nil || ack.Error == "" {
+			ack.Error = "unknown error"
+		}
+		return &CommandError{SlaveID: slaveID, Command: command, Reason: ack.Error}
+	default:
+		return fmt.Errorf("unexpected reply %q from slave %d for %s command", reply.Type, slaveID, command)
+	}
+}
+
+// controlConn slave主动建立的控制通道连接
+type controlConn struct {
+	slaveID    int64
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+	// 等待回复的命令
+	pending      map[uint64]chan controlMessage
+	pendingMutex sync.Mutex
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+// newControlConn 创建控制通道连接
+func newControlConn(slaveID int64, conn *websocket.Conn) *controlConn {
+	return &controlConn{
+		slaveID: slaveID,
+		conn:    conn,
+		pending: make(map[uint64]chan controlMessage),
+		closed:  make(chan struct{}),
+	}
+}
+
+// writeMessage 向slave发送一条消息，可并发调用
+func (c *controlConn) writeMessage(msgType string, id uint64, content interface{}) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s message: %v", msgType, err)
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	return c.conn.WriteJSON(controlMessage{Type: msgType, ID: id, Content: data})
+}
+
+// request 发送带ID的消息并等待slave回复，超时或连接断开时返回错误
+func (c *controlConn) request(msgType string, id uint64, content interface{}, timeout time.Duration) (controlMessage, error) {
+	replyChan := make(chan controlMessage, 1)
+	c.pendingMutex.Lock()
+	c.pending[id] = replyChan
+	c.pendingMutex.Unlock()
+
+	defer func() {
+		c.pendingMutex.Lock()
+		delete(c.pending, id)
+		c.pendingMutex.Unlock()
+	}()
+
+	if err := c.writeMessage(msgType, id, content); err != nil {
+		return controlMessage{}, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-replyChan:
+		return reply, nil
+	case <-c.closed:
+		return controlMessage{}, fmt.Errorf("control channel closed before slave replied")
+	case <-timer.C:
+		return controlMessage{}, fmt.Errorf("no reply from slave within %v", timeout)
+	}
+}
+
+// resolve 将slave的回复交给等待的命令
+func (c *controlConn) resolve(reply controlMessage) {
+	c.pendingMutex.Lock()
+	replyChan, ok := c.pending[reply.ID]
+	c.pendingMutex.Unlock()
+
+	if !ok {
+		log.Printf("Received %s for unknown command %d from slave %d", reply.Type, reply.ID, c.slaveID)
+		return
+	}
+	select {
+	case replyChan <- reply:
+	default:
+		log.Printf("Duplicate %s for command %d from slave %d", reply.Type, reply.ID, c.slaveID)
+	}
+}
+
+// close 关闭连接并唤醒所有等待回复的命令
+func (c *controlConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// writePing 发送ping保持连接活跃
+func (c *controlConn) writePing() error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	return c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(controlWriteTimeout))
+}
+
+var controlUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// handleControl 处理slave发起的控制通道连接。
+// slave通过/control?slave_id=<id>&port=<port>建立WebSocket连接，连接建立即视为注册，
+// 之后命令、心跳和结果都在该连接上传输，slave位于NAT或防火墙后也能被控制
+func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
+	slaveID, err := strconv.Atoi(r.URL.Query().Get("slave_id"))
+	if err != nil || slaveID == 0 {
+		http.Error(w, "Invalid slave_id", http.StatusBadRequest)
+		return
+	}
+	// 旧版TCP监听端口，仅用于控制通道不可用时回退
+	port, _ := strconv.Atoi(r.URL.Query().Get("port"))
+
+	// 使用master看到的对端地址，避免slave选错网卡
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	conn, err := controlUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade control connection from slave %d: %v", slaveID, err)
+		return
+	}
+
+	regData := RegistrationData{SlaveID: slaveID, IP: host, Port: port}
+	if err := s.registerSlave(regData); err != nil {
+		log.Printf("Error registering slave %d over control channel: %v", slaveID, err)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "registration failed"),
+			time.Now().Add(controlWriteTimeout))
+		conn.Close()
+		return
+	}
+
+	cc := newControlConn(int64(slaveID), conn)
+	s.addControlConn(cc)
+	defer s.removeControlConn(cc)
+
+	log.Printf("Slave %d connected control channel from %s", slaveID, r.RemoteAddr)
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.pingControlConn(cc, done)
+
+	s.readControlMessages(cc, regData)
+}
+
+// readControlMessages 读取并处理slave发来的消息，直到连接断开
+func (s *Server) readControlMessages(cc *controlConn, regData RegistrationData) {
+	cc.conn.SetReadDeadline(time.Now().Add(controlReadTimeout))
+	cc.conn.SetPongHandler(func(string) error {
+		return cc.conn.SetReadDeadline(time.Now().Add(controlReadTimeout))
+	})
+
+	for {
+		var msg controlMessage
+		if err := cc.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Control channel of slave %d closed: %v", cc.slaveID, err)
+			} else {
+				log.Printf("Control channel of slave %d disconnected", cc.slaveID)
+			}
+			return
+		}
+		cc.conn.SetReadDeadline(time.Now().Add(controlReadTimeout))
+
+		switch msg.Type {
+		case "ack", "error":
+			cc.resolve(msg)
+
+		case "heartbeat":
+			var heartbeatData HeartbeatData
+			if err := json.Unmarshal(msg.Content, &heartbeatData); err != nil {
+				log.Printf("Invalid heartbeat from slave %d: %v", cc.slaveID, err)
+				continue
+			}
+			err := s.processHeartbeat(heartbeatData)
+			if errors.Is(err, errSlaveNotFound) {
+				// slave记录被删除，使用连接信息重新注册
+				err = s.registerSlave(regData)
+			}
+			if err != nil {
+				log.Printf("Error processing heartbeat from slave %d: %v", cc.slaveID, err)
+			}
+
+		case "config_result":
+			var configResult ConfigResult
+			if err := json.Unmarshal(msg.Content, &configResult); err != nil {
+				log.Printf("Invalid config result from slave %d: %v", cc.slaveID, err)
+				continue
+			}
+			s.processConfigResult(configResult)
+
+		case "message_test_result":
+			var report messagetest.Report
+			if err := json.Unmarshal(msg.Content, &report); err != nil {
+				log.Printf("Invalid message test result from slave %d: %v", cc.slaveID, err)
+				continue
+			}
+			if err := s.saveMessageTestReport(report); err != nil {
+				log.Printf("Error saving message test result from slave %d: %v", cc.slaveID, err)
+			}
+
+		case "metric_sample":
+			var sample models.MetricSample
+			if err := json.Unmarshal(msg.Content, &sample); err != nil {
+				log.Printf("Invalid metric sample from slave %d: %v", cc.slaveID, err)
+				continue
+			}
+			if err := s.saveMetricSample(&sample); err != nil {
+				log.Printf("Error saving metric sample from slave %d: %v", cc.slaveID, err)
+			}
+
+		case "ramp_progress":
+			var progress ramp.Progress
+			if err := json.Unmarshal(msg.Content, &progress); err != nil {
+				log.Printf("Invalid ramp progress from slave %d: %v", cc.slaveID, err)
+				continue
+			}
+			s.saveRampProgress(progress)
+
+		case "chaos_report":
+			var report chaos.Report
+			if err := json.Unmarshal(msg.Content, &report); err != nil {
+				log.Printf("Invalid chaos report from slave %d: %v", cc.slaveID, err)
+				continue
+			}
+			s.saveChaosReport(report, nil)
+
+		default:
+			log.Printf("Unknown control message from slave %d: %s", cc.slaveID, msg.Type)
+		}
+	}
+}
+
+// pingControlConn 定期发送ping，直到done被关闭
+func (s *Server) pingControlConn(cc *controlConn, done <-chan struct{}) {
+	ticker := time.NewTicker(controlPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := cc.writePing(); err != nil {
+				log.Printf("Failed to ping control channel of slave %d: %v", cc.slaveID, err)
+				cc.close()
+				return
+			}
+		}
+	}
+}
+
+// addControlConn 保存slave的控制通道，替换并关闭同一slave的旧连接
+func (s *Server) addControlConn(cc *controlConn) {
+	s.controlMutex.Lock()
+	old := s.controlConns[cc.slaveID]
+	s.controlConns[cc.slaveID] = cc
+	s.controlMutex.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+}
+
+// removeControlConn 移除并关闭控制通道，已被新连接替换时只关闭自身
+func (s *Server) removeControlConn(cc *controlConn) {
+	s.controlMutex.Lock()
+	if s.controlConns[cc.slaveID] == cc {
+		delete(s.controlConns, cc.slaveID)
+	}
+	s.controlMutex.Unlock()
+
+	cc.close()
+}
+
+// getControlConn 获取slave的控制通道，未连接时返回nil
+func (s *Server) getControlConn(slaveID int64) *controlConn {
+	s.controlMutex.RLock()
+	defer s.controlMutex.RUnlock()
+
+	return s.controlConns[slaveID]
+}
+
+// IsControlConnected 检查slave是否已建立控制通道
+func (s *Server) IsControlConnected(slaveID int64) bool {
+	return s.getControlConn(slaveID) != nil
+}
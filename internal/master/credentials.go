@@ -0,0 +1,25 @@
+package master
+
+import (
+	"mqttbench/internal/credentials"
+	"mqttbench/internal/models"
+)
+
+// NewCredentialConfig 根据slave记录构造认证方式配置，使用默认的client_id方式时返回nil
+func NewCredentialConfig(slave *models.Slave) *credentials.Config {
+	if slave.CredentialMode == "" || slave.CredentialMode == credentials.ModeClientID {
+		return nil
+	}
+	return &credentials.Config{
+		Mode:           slave.CredentialMode,
+		Username:       slave.CredentialUsername,
+		Password:       slave.CredentialPassword,
+		File:           slave.CredentialFile,
+		FileFormat:     slave.CredentialFileFormat,
+		TokenSecret:    slave.TokenSecret,
+		TokenAlgorithm: slave.TokenAlgorithm,
+		TokenTTL:       slave.TokenTTL,
+		TokenIssuer:    slave.TokenIssuer,
+		TokenAudience:  slave.TokenAudience,
+	}
+}
@@ -0,0 +1,287 @@
+package master
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"mqttbench/internal/broker"
+	"mqttbench/internal/metrics"
+	"mqttbench/internal/models"
+)
+
+// slave的所有状态，用于导出每个状态的数量（包括数量为0的状态）
+var slaveStatuses = []string{"online", "running", "offline"}
+
+// handleMetrics 以Prometheus文本格式导出master指标
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	slaves, err := s.slaveModel.GetAll()
+	if err != nil {
+		log.Printf("Error getting slaves for metrics: %v", err)
+		http.Error(w, "Failed to get slaves", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(slaves, func(i, j int) bool { return slaves[i].ID < slaves[j].ID })
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	p := metrics.NewPromWriter(w)
+
+	// slave数量
+	statusCounts := make(map[string]int)
+	for _, slave := range slaves {
+		statusCounts[slave.Status]++
+	}
+	p.Header("mqttbench_master_slaves", "gauge", "Registered slaves by status.")
+	for _, status := range slaveStatuses {
+		p.Sample("mqttbench_master_slaves", float64(statusCounts[status]), metrics.Label{Name: "status", Value: status})
+	}
+
+	// 每个slave的状态
+	p.Header("mqttbench_master_slave_up", "gauge", "Whether the slave is online or running.")
+	for _, slave := range slaves {
+		up := 0.0
+		if slave.Status != "offline" {
+			up = 1
+		}
+		p.Sample("mqttbench_master_slave_up", up, slaveLabels(slave)...)
+	}
+
+	p.Header("mqttbench_master_slave_running", "gauge", "Whether the slave is running a benchmark.")
+	for _, slave := range slaves {
+		running := 0.0
+		if slave.Status == "running" {
+			running = 1
+		}
+		p.Sample("mqttbench_master_slave_running", running, slaveLabels(slave)...)
+	}
+
+	p.Header("mqttbench_master_slave_heartbeat_age_seconds", "gauge", "Seconds since the last heartbeat or update of the slave.")
+	for _, slave := range slaves {
+		p.Sample("mqttbench_master_slave_heartbeat_age_seconds", time.Since(slave.UpdatedAt).Seconds(), slaveLabels(slave)...)
+	}
+
+	p.Header("mqttbench_master_slave_control_connected", "gauge", "Whether the slave has an open control channel.")
+	for _, slave := range slaves {
+		connected := 0.0
+		if s.IsControlConnected(slave.ID) {
+			connected = 1
+		}
+		p.Sample("mqttbench_master_slave_control_connected", connected, slaveLabels(slave)...)
+	}
+
+	p.Header("mqttbench_master_slave_clients", "gauge", "MQTT clients configured for the slave.")
+	for _, slave := range slaves {
+		p.Sample("mqttbench_master_slave_clients", float64(slave.Step), slaveLabels(slave)...)
+	}
+
+	p.Header("mqttbench_master_slave_connections", "gauge", "MQTT connections last reported by the slave.")
+	for _, slave := range slaves {
+		p.Sample("mqttbench_master_slave_connections", float64(slave.Connections), slaveLabels(slave)...)
+	}
+
+	// slave最近一次上报的运行结果
+	s.writeConfigResultMetrics(p, slaves)
+
+	// slave最近一次上报的建连进度
+	s.writeRampMetrics(p, slaves)
+
+	// 测试运行状态
+	performanceGorm := &models.PerformanceGorm{}
+	if counts, err := performanceGorm.CountByStatus(s.db); err == nil {
+		writeStatusCounts(p, "mqttbench_master_performance_tests", "Performance tests by status.", counts)
+	} else {
+		log.Printf("Error counting performance tests for metrics: %v", err)
+	}
+
+	messageGorm := &models.MessageGorm{}
+	if counts, err := messageGorm.CountByStatus(s.db); err == nil {
+		writeStatusCounts(p, "mqttbench_master_message_tests", "Message tests by status.", counts)
+	} else {
+		log.Printf("Error counting message tests for metrics: %v", err)
+	}
+
+	p.WriteRuntimeMetrics()
+
+	if err := p.Err(); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+// writeConfigResultMetrics 导出slave最近一次上报的计数，计数在slave每次启动时重置
+func (s *Server) writeConfigResultMetrics(p *metrics.PromWriter, slaves []*models.Slave) {
+	s.resultsMutex.RLock()
+	defer s.resultsMutex.RUnlock()
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(result *ConfigResult) int64
+	}{
+		{"mqttbench_master_slave_messages_published", "Messages published in the current run, as last reported by the slave.",
+			func(result *ConfigResult) int64 { return result.PublishCount }},
+		{"mqttbench_master_slave_messages_received", "Messages received in the current run, as last reported by the slave.",
+			func(result *ConfigResult) int64 { return result.ReceivedCount }},
+		{"mqttbench_master_slave_acks_sent", "ACKs sent in the current run, as last reported by the slave.",
+			func(result *ConfigResult) int64 { return result.AckCount }},
+		{"mqttbench_master_slave_tls_handshake_failures", "TLS handshakes that failed in the current run, as last reported by the slave.",
+			func(result *ConfigResult) int64 { return result.TLSHandshakeFailures }},
+		{"mqttbench_master_slave_messages_lost", "Messages missing from their publisher's sequence in the current run, as last reported by the slave.",
+			func(result *ConfigResult) int64 { return sequenceOf(result).Lost }},
+		{"mqttbench_master_slave_messages_duplicated", "Messages received more than once in the current run, as last reported by the slave.",
+			func(result *ConfigResult) int64 { return sequenceOf(result).Duplicates }},
+		{"mqttbench_master_slave_messages_out_of_order", "Messages received out of order in the current run, as last reported by the slave.",
+			func(result *ConfigResult) int64 { return sequenceOf(result).OutOfOrder }},
+	}
+
+	for _, counter := range counters {
+		p.Header(counter.name, "gauge", counter.help)
+		for _, slave := range slaves {
+			if result, ok := s.configResults[int(slave.ID)]; ok {
+				p.Sample(counter.name, float64(counter.value(result)), slaveLabels(slave)...)
+			}
+		}
+	}
+
+	brokerGauges := []struct {
+		name  string
+		help  string
+		value func(stats broker.Stats) int64
+	}{
+		{"mqttbench_master_slave_broker_connections", "MQTT clients connected to each broker node, as last reported by the slave.",
+			func(stats broker.Stats) int64 { return stats.Connected }},
+		{"mqttbench_master_slave_broker_connect_failures", "MQTT clients that failed to connect to each broker node in the current run, as last reported by the slave.",
+			func(stats broker.Stats) int64 { return stats.Failed }},
+		{"mqttbench_master_slave_broker_messages_published", "Messages published through each broker node in the current run, as last reported by the slave.",
+			func(stats broker.Stats) int64 { return stats.Published }},
+		{"mqttbench_master_slave_broker_messages_received", "Messages received from each broker node in the current run, as last reported by the slave.",
+			func(stats broker.Stats) int64 { return stats.Received }},
+	}
+	for _, gauge := range brokerGauges {
+		p.Header(gauge.name, "gauge", gauge.help)
+		for _, slave := range slaves {
+			if result, ok := s.configResults[int(slave.ID)]; ok {
+				for _, stats := range result.Brokers {
+					labels := append(slaveLabels(slave), metrics.Label{Name: "broker", Value: stats.Broker})
+					p.Sample(gauge.name, float64(gauge.value(stats)), labels...)
+				}
+			}
+		}
+	}
+
+	p.Header("mqttbench_master_slave_source_connections", "gauge", "MQTT clients connected from each source IP, as last reported by the slave.")
+	for _, slave := range slaves {
+		if result, ok := s.configResults[int(slave.ID)]; ok {
+			for _, source := range result.Sources {
+				labels := append(slaveLabels(slave), metrics.Label{Name: "source_ip", Value: source.SourceIP})
+				p.Sample("mqttbench_master_slave_source_connections", float64(source.Connected), labels...)
+			}
+		}
+	}
+
+	p.Header("mqttbench_master_slave_source_connect_failures", "gauge", "MQTT clients that failed to connect from each source IP in the current run, as last reported by the slave.")
+	for _, slave := range slaves {
+		if result, ok := s.configResults[int(slave.ID)]; ok {
+			for _, source := range result.Sources {
+				labels := append(slaveLabels(slave), metrics.Label{Name: "source_ip", Value: source.SourceIP})
+				p.Sample("mqttbench_master_slave_source_connect_failures", float64(source.Failed), labels...)
+			}
+		}
+	}
+
+	p.Header("mqttbench_master_slave_connection_failures", "gauge", "Connection and subscribe failures by reason in the current run, as last reported by the slave.")
+	for _, slave := range slaves {
+		if result, ok := s.configResults[int(slave.ID)]; ok {
+			for _, failure := range result.Failures {
+				labels := append(slaveLabels(slave),
+					metrics.Label{Name: "reason", Value: failure.Reason},
+					metrics.Label{Name: "category", Value: failure.Category})
+				p.Sample("mqttbench_master_slave_connection_failures", float64(failure.Count), labels...)
+			}
+		}
+	}
+
+	p.Header("mqttbench_master_slave_reason_codes", "gauge", "Reason codes returned by the broker in the current run, as last reported by the slave.")
+	for _, slave := range slaves {
+		result, ok := s.configResults[int(slave.ID)]
+		if !ok {
+			continue
+		}
+		for _, count := range result.ReasonCodes {
+			labels := append(slaveLabels(slave),
+				metrics.Label{Name: "packet", Value: count.Packet},
+				metrics.Label{Name: "code", Value: fmt.Sprintf("0x%02X", count.Code)},
+				metrics.Label{Name: "reason", Value: count.Reason})
+			p.Sample("mqttbench_master_slave_reason_codes", float64(count.Count), labels...)
+		}
+	}
+}
+
+// writeRampMetrics 导出slave最近一次上报的建连进度
+func (s *Server) writeRampMetrics(p *metrics.PromWriter, slaves []*models.Slave) {
+	s.rampMutex.RLock()
+	defer s.rampMutex.RUnlock()
+
+	gauges := []struct {
+		name  string
+		help  string
+		value func(progress *RampProgress) float64
+	}{
+		{"mqttbench_master_slave_ramp_target", "Connections to open in the current ramp-up, as last reported by the slave.",
+			func(progress *RampProgress) float64 { return float64(progress.Target) }},
+		{"mqttbench_master_slave_ramp_connected", "Connections opened in the current ramp-up, as last reported by the slave.",
+			func(progress *RampProgress) float64 { return float64(progress.Connected) }},
+		{"mqttbench_master_slave_ramp_failed", "Connections failed in the current ramp-up, as last reported by the slave.",
+			func(progress *RampProgress) float64 { return float64(progress.Failed) }},
+		{"mqttbench_master_slave_ramp_rate", "Connections opened per second in the last ramp-up report interval.",
+			func(progress *RampProgress) float64 { return progress.Rate }},
+		{"mqttbench_master_slave_ramp_done", "Whether the current ramp-up of the slave has finished.",
+			func(progress *RampProgress) float64 {
+				if progress.Done {
+					return 1
+				}
+				return 0
+			}},
+	}
+
+	for _, gauge := range gauges {
+		p.Header(gauge.name, "gauge", gauge.help)
+		for _, slave := range slaves {
+			if progress, ok := s.rampProgress[slave.ID]; ok {
+				p.Sample(gauge.name, gauge.value(progress), slaveLabels(slave)...)
+			}
+		}
+	}
+}
+
+// writeStatusCounts 按状态导出数量
+func writeStatusCounts(p *metrics.PromWriter, name, help string, counts map[string]int64) {
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	p.Header(name, "gauge", help)
+	for _, status := range statuses {
+		p.Sample(name, float64(counts[status]), metrics.Label{Name: "status", Value: status})
+	}
+}
+
+// slaveLabels 构造slave的标签
+func slaveLabels(slave *models.Slave) []metrics.Label {
+	return []metrics.Label{
+		{Name: "slave_id", Value: strconv.FormatInt(slave.ID, 10)},
+		{Name: "name", Value: slave.Name},
+	}
+}
+
+// sequenceOf 获取配置结果中的序号检查结果，未上报时返回零值
+func sequenceOf(result *ConfigResult) metrics.SequenceStats {
+	if result.Sequence == nil {
+		return metrics.SequenceStats{}
+	}
+	return *result.Sequence
+}
@@ -0,0 +1,130 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"mqttbench/internal/models"
+)
+
+// DeployPartitioned 将totalClients个客户端ID按slave平均或按Capacity加权拆分，
+// 保存每个slave的ClientID/Start/Step后下发配置。离线的slave不参与分配
+func (s *Server) DeployPartitioned(slaveIDs []int64, totalClients int, clientIDPrefix string, weighted bool) ([]*models.Slave, error) {
+	slaves, err := s.PartitionClients(slaveIDs, totalClients, clientIDPrefix, weighted)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, slave := range slaves {
+		// 分配到0个客户端的slave不需要下发
+		if slave.Step == 0 {
+			continue
+		}
+
+		if err := s.deployConfigToSlave(slave.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return slaves, errors.Join(errs...)
+}
+
+// PartitionClients 将totalClients个客户端ID按slave平均或按Capacity加权拆分，
+// 只保存每个slave的ClientID/Start/Step，不下发配置。离线的slave不参与分配
+func (s *Server) PartitionClients(slaveIDs []int64, totalClients int, clientIDPrefix string, weighted bool) ([]*models.Slave, error) {
+	if totalClients <= 0 {
+		return nil, fmt.Errorf("invalid total clients: %d", totalClients)
+	}
+	if clientIDPrefix == "" {
+		return nil, fmt.Errorf("client id prefix is empty")
+	}
+
+	// 获取参与分配的在线slave
+	slaves := make([]*models.Slave, 0, len(slaveIDs))
+	for _, slaveID := range slaveIDs {
+		slave, err := s.slaveModel.GetByID(slaveID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting slave %d: %v", slaveID, err)
+		}
+		if slave == nil {
+			return nil, fmt.Errorf("slave %d not found", slaveID)
+		}
+		if slave.Status == "offline" {
+			log.Printf("Slave %d is offline, skipped from partitioning", slaveID)
+			continue
+		}
+		slaves = append(slaves, slave)
+	}
+
+	if len(slaves) == 0 {
+		return nil, fmt.Errorf("no online slaves selected")
+	}
+
+	// 按ID排序，保证同一组slave每次得到相同的区间
+	sort.Slice(slaves, func(i, j int) bool { return slaves[i].ID < slaves[j].ID })
+
+	weights := make([]int, len(slaves))
+	for i, slave := range slaves {
+		weights[i] = 1
+		if weighted && slave.Capacity > 0 {
+			weights[i] = slave.Capacity
+		}
+	}
+
+	counts := partitionClients(totalClients, weights)
+
+	// 保存区间
+	start := 0
+	for i, slave := range slaves {
+		slave.ClientID = clientIDPrefix
+		slave.Start = start
+		slave.Step = counts[i]
+		start += counts[i]
+
+		log.Printf("Partitioned slave %d: ClientID=%s, Start=%d, Step=%d", slave.ID, slave.ClientID, slave.Start, slave.Step)
+
+		if err := s.slaveModel.UpdateWithoutConnections(slave); err != nil {
+			return nil, fmt.Errorf("failed to save slave %d: %v", slave.ID, err)
+		}
+	}
+
+	return slaves, nil
+}
+
+// partitionClients 按权重拆分total，使用最大余数法保证总和等于total
+func partitionClients(total int, weights []int) []int {
+	counts := make([]int, len(weights))
+
+	totalWeight := 0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		return counts
+	}
+
+	type remainder struct {
+		index int
+		value int
+	}
+	remainders := make([]remainder, len(weights))
+
+	assigned := 0
+	for i, weight := range weights {
+		counts[i] = total * weight / totalWeight
+		remainders[i] = remainder{index: i, value: total * weight % totalWeight}
+		assigned += counts[i]
+	}
+
+	// 剩余的客户端依次分给余数最大的slave
+	sort.SliceStable(remainders, func(i, j int) bool { return remainders[i].value > remainders[j].value })
+	for i := 0; assigned < total; i++ {
+		counts[remainders[i%len(remainders)].index]++
+		assigned++
+	}
+
+	return counts
+}
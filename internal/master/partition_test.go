@@ -0,0 +1,35 @@
+package master
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPartitionClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		weights []int
+		want    []int
+	}{
+		{"even split", 9, []int{1, 1, 1}, []int{3, 3, 3}},
+		{"remainder to first slaves", 11, []int{1, 1, 1}, []int{4, 4, 3}},
+		{"fewer clients than slaves", 2, []int{1, 1, 1}, []int{1, 1, 0}},
+		{"weighted exact", 100, []int{1, 2, 7}, []int{10, 20, 70}},
+		{"largest remainder first", 10, []int{1, 2, 4}, []int{1, 3, 6}},
+		{"equal remainders keep order", 10, []int{3, 1}, []int{8, 2}},
+		{"single slave", 7, []int{5}, []int{7}},
+		{"zero total", 0, []int{1, 2}, []int{0, 0}},
+		{"zero weights", 5, []int{0, 0}, []int{0, 0}},
+		{"no slaves", 5, nil, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := partitionClients(tt.total, tt.weights)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("partitionClients(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package master
+
+import (
+	"mqttbench/internal/models"
+	"mqttbench/internal/payload"
+)
+
+// NewPayloadConfig 根据slave记录构造消息生成配置，使用默认的json类型且填充内容为随机时返回nil
+func NewPayloadConfig(slave *models.Slave) *payload.Config {
+	if (slave.PayloadType == "" || slave.PayloadType == payload.TypeJSON) &&
+		(slave.PayloadContent == "" || slave.PayloadContent == payload.ContentRandom) {
+		return nil
+	}
+	return &payload.Config{
+		Type:     slave.PayloadType,
+		Content:  slave.PayloadContent,
+		Template: slave.PayloadTemplate,
+		Samples:  slave.PayloadSamples,
+	}
+}
@@ -0,0 +1,42 @@
+package master
+
+import (
+	"fmt"
+	"math"
+
+	"mqttbench/internal/broker"
+	"mqttbench/internal/models"
+)
+
+// NewMQTT5Config 根据slave记录构造MQTT 5.0连接参数，未使用MQTT 5.0时返回nil
+func NewMQTT5Config(slave *models.Slave) *broker.MQTT5Config {
+	if slave.ProtocolVersion != broker.ProtocolMQTT5 {
+		return nil
+	}
+	return &broker.MQTT5Config{
+		SessionExpiry:     uint32(slave.SessionExpiry),
+		ReceiveMaximum:    uint16(slave.ReceiveMaximum),
+		TopicAliasMaximum: uint16(slave.TopicAliasMaximum),
+		TopicAlias:        slave.TopicAlias,
+		UserProperties:    slave.UserProperties,
+	}
+}
+
+// ValidateProtocolConfig 校验slave记录中的协议版本和MQTT 5.0参数
+func ValidateProtocolConfig(slave *models.Slave) error {
+	if err := broker.ValidateProtocolVersion(slave.ProtocolVersion); err != nil {
+		return err
+	}
+
+	// 记录中的参数为int，超出协议字段范围时无法转换
+	switch {
+	case slave.SessionExpiry < 0 || slave.SessionExpiry > math.MaxUint32:
+		return fmt.Errorf("invalid session expiry: %d", slave.SessionExpiry)
+	case slave.ReceiveMaximum < 0 || slave.ReceiveMaximum > math.MaxUint16:
+		return fmt.Errorf("invalid receive maximum: %d", slave.ReceiveMaximum)
+	case slave.TopicAliasMaximum < 0 || slave.TopicAliasMaximum > math.MaxUint16:
+		return fmt.Errorf("invalid topic alias maximum: %d", slave.TopicAliasMaximum)
+	}
+
+	return (&broker.MQTT5Config{UserProperties: slave.UserProperties}).Validate()
+}
@@ -0,0 +1,83 @@
+package master
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"mqttbench/internal/models"
+	"mqttbench/internal/ramp"
+)
+
+// RampProgress slave上报的建连进度及master收到进度的时间
+type RampProgress struct {
+	ramp.Progress
+	UpdatedAt time.Time `json:"updated_at"` // master收到进度的时间
+}
+
+// NewRampConfig 根据slave记录构造建连策略，未设置策略时返回nil
+func NewRampConfig(slave *models.Slave) *ramp.Config {
+	if slave.RampStrategy == "" || slave.RampStrategy == ramp.Immediate {
+		return nil
+	}
+	return &ramp.Config{
+		Strategy:   slave.RampStrategy,
+		Rate:       slave.RampRate,
+		Duration:   slave.RampDuration,
+		BatchSize:  slave.RampBatchSize,
+		BatchPause: slave.RampBatchPause,
+	}
+}
+
+// handleRampProgress 处理slave上报的建连进度
+func (s *Server) handleRampProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析建连进度数据
+	var progress ramp.Progress
+	if err := json.NewDecoder(r.Body).Decode(&progress); err != nil {
+		log.Printf("Error decoding ramp progress data: %v", err)
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// 验证数据
+	if progress.SlaveID == 0 {
+		http.Error(w, "Invalid ramp progress data", http.StatusBadRequest)
+		return
+	}
+
+	s.saveRampProgress(progress)
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Ramp progress received"))
+}
+
+// saveRampProgress 保存slave最近一次上报的建连进度
+func (s *Server) saveRampProgress(progress ramp.Progress) {
+	if progress.Done {
+		log.Printf("Slave %d finished ramp-up (%s): connected=%d, failed=%d, target=%d, elapsed=%.1fs, aborted=%v",
+			progress.SlaveID, progress.Strategy, progress.Connected, progress.Failed, progress.Target, progress.Elapsed, progress.Aborted)
+	}
+
+	s.rampMutex.Lock()
+	defer s.rampMutex.Unlock()
+	s.rampProgress[int64(progress.SlaveID)] = &RampProgress{Progress: progress, UpdatedAt: time.Now()}
+}
+
+// GetRampProgress 获取slave最近一次上报的建连进度，未上报过时返回nil
+func (s *Server) GetRampProgress(slaveID int64) *RampProgress {
+	s.rampMutex.RLock()
+	defer s.rampMutex.RUnlock()
+
+	if progress, ok := s.rampProgress[slaveID]; ok {
+		copied := *progress
+		return &copied
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package master
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"mqttbench/internal/models"
+)
+
+// 指标采样保留时间和清理间隔
+const (
+	metricRetention     = 24 * time.Hour
+	metricPruneInterval = time.Hour
+)
+
+// handleMetricSample 处理slave推送的周期性指标采样
+func (s *Server) handleMetricSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析指标采样数据
+	var sample models.MetricSample
+	if err := json.NewDecoder(r.Body).Decode(&sample); err != nil {
+		log.Printf("Error decoding metric sample data: %v", err)
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// 验证数据
+	if sample.SlaveID == 0 {
+		http.Error(w, "Invalid metric sample data", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.saveMetricSample(&sample); err != nil {
+		log.Printf("Error saving metric sample from slave %d: %v", sample.SlaveID, err)
+		http.Error(w, "Failed to save metric sample", http.StatusInternalServerError)
+		return
+	}
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Metric sample received"))
+}
+
+// saveMetricSample 保存slave推送的指标采样，使用master的接收时间（UTC）作为采样时间，
+// 避免各slave时钟偏差和时区不同导致曲线错位
+func (s *Server) saveMetricSample(sample *models.MetricSample) error {
+	sample.ID = 0
+	sample.Timestamp = time.Now().UTC()
+
+	sampleGorm := &models.MetricSampleGorm{}
+	return sampleGorm.Insert(s.db, sample)
+}
+
+// GetMetricSamples 获取指定slave最近window时间内的指标采样，slaveID为0时返回所有slave的采样
+func (s *Server) GetMetricSamples(slaveID int64, window time.Duration) ([]*models.MetricSample, error) {
+	sampleGorm := &models.MetricSampleGorm{}
+	return sampleGorm.GetSince(s.db, slaveID, time.Now().UTC().Add(-window))
+}
+
+// pruneMetricSamples 定期删除超过保留时间的指标采样
+func (s *Server) pruneMetricSamples() {
+	ticker := time.NewTicker(metricPruneInterval)
+	defer ticker.Stop()
+
+	sampleGorm := &models.MetricSampleGorm{}
+	for range ticker.C {
+		if err := sampleGorm.DeleteBefore(s.db, time.Now().UTC().Add(-metricRetention)); err != nil {
+			log.Printf("Error pruning metric samples: %v", err)
+		}
+	}
+}
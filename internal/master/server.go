@@ -3,15 +3,29 @@ package master
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"mqttbench/internal/ack"
+	"mqttbench/internal/broker"
+	"mqttbench/internal/chaos"
+	"mqttbench/internal/credentials"
 	"mqttbench/internal/db"
+	"mqttbench/internal/diagnostics"
+	"mqttbench/internal/messagetest"
+	"mqttbench/internal/metrics"
 	"mqttbench/internal/models"
+	"mqttbench/internal/payload"
+	"mqttbench/internal/ramp"
+	"mqttbench/internal/topic"
+	"mqttbench/internal/workload"
 
 	"gorm.io/gorm"
 )
@@ -33,13 +47,91 @@ type HeartbeatData struct {
 type ConfigData struct {
 	MqttHost string `json:"mqtt_host"`
 	MqttPort int    `json:"mqtt_port"`
-	Topic    string `json:"topic"`
+	Topic    string `json:"topic"` // 订阅主题模板，未设置订阅列表时订阅该主题
 	QoS      int    `json:"qos"`
 	ClientID string `json:"client_id"`
 	Start    int    `json:"start"`
 	Step     int    `json:"step"`
 	Command  string `json:"command"`   // 添加命令字段
-	AckTopic string `json:"ack_topic"` // ACK主题配置
+	AckTopic string `json:"ack_topic"` // ACK主题模板，为空时为EEW/ACK/Channel1
+
+	Ack *ack.Config `json:"ack,omitempty"` // ACK回复方式，为空时按EEW协议回复
+
+	Subscriptions  []topic.Subscription `json:"subscriptions,omitempty"` // 每个客户端的订阅列表，为空时订阅Topic
+	TopicGroupSize int                  `json:"topic_group_size"`        // {{group}}占位符的分组大小
+	Will           *topic.WillConfig    `json:"will,omitempty"`          // 遗嘱消息，为空时不设置
+
+	ProtocolVersion int                 `json:"protocol_version"` // MQTT协议版本：3/4/5，为0时使用3.1.1
+	MQTT5           *broker.MQTT5Config `json:"mqtt5,omitempty"`  // MQTT 5.0连接参数
+	TLS             *broker.TLSConfig   `json:"tls,omitempty"`    // TLS配置，为空时使用明文TCP连接
+
+	// 传输方式：tcp/ssl/ws/wss，为空时按是否启用TLS选择tcp或ssl
+	Transport string                  `json:"transport"`
+	WebSocket *broker.WebSocketConfig `json:"websocket,omitempty"` // WebSocket路径和请求头，仅用于ws/wss
+
+	Credentials *credentials.Config `json:"credentials,omitempty"` // 认证方式，为空时用户名和密码均为客户端ID
+
+	// broker集群的节点列表，为空时连接MqttHost:MqttPort
+	Brokers      []broker.Node `json:"brokers,omitempty"`
+	BrokerPolicy string        `json:"broker_policy"` // 客户端分配到节点的方式：round_robin/random/weighted/hash，为空时为round_robin
+
+	// 本地源地址，每项为IP或CIDR，客户端按序号轮流绑定；为空时由系统选择源地址
+	SourceIPs []string `json:"source_ips,omitempty"`
+
+	// 发布模式配置
+	Mode        string  `json:"mode"`         // 客户端模式：subscribe/publish/both/connect，为空时为subscribe
+	PubTopic    string  `json:"pub_topic"`    // 发布主题，为空时使用Topic
+	PubRate     float64 `json:"pub_rate"`     // 每个客户端每秒发布的消息数
+	PayloadSize int     `json:"payload_size"` // 发布消息的大小（字节）
+	PubQoS      int     `json:"pub_qos"`      // 发布消息的QoS
+
+	Payload *payload.Config `json:"payload,omitempty"` // 消息生成方式，为空时为嵌入发送时间和序号的JSON消息
+
+	Ramp *ramp.Config `json:"ramp,omitempty"` // 建连策略，为空时同时建立所有连接
+
+	MessageTest *messagetest.Spec `json:"message_test,omitempty"` // 消息测试参数，仅用于message_test命令
+
+	Chaos *chaos.Action `json:"chaos,omitempty"` // 故障注入参数，仅用于chaos命令
+}
+
+// NewConfigData 根据slave记录构造下发的配置数据
+func NewConfigData(slave *models.Slave) ConfigData {
+	return ConfigData{
+		MqttHost:    slave.MqttHost,
+		MqttPort:    slave.MqttPort,
+		Topic:       slave.Topic,
+		QoS:         slave.QoS,
+		ClientID:    slave.ClientID,
+		Start:       slave.Start,
+		Step:        slave.Step,
+		AckTopic:    slave.AckTopic, // 使用配置的ACK主题，如果为空则使用默认值
+		Ack:         NewAckConfig(slave),
+		Mode:        slave.Mode,
+		PubTopic:    slave.PubTopic,
+		PubRate:     slave.PubRate,
+		PayloadSize: slave.PayloadSize,
+		PubQoS:      slave.PubQoS,
+		Payload:     NewPayloadConfig(slave),
+		Ramp:        NewRampConfig(slave),
+
+		ProtocolVersion: slave.ProtocolVersion,
+		MQTT5:           NewMQTT5Config(slave),
+		TLS:             NewTLSConfig(slave),
+
+		Transport: slave.Transport,
+		WebSocket: NewWebSocketConfig(slave),
+
+		Credentials: NewCredentialConfig(slave),
+
+		Subscriptions:  NewSubscriptions(slave),
+		TopicGroupSize: slave.TopicGroupSize,
+		Will:           NewWillConfig(slave),
+
+		Brokers:      NewBrokerNodes(slave),
+		BrokerPolicy: slave.BrokerPolicy,
+
+		SourceIPs: slave.SourceIPs,
+	}
 }
 
 // ConfigResult 配置结果数据结构
@@ -49,16 +141,56 @@ type ConfigResult struct {
 	FailureCount int    `json:"failure_count"`
 	Connections  int    `json:"connections"` // 添加连接数字段
 	Message      string `json:"message"`
+
+	PublishCount        int64 `json:"publish_count"`         // 发布成功的消息数
+	PublishFailureCount int64 `json:"publish_failure_count"` // 发布失败的消息数
+	PublishSkippedCount int64 `json:"publish_skipped_count"` // 因等待确认的消息过多而跳过的发布次数
+	ReceivedCount       int64 `json:"received_count"`        // 接收到的消息数
+	AckCount            int64 `json:"ack_count"`             // 发布成功的ACK消息数
+	Stopped             bool  `json:"stopped"`               // 是否为停止后的最终结果
+
+	Latency *metrics.LatencyStats `json:"latency,omitempty"` // 本次运行的端到端延迟统计
+
+	ReasonCodes []broker.ReasonCodeCount `json:"reason_codes,omitempty"` // 本次运行中broker返回的各原因码次数
+
+	TLSHandshake         *metrics.LatencyStats `json:"tls_handshake,omitempty"` // 本次运行的TLS握手耗时统计，不包含TCP建连和MQTT CONNECT
+	TLSHandshakeFailures int64                 `json:"tls_handshake_failures"`  // 本次运行TLS握手失败的次数
+
+	Sequence *metrics.SequenceStats `json:"sequence,omitempty"` // 本次运行的消息丢失、重复和乱序统计
+
+	Sources []broker.SourceStats `json:"sources,omitempty"` // 各本地源地址的连接数和失败数，未指定源地址时为空
+
+	Brokers []broker.Stats `json:"brokers,omitempty"` // 各broker节点的连接数、失败数和收发消息数
+
+	Failures []diagnostics.FailureCount `json:"failures,omitempty"` // 本次运行按原因统计的连接失败数和订阅失败数
 }
 
+// errSlaveNotFound slave未注册
+var errSlaveNotFound = errors.New("slave not found")
+
 // Server master服务器结构
 type Server struct {
 	slaveModel *models.SlaveModel
 	db         *gorm.DB
 	server     *http.Server
+	addr       string // HTTP监听地址，默认为:8888
 	// 用于存储配置下发的结果
 	configResults map[int]*ConfigResult
 	resultsMutex  sync.RWMutex
+	// slave主动建立的控制通道
+	controlConns map[int64]*controlConn
+	controlMutex sync.RWMutex
+	// slave最近一次上报的建连进度
+	rampProgress map[int64]*RampProgress
+	rampMutex    sync.RWMutex
+	// slave上报的故障注入进度，每个slave保留最近的若干次
+	chaosReports map[int64][]*ChaosReport
+	chaosMutex   sync.RWMutex
+	// 正在等待结果的消息测试，测试ID -> slave ID -> 是否已保存结果
+	messageTestReports map[int64]map[int64]bool
+	messageTestMutex   sync.Mutex
+	// 命令ID序号
+	commandSeq atomic.Uint64
 }
 
 // NewServer 创建新的master服务器实例
@@ -67,41 +199,70 @@ func NewServer() *Server {
 		slaveModel:    &models.SlaveModel{DB: db.DB},
 		db:            db.DB,
 		configResults: make(map[int]*ConfigResult),
+		controlConns:  make(map[int64]*controlConn),
+		rampProgress:  make(map[int64]*RampProgress),
+		chaosReports:  make(map[int64][]*ChaosReport),
+		addr:          ":8888",
+
+		messageTestReports: make(map[int64]map[int64]bool),
 	}
 }
 
-// Start 启动master服务器
-func (s *Server) Start(ctx context.Context) {
+// SetListenAddr 设置HTTP监听地址，需要在Start之前调用
+func (s *Server) SetListenAddr(addr string) {
+	s.addr = addr
+}
+
+// Start 启动master服务器，监听地址无法绑定时返回错误
+func (s *Server) Start(ctx context.Context) error {
 	// 创建HTTP服务器
 	mux := http.NewServeMux()
 	mux.HandleFunc("/register", s.handleRegistration)
 	mux.HandleFunc("/heartbeat", s.handleHeartbeat)
 	mux.HandleFunc("/config-result", s.handleConfigResult)
+	mux.HandleFunc("/message-test-result", s.handleMessageTestResult)
+	mux.HandleFunc("/metric-sample", s.handleMetricSample)
+	mux.HandleFunc("/ramp-progress", s.handleRampProgress)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/control", s.handleControl)
+	mux.HandleFunc("/clients", s.handleClients)
+	mux.HandleFunc("/chaos", s.handleChaos)
+	mux.HandleFunc("/chaos-report", s.handleChaosReport)
 
 	s.server = &http.Server{
-		Addr:    ":8888",
+		Addr:    s.addr,
 		Handler: mux,
 	}
 
+	// 同步绑定监听地址，以便地址被占用时立即返回错误
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.addr, err)
+	}
+
 	// 在后台启动服务器
 	go func() {
-		log.Println("Master server starting on port 8888")
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Master server starting on %s", s.addr)
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Printf("Master server error: %v", err)
 		}
+	}()
 
-		// 监听上下文取消信号，用于优雅关闭服务器
+	// 监听上下文取消信号，用于优雅关闭服务器
+	go func() {
 		<-ctx.Done()
 		log.Println("Shutting down master server...")
-		if s.server != nil {
-			s.server.Close()
-		}
+		s.server.Close()
 	}()
 
 	// 启动定期检查slave状态的goroutine
 	go s.checkSlaveStatus()
 
+	// 启动定期清理指标采样的goroutine
+	go s.pruneMetricSamples()
+
 	log.Println("Master server started")
+	return nil
 }
 
 // checkSlaveStatus 定期检查slave状态
@@ -216,6 +377,20 @@ func (s *Server) handleRegistration(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Received registration request from Slave %d at %s:%d", regData.SlaveID, regData.IP, regData.Port)
 
+	if err := s.registerSlave(regData); err != nil {
+		log.Printf("Error registering slave %d: %v", regData.SlaveID, err)
+		http.Error(w, "Failed to save slave data", http.StatusInternalServerError)
+		return
+	}
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Registration successful"))
+	log.Printf("Slave %d registered successfully from %s:%d", regData.SlaveID, regData.IP, regData.Port)
+}
+
+// registerSlave 保存slave注册信息，已存在的slave更新地址和状态，否则创建新记录
+func (s *Server) registerSlave(regData RegistrationData) error {
 	// 检查数据库连接是否正常
 	if s.db == nil {
 		log.Println("Database connection is nil, trying to reinitialize")
@@ -227,9 +402,7 @@ func (s *Server) handleRegistration(w http.ResponseWriter, r *http.Request) {
 	// 检查slave是否已存在
 	existingSlave, err := s.slaveModel.GetByID(int64(regData.SlaveID))
 	if err != nil {
-		log.Printf("Error checking existing slave: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("error checking existing slave: %v", err)
 	}
 
 	if existingSlave != nil {
@@ -237,19 +410,6 @@ func (s *Server) handleRegistration(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Updating existing slave %d", regData.SlaveID)
 		log.Printf("Registration data: IP=%s, Port=%d", regData.IP, regData.Port)
 
-		// 验证注册数据是否有效
-		if regData.IP == "" {
-			log.Printf("ERROR: Registration IP is empty for slave %d", regData.SlaveID)
-			http.Error(w, "Invalid registration data: IP is empty", http.StatusBadRequest)
-			return
-		}
-
-		if regData.Port <= 0 {
-			log.Printf("ERROR: Registration Port is invalid (%d) for slave %d", regData.Port, regData.SlaveID)
-			http.Error(w, "Invalid registration data: Port is invalid", http.StatusBadRequest)
-			return
-		}
-
 		// 更新slave信息
 		// SlaveHost和SlavePort存储slave自身的地址信息（来自注册数据）
 		existingSlave.SlaveHost = regData.IP
@@ -271,28 +431,13 @@ func (s *Server) handleRegistration(w http.ResponseWriter, r *http.Request) {
 
 		err = s.slaveModel.UpdateWithoutConnections(existingSlave)
 		if err != nil {
-			log.Printf("Error updating existing slave: %v", err)
-			http.Error(w, "Failed to update slave data", http.StatusInternalServerError)
-			return
+			return fmt.Errorf("error updating existing slave: %v", err)
 		}
 	} else {
 		// 创建新slave
 		log.Printf("Creating new slave %d", regData.SlaveID)
 		log.Printf("Registration data: IP=%s, Port=%d", regData.IP, regData.Port)
 
-		// 验证注册数据是否有效
-		if regData.IP == "" {
-			log.Printf("ERROR: Registration IP is empty for new slave %d", regData.SlaveID)
-			http.Error(w, "Invalid registration data: IP is empty", http.StatusBadRequest)
-			return
-		}
-
-		if regData.Port <= 0 {
-			log.Printf("ERROR: Registration Port is invalid (%d) for new slave %d", regData.Port, regData.SlaveID)
-			http.Error(w, "Invalid registration data: Port is invalid", http.StatusBadRequest)
-			return
-		}
-
 		slave := &models.Slave{
 			ID:        int64(regData.SlaveID),
 			Name:      fmt.Sprintf("Slave-%d", regData.SlaveID),
@@ -308,16 +453,11 @@ func (s *Server) handleRegistration(w http.ResponseWriter, r *http.Request) {
 
 		err = s.slaveModel.Insert(slave)
 		if err != nil {
-			log.Printf("Error creating new slave: %v", err)
-			http.Error(w, "Failed to save slave data", http.StatusInternalServerError)
-			return
+			return fmt.Errorf("error creating new slave: %v", err)
 		}
 	}
 
-	// 返回成功响应
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Registration successful"))
-	log.Printf("Slave %d registered successfully from %s:%d", regData.SlaveID, regData.IP, regData.Port)
+	return nil
 }
 
 // handleHeartbeat 处理slave心跳包
@@ -342,6 +482,24 @@ func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.processHeartbeat(heartbeatData); err != nil {
+		log.Printf("Error processing heartbeat from slave %d: %v", heartbeatData.SlaveID, err)
+		if errors.Is(err, errSlaveNotFound) {
+			// 返回404错误，让slave知道需要重新注册
+			http.Error(w, "Slave not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to update slave", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Heartbeat received"))
+}
+
+// processHeartbeat 更新slave的时间戳和在线状态
+func (s *Server) processHeartbeat(heartbeatData HeartbeatData) error {
 	log.Printf("Received heartbeat from Slave %d at %s", heartbeatData.SlaveID, heartbeatData.Timestamp)
 
 	// 检查数据库连接是否正常
@@ -355,16 +513,11 @@ func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	// 更新slave时间戳和状态
 	slave, err := s.slaveModel.GetByID(int64(heartbeatData.SlaveID))
 	if err != nil {
-		log.Printf("Error getting slave for heartbeat: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("error getting slave for heartbeat: %v", err)
 	}
 
 	if slave == nil {
-		log.Printf("Slave %d not found for heartbeat", heartbeatData.SlaveID)
-		// 返回404错误，让slave知道需要重新注册
-		http.Error(w, "Slave not found", http.StatusNotFound)
-		return
+		return errSlaveNotFound
 	}
 
 	// 更新时间戳和状态，但保持创建时间不变
@@ -379,15 +532,11 @@ func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 
 	err = s.slaveModel.UpdateWithoutConnections(slave)
 	if err != nil {
-		log.Printf("Error updating slave for heartbeat: %v", err)
-		http.Error(w, "Failed to update slave", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("error updating slave for heartbeat: %v", err)
 	}
 
-	// 返回成功响应
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Heartbeat received"))
 	log.Printf("Heartbeat processed successfully for slave %d, status: %s, updated_at: %v", heartbeatData.SlaveID, slave.Status, slave.UpdatedAt)
+	return nil
 }
 
 // handleConfigResult 处理slave配置结果反馈
@@ -412,8 +561,45 @@ func (s *Server) handleConfigResult(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Received config result from Slave %d: Success=%d, Failure=%d, Connections=%d, Message=%s",
-		configResult.SlaveID, configResult.SuccessCount, configResult.FailureCount, configResult.Connections, configResult.Message)
+	s.processConfigResult(configResult)
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Config result received"))
+	log.Printf("Config result processed successfully for slave %d", configResult.SlaveID)
+}
+
+// processConfigResult 保存slave上报的配置结果并更新连接数和状态
+func (s *Server) processConfigResult(configResult ConfigResult) {
+	log.Printf("Received config result from Slave %d: Success=%d, Failure=%d, Connections=%d, Published=%d, PublishFailed=%d, Message=%s",
+		configResult.SlaveID, configResult.SuccessCount, configResult.FailureCount, configResult.Connections,
+		configResult.PublishCount, configResult.PublishFailureCount, configResult.Message)
+
+	if configResult.Latency != nil {
+		log.Printf("Latency from Slave %d: count=%d, p50=%.3fms, p90=%.3fms, p99=%.3fms, p99.9=%.3fms, max=%.3fms",
+			configResult.SlaveID, configResult.Latency.Count, configResult.Latency.P50, configResult.Latency.P90,
+			configResult.Latency.P99, configResult.Latency.P999, configResult.Latency.Max)
+	}
+
+	if sequence := configResult.Sequence; sequence != nil {
+		log.Printf("Sequence check from Slave %d: streams=%d, lost=%d, duplicates=%d, out_of_order=%d, gaps=%d",
+			configResult.SlaveID, sequence.Streams, sequence.Lost, sequence.Duplicates, sequence.OutOfOrder, sequence.Gaps)
+	}
+
+	for _, broker := range configResult.Brokers {
+		log.Printf("Broker %s from Slave %d: connected=%d, failed=%d, published=%d, received=%d",
+			broker.Broker, configResult.SlaveID, broker.Connected, broker.Failed, broker.Published, broker.Received)
+	}
+
+	for _, source := range configResult.Sources {
+		log.Printf("Source %s from Slave %d: connected=%d, failed=%d",
+			source.SourceIP, configResult.SlaveID, source.Connected, source.Failed)
+	}
+
+	for _, failure := range configResult.Failures {
+		log.Printf("Failure %s (%s) from Slave %d: count=%d",
+			failure.Reason, failure.Category, configResult.SlaveID, failure.Count)
+	}
 
 	// 存储配置结果
 	s.resultsMutex.Lock()
@@ -440,11 +626,120 @@ func (s *Server) handleConfigResult(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Slave %d connections updated to %d", configResult.SlaveID, configResult.Connections)
 		}
 	}
+}
+
+// handleMessageTestResult 处理slave上报的消息测试结果
+func (s *Server) handleMessageTestResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析消息测试结果数据
+	var report messagetest.Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		log.Printf("Error decoding message test result data: %v", err)
+		http.Error(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// 验证数据
+	if report.SlaveID <= 0 || report.TestID <= 0 {
+		log.Printf("Invalid message test result data: SlaveID=%d, TestID=%d", report.SlaveID, report.TestID)
+		http.Error(w, "Invalid message test result data", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.saveMessageTestReport(report); err != nil {
+		log.Printf("Error saving message test result from slave %d: %v", report.SlaveID, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUnexpectedMessageTestReport) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
 
 	// 返回成功响应
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Config result received"))
-	log.Printf("Config result processed successfully for slave %d", configResult.SlaveID)
+	w.Write([]byte("Message test result received"))
+}
+
+// errUnexpectedMessageTestReport 收到的消息测试结果不属于正在等待结果的测试，或该slave已经上报过
+var errUnexpectedMessageTestReport = errors.New("unexpected message test report")
+
+// ExpectMessageTestReports 开始等待slaves上报消息测试testID的结果，只接受这些slave的第一次上报
+func (s *Server) ExpectMessageTestReports(testID int64, slaveIDs []int64) {
+	s.messageTestMutex.Lock()
+	defer s.messageTestMutex.Unlock()
+
+	reported := make(map[int64]bool, len(slaveIDs))
+	for _, slaveID := range slaveIDs {
+		reported[slaveID] = false
+	}
+	s.messageTestReports[testID] = reported
+}
+
+// MessageTestReported 判断slave的消息测试结果是否已全部保存
+func (s *Server) MessageTestReported(testID int64, slaveID int64) bool {
+	s.messageTestMutex.Lock()
+	defer s.messageTestMutex.Unlock()
+
+	return s.messageTestReports[testID][slaveID]
+}
+
+// EndMessageTestReports 停止等待消息测试testID的结果，返回没有上报结果的slave，之后收到的结果被拒绝
+func (s *Server) EndMessageTestReports(testID int64) []int64 {
+	s.messageTestMutex.Lock()
+	defer s.messageTestMutex.Unlock()
+
+	var missing []int64
+	for slaveID, reported := range s.messageTestReports[testID] {
+		if !reported {
+			missing = append(missing, slaveID)
+		}
+	}
+	delete(s.messageTestReports, testID)
+	slices.Sort(missing)
+	return missing
+}
+
+// saveMessageTestReport 在一个事务中保存slave上报的消息测试结果，保存完成后才计为该slave已上报
+func (s *Server) saveMessageTestReport(report messagetest.Report) error {
+	log.Printf("Received message test result from Slave %d for test %d: %d cases", report.SlaveID, report.TestID, len(report.Results))
+
+	s.messageTestMutex.Lock()
+	defer s.messageTestMutex.Unlock()
+
+	slaveID := int64(report.SlaveID)
+	reported, ok := s.messageTestReports[report.TestID][slaveID]
+	if !ok || reported {
+		return fmt.Errorf("%w: test %d, slave %d", errUnexpectedMessageTestReport, report.TestID, slaveID)
+	}
+
+	// 保存每个用例的结果
+	resultGorm := &models.MessageTestResultGorm{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, caseResult := range report.Results {
+			testResult := &models.MessageTestResult{
+				MessageID: report.TestID,
+				SlaveID:   slaveID,
+				Case:      caseResult.Case,
+				Passed:    caseResult.Passed,
+				Evidence:  caseResult.Evidence,
+			}
+			if err := resultGorm.Insert(tx, testResult); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.messageTestReports[report.TestID][slaveID] = true
+	return nil
 }
 
 // deployConfigToSlave 向单个slave下发配置
@@ -460,33 +755,70 @@ func (s *Server) deployConfigToSlave(slaveID int64) error {
 	}
 
 	// 构造配置数据
-	configData := ConfigData{
-		MqttHost: slave.MqttHost,
-		MqttPort: slave.MqttPort,
-		Topic:    slave.Topic,
-		QoS:      slave.QoS,
-		ClientID: slave.ClientID,
-		Start:    slave.Start,
-		Step:     slave.Step,
-		AckTopic: slave.AckTopic, // 使用配置的ACK主题，如果为空则使用默认值
-	}
+	configData := NewConfigData(slave)
 
 	// 添加调试日志，查看下发的配置数据
-	log.Printf("下发配置数据到Slave %d: ClientID=%s, Start=%d, Step=%d", slaveID, slave.ClientID, slave.Start, slave.Step)
+	log.Printf("下发配置数据到Slave %d: ClientID=%s, Start=%d, Step=%d, Mode=%s", slaveID, slave.ClientID, slave.Start, slave.Step, slave.Mode)
 
+	if err := s.sendConfig(slave, configData); err != nil {
+		return err
+	}
+
+	log.Printf("Config deployed successfully to slave %d at %s:%d", slaveID, slave.SlaveHost, slave.SlavePort)
+	return nil
+}
+
+// sendConfig 向slave发送配置消息并等待slave确认，优先使用slave建立的控制通道，未连接时回退到TCP直连。
+// slave拒绝执行时返回*CommandError，无法送达或超时未回复时返回其他错误
+func (s *Server) sendConfig(slave *models.Slave, configData ConfigData) error {
+	reply, err := s.sendCommand(slave, "config", configData)
+	if err != nil {
+		return err
+	}
+	return commandReplyError(slave.ID, configData.Command, reply)
+}
+
+// sendCommand 向slave发送带ID的命令并返回slave的回复，优先使用slave建立的控制通道，未连接时回退到TCP直连
+func (s *Server) sendCommand(slave *models.Slave, msgType string, content interface{}) (controlMessage, error) {
+	id := s.commandSeq.Add(1)
+
+	var reply controlMessage
+	var err error
+	if cc := s.getControlConn(slave.ID); cc != nil {
+		reply, err = cc.request(msgType, id, content, commandTimeout)
+		if err != nil {
+			return controlMessage{}, fmt.Errorf("failed to send %s to slave %d over control channel: %v", msgType, slave.ID, err)
+		}
+	} else {
+		reply, err = s.sendCommandTCP(slave, msgType, id, content)
+		if err != nil {
+			return controlMessage{}, err
+		}
+	}
+
+	if reply.ID != id {
+		return controlMessage{}, fmt.Errorf("slave %d replied to command %d, expected %d", slave.ID, reply.ID, id)
+	}
+	return reply, nil
+}
+
+// sendCommandTCP 通过TCP连接向slave发送命令，并在同一连接上读取slave的回复
+func (s *Server) sendCommandTCP(slave *models.Slave, msgType string, id uint64, content interface{}) (controlMessage, error) {
 	// 构造消息结构
 	message := struct {
-		Type    string     `json:"type"`
-		Content ConfigData `json:"content"`
+		Type    string      `json:"type"`
+		ID      uint64      `json:"id"`
+		Content interface{} `json:"content"`
 	}{
-		Type:    "config",
-		Content: configData,
+		Type:    msgType,
+		ID:      id,
+		Content: content,
 	}
 
 	// 将消息序列化为JSON
 	data, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config data: %v", err)
+		return controlMessage{}, fmt.Errorf("failed to marshal %s message: %v", msgType, err)
 	}
 
 	// 构造slave的配置URL，使用net.JoinHostPort来正确处理IPv4和IPv6地址
@@ -495,14 +827,14 @@ func (s *Server) deployConfigToSlave(slaveID int64) error {
 	// 创建TCP连接
 	conn, err := net.DialTimeout("tcp", configURL, 10*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to connect to slave %d at %s: %v", slaveID, configURL, err)
+		return controlMessage{}, fmt.Errorf("failed to connect to slave %d at %s: %v", slave.ID, configURL, err)
 	}
 	defer conn.Close()
 
 	// 发送JSON数据并在末尾添加换行符
 	_, err = conn.Write(append(data, '\n'))
 	if err != nil {
-		return fmt.Errorf("failed to send config to slave %d: %v", slaveID, err)
+		return controlMessage{}, fmt.Errorf("failed to send %s to slave %d: %v", msgType, slave.ID, err)
 	}
 
 	// 确保数据被刷新到网络
@@ -510,25 +842,155 @@ func (s *Server) deployConfigToSlave(slaveID int64) error {
 		tcpConn.CloseWrite()
 	}
 
-	// 等待更长时间确保数据被接收和处理
-	time.Sleep(500 * time.Millisecond)
+	// 等待slave回复
+	conn.SetReadDeadline(time.Now().Add(commandTimeout))
+	var reply controlMessage
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		return controlMessage{}, fmt.Errorf("no reply from slave %d: %v", slave.ID, err)
+	}
+
+	return reply, nil
+}
+
+// StartSlave 使用slave记录中的配置向slave发送启动命令
+func (s *Server) StartSlave(slaveID int64) error {
+	// 首先获取slave信息
+	slave, err := s.slaveModel.GetByID(slaveID)
+	if err != nil {
+		return err
+	}
+
+	if slave == nil {
+		return fmt.Errorf("slave %d not found", slaveID)
+	}
+
+	return s.StartSlaveWithConfig(slave, NewConfigData(slave))
+}
+
+// StartSlaveWithConfig 使用指定的配置向slave发送启动命令，并更新slave状态
+func (s *Server) StartSlaveWithConfig(slave *models.Slave, configData ConfigData) error {
+	configData.Command = "start" // 添加启动命令
+
+	log.Printf("Sending start command to slave %d: %+v", slave.ID, configData)
+
+	if err := s.sendConfig(slave, configData); err != nil {
+		// slave拒绝执行时保持原状态，无法送达时更新slave状态为离线
+		var commandErr *CommandError
+		if !errors.As(err, &commandErr) {
+			slave.Status = "offline"
+			updateErr := s.slaveModel.UpdateWithoutConnections(slave)
+			if updateErr != nil {
+				log.Printf("Failed to update slave status to offline: %v", updateErr)
+			}
+		}
+		return err
+	}
 
-	log.Printf("Config deployed successfully to slave %d at %s", slaveID, configURL)
+	// 更新slave状态为运行中
+	slave.Status = "running"
+	updateErr := s.slaveModel.UpdateWithoutConnections(slave)
+	if updateErr != nil {
+		log.Printf("Failed to update slave status to running: %v", updateErr)
+	}
+
+	log.Printf("Start command deployed successfully to slave %d at %s:%d", slave.ID, slave.SlaveHost, slave.SlavePort)
 	return nil
 }
 
-// DeployConfigToSlaves 下发配置到指定的Slaves
-func (s *Server) DeployConfigToSlaves(slaveIDs []int64) error {
-	for _, slaveID := range slaveIDs {
-		err := s.deployConfigToSlave(slaveID)
-		if err != nil {
-			log.Printf("Failed to deploy config to slave %d: %v", slaveID, err)
-			// 继续处理其他slave，不中断整个过程
+// SetPublishRate 向slave发送发布命令，按configData中的发布参数调整所有已连接客户端的发布，
+// PubRate为0时停止发布
+func (s *Server) SetPublishRate(slave *models.Slave, configData ConfigData) error {
+	if err := workload.ValidatePublishRate(configData.PubRate, true); err != nil {
+		return err
+	}
+	configData.Command = "publish"
+
+	log.Printf("Sending publish command to slave %d: rate=%v, size=%d, qos=%d", slave.ID, configData.PubRate, configData.PayloadSize, configData.PubQoS)
+	return s.sendConfig(slave, configData)
+}
+
+// SendMessageTest 向slave发送消息测试命令，slave使用自身的MQTT配置执行测试并异步上报结果
+func (s *Server) SendMessageTest(slaveID int64, spec messagetest.Spec) error {
+	slave, err := s.slaveModel.GetByID(slaveID)
+	if err != nil {
+		return err
+	}
+
+	if slave == nil {
+		return fmt.Errorf("slave %d not found", slaveID)
+	}
+
+	configData := NewConfigData(slave)
+	configData.Command = "message_test"
+	configData.MessageTest = &spec
+
+	log.Printf("Sending message test %d to slave %d", spec.TestID, slaveID)
+	return s.sendConfig(slave, configData)
+}
+
+// StopSlave 向slave发送停止命令，停止成功或无法送达时将slave状态更新为离线
+func (s *Server) StopSlave(slaveID int64) error {
+	log.Printf("StopSlave方法被调用，slaveID: %d", slaveID)
+	// 首先获取slave信息
+	slave, err := s.slaveModel.GetByID(slaveID)
+	if err != nil {
+		log.Printf("获取slave信息失败: %v", err)
+		return err
+	}
+
+	if slave == nil {
+		log.Printf("未找到slave %d", slaveID)
+		return fmt.Errorf("slave %d not found", slaveID)
+	}
+
+	log.Printf("获取到slave信息: ID=%d, Name=%s, SlaveHost=%s, SlavePort=%d", slave.ID, slave.Name, slave.SlaveHost, slave.SlavePort)
+
+	// 构造带有停止命令的配置数据
+	err = s.sendConfig(slave, ConfigData{Command: "stop"})
+
+	// slave拒绝执行时保持原状态，停止成功或无法送达时更新slave状态为离线
+	var commandErr *CommandError
+	if err == nil || !errors.As(err, &commandErr) {
+		slave.Status = "offline"
+		slave.Connections = 0 // 将连接数归零
+		updateErr := s.slaveModel.UpdateWithoutConnections(slave)
+		if updateErr != nil {
+			log.Printf("更新slave状态为离线失败: %v", updateErr)
 		}
 	}
+
+	if err != nil {
+		log.Printf("发送停止命令到slave %d失败: %v", slaveID, err)
+		return err
+	}
+
+	log.Printf("停止命令成功部署到slave %d at %s:%d", slaveID, slave.SlaveHost, slave.SlavePort)
 	return nil
 }
 
+// DeployConfigToSlaves 并发下发配置到指定的Slaves，返回每个slave的执行结果
+func (s *Server) DeployConfigToSlaves(slaveIDs []int64) []CommandResult {
+	results := make([]CommandResult, len(slaveIDs))
+
+	var wg sync.WaitGroup
+	for i, slaveID := range slaveIDs {
+		wg.Add(1)
+		go func(i int, slaveID int64) {
+			defer wg.Done()
+
+			results[i] = CommandResult{SlaveID: slaveID, Success: true}
+			if err := s.deployConfigToSlave(slaveID); err != nil {
+				log.Printf("Failed to deploy config to slave %d: %v", slaveID, err)
+				results[i].Success = false
+				results[i].Error = err.Error()
+			}
+		}(i, slaveID)
+	}
+	wg.Wait()
+
+	return results
+}
+
 // GetSlaveModel 获取slave模型实例
 func (s *Server) GetSlaveModel() *models.SlaveModel {
 	return s.slaveModel
@@ -581,3 +1043,23 @@ func (s *Server) ClearConfigResult(slaveID int) {
 
 	delete(s.configResults, slaveID)
 }
+
+// GetFleetLatency 合并所有slave最近一次上报的延迟统计，得到整个集群的延迟分布
+func (s *Server) GetFleetLatency() *metrics.LatencyStats {
+	s.resultsMutex.RLock()
+	defer s.resultsMutex.RUnlock()
+
+	stats := make([]*metrics.LatencyStats, 0, len(s.configResults))
+	for _, result := range s.configResults {
+		if result.Latency != nil {
+			stats = append(stats, result.Latency)
+		}
+	}
+
+	if len(stats) == 0 {
+		return nil
+	}
+
+	merged := metrics.MergeLatencyStats(stats...)
+	return &merged
+}
@@ -0,0 +1,22 @@
+package master
+
+import (
+	"mqttbench/internal/broker"
+	"mqttbench/internal/models"
+)
+
+// NewTLSConfig 根据slave记录构造TLS配置，未启用TLS时返回nil
+func NewTLSConfig(slave *models.Slave) *broker.TLSConfig {
+	if !slave.TLSEnabled {
+		return nil
+	}
+	return &broker.TLSConfig{
+		Enabled:            true,
+		CACert:             slave.TLSCACert,
+		ClientCert:         slave.TLSClientCert,
+		ClientKey:          slave.TLSClientKey,
+		ServerName:         slave.TLSServerName,
+		MinVersion:         slave.TLSMinVersion,
+		InsecureSkipVerify: slave.TLSInsecureSkipVerify,
+	}
+}
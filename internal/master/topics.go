@@ -0,0 +1,44 @@
+package master
+
+import (
+	"mqttbench/internal/models"
+	"mqttbench/internal/topic"
+)
+
+// NewWillConfig 根据slave记录构造遗嘱消息，未设置主题时返回nil
+func NewWillConfig(slave *models.Slave) *topic.WillConfig {
+	if slave.WillTopic == "" {
+		return nil
+	}
+	return &topic.WillConfig{
+		Topic:   slave.WillTopic,
+		Payload: slave.WillPayload,
+		QoS:     slave.WillQoS,
+		Retain:  slave.WillRetain,
+	}
+}
+
+// NewSubscriptions 根据slave记录构造订阅列表，未设置时返回nil，客户端订阅Topic
+func NewSubscriptions(slave *models.Slave) []topic.Subscription {
+	if len(slave.Subscriptions) == 0 {
+		return nil
+	}
+	subscriptions := make([]topic.Subscription, len(slave.Subscriptions))
+	for i, subscription := range slave.Subscriptions {
+		subscriptions[i] = topic.Subscription{Topic: subscription.Topic, QoS: subscription.QoS}
+	}
+	return subscriptions
+}
+
+// ValidateTopics 校验slave的订阅、发布和遗嘱主题模板
+func ValidateTopics(slave *models.Slave) error {
+	templates := topic.Templates{
+		Topic:         slave.Topic,
+		QoS:           slave.QoS,
+		PubTopic:      slave.PubTopic,
+		Subscriptions: NewSubscriptions(slave),
+		Will:          NewWillConfig(slave),
+		GroupSize:     slave.TopicGroupSize,
+	}
+	return templates.Validate()
+}
@@ -0,0 +1,23 @@
+package master
+
+import (
+	"mqttbench/internal/broker"
+	"mqttbench/internal/models"
+)
+
+// NewWebSocketConfig 根据slave记录构造WebSocket参数，未使用WebSocket传输时返回nil
+func NewWebSocketConfig(slave *models.Slave) *broker.WebSocketConfig {
+	if slave.Transport != broker.TransportWS && slave.Transport != broker.TransportWSS {
+		return nil
+	}
+	return &broker.WebSocketConfig{
+		Path:    slave.WSPath,
+		Headers: slave.WSHeaders,
+	}
+}
+
+// ValidateTransport 校验slave记录中的传输方式，明文传输不能与TLS同时启用
+func ValidateTransport(slave *models.Slave) error {
+	webSocket := &broker.WebSocketConfig{Path: slave.WSPath, Headers: slave.WSHeaders}
+	return broker.ValidateTransport(slave.Transport, NewTLSConfig(slave), webSocket)
+}
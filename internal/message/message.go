@@ -1,19 +1,37 @@
 package message
 
 import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
 	"mqttbench/internal/db"
+	"mqttbench/internal/master"
+	"mqttbench/internal/messagetest"
 	"mqttbench/internal/models"
 )
 
+// 等待slave上报消息测试结果的时间
+const resultTimeout = 90 * time.Second
+
 // Service 消息测试服务
 type Service struct {
-	messageGorm *models.MessageGorm
+	messageGorm    *models.MessageGorm
+	testResultGorm *models.MessageTestResultGorm
+	masterServer   *master.Server
+	// 正在运行的测试
+	running      map[int64]bool
+	runningMutex sync.Mutex
 }
 
 // NewService 创建新的消息测试服务实例
-func NewService() *Service {
+func NewService(masterServer *master.Server) *Service {
 	return &Service{
-		messageGorm: &models.MessageGorm{},
+		messageGorm:    &models.MessageGorm{},
+		testResultGorm: &models.MessageTestResultGorm{},
+		masterServer:   masterServer,
+		running:        make(map[int64]bool),
 	}
 }
 
@@ -21,3 +39,191 @@ func NewService() *Service {
 func (s *Service) GetMessageTests() ([]*models.Message, error) {
 	return s.messageGorm.GetAll(db.DB)
 }
+
+// CreateMessageTest 创建消息测试记录
+func (s *Service) CreateMessageTest(payloadSize int, messageType string, retained bool, duplicate bool, qosLevel int) (*models.Message, error) {
+	if qosLevel < 0 || qosLevel > 2 {
+		return nil, fmt.Errorf("invalid qos level: %d", qosLevel)
+	}
+
+	switch messageType {
+	case "":
+		messageType = "json"
+	case "json", "text", "binary":
+	default:
+		return nil, fmt.Errorf("invalid message type: %s", messageType)
+	}
+
+	message := &models.Message{
+		PayloadSize: max(payloadSize, 0),
+		MessageType: messageType,
+		Retained:    retained,
+		Duplicate:   duplicate,
+		QoSLevel:    qosLevel,
+		Status:      models.MessageStatusPending,
+	}
+
+	if err := s.messageGorm.Insert(db.DB, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// RunMessageTest 在指定的slave上运行消息测试，测试在后台执行，结果写入message_test_results表
+func (s *Service) RunMessageTest(id int64, slaveIDs []int64) error {
+	if len(slaveIDs) == 0 {
+		return fmt.Errorf("no slaves selected")
+	}
+
+	message, err := s.messageGorm.GetByID(db.DB, id)
+	if err != nil {
+		return err
+	}
+
+	if message == nil {
+		return fmt.Errorf("message test %d not found", id)
+	}
+
+	s.runningMutex.Lock()
+	if s.running[id] {
+		s.runningMutex.Unlock()
+		return fmt.Errorf("message test %d is already running", id)
+	}
+	s.running[id] = true
+	s.runningMutex.Unlock()
+
+	// 清除上一次运行的结果
+	if err := s.testResultGorm.DeleteByMessageID(db.DB, id); err != nil {
+		s.finish(id)
+		return err
+	}
+
+	message.Status = models.MessageStatusRunning
+	message.StartTime = time.Now()
+	message.EndTime = time.Time{}
+	if err := s.messageGorm.Update(db.DB, message); err != nil {
+		s.finish(id)
+		return err
+	}
+
+	go s.run(message, slaveIDs)
+	return nil
+}
+
+// GetMessageTestResults 获取消息测试的用例结果
+func (s *Service) GetMessageTestResults(id int64) ([]*models.MessageTestResult, error) {
+	return s.testResultGorm.GetByMessageID(db.DB, id)
+}
+
+// DeleteMessageTest 删除消息测试记录及其结果
+func (s *Service) DeleteMessageTest(id int64) error {
+	s.runningMutex.Lock()
+	running := s.running[id]
+	s.runningMutex.Unlock()
+
+	if running {
+		return fmt.Errorf("message test %d is running", id)
+	}
+
+	if err := s.testResultGorm.DeleteByMessageID(db.DB, id); err != nil {
+		return err
+	}
+	return s.messageGorm.Delete(db.DB, id)
+}
+
+// run 向slave下发测试命令并等待结果
+func (s *Service) run(message *models.Message, slaveIDs []int64) {
+	defer s.finish(message.ID)
+
+	spec := messagetest.Spec{
+		TestID:      message.ID,
+		PayloadSize: message.PayloadSize,
+		MessageType: message.MessageType,
+		Retained:    message.Retained,
+		Duplicate:   message.Duplicate,
+		QoS:         message.QoSLevel,
+	}
+
+	// 下发前开始等待结果，slave在下发返回前就可能上报。下发失败的slave记为失败用例
+	s.masterServer.ExpectMessageTestReports(message.ID, slaveIDs)
+	var dispatched []int64
+	dispatchFailed := make(map[int64]bool)
+	for _, slaveID := range slaveIDs {
+		if err := s.masterServer.SendMessageTest(slaveID, spec); err != nil {
+			log.Printf("Failed to send message test %d to slave %d: %v", message.ID, slaveID, err)
+			s.saveFailure(message.ID, slaveID, "dispatch", fmt.Sprintf("failed to send test command: %v", err))
+			dispatchFailed[slaveID] = true
+			continue
+		}
+		dispatched = append(dispatched, slaveID)
+	}
+
+	// 等待所有slave的结果保存完成，超时后不再接受结果
+	deadline := time.Now().Add(resultTimeout)
+	for time.Now().Before(deadline) && !s.allReported(message.ID, dispatched) {
+		time.Sleep(time.Second)
+	}
+
+	var missing []int64
+	for _, slaveID := range s.masterServer.EndMessageTestReports(message.ID) {
+		if dispatchFailed[slaveID] {
+			continue
+		}
+		missing = append(missing, slaveID)
+		s.saveFailure(message.ID, slaveID, "report", fmt.Sprintf("no result received within %v", resultTimeout))
+	}
+	if len(missing) > 0 {
+		log.Printf("Slaves %v did not report results of message test %d", missing, message.ID)
+	}
+
+	// 所有用例通过时测试通过
+	message.Status = models.MessageStatusPassed
+	results, err := s.testResultGorm.GetByMessageID(db.DB, message.ID)
+	if err != nil || len(results) == 0 {
+		message.Status = models.MessageStatusFailed
+	}
+	for _, result := range results {
+		if !result.Passed {
+			message.Status = models.MessageStatusFailed
+			break
+		}
+	}
+	message.EndTime = time.Now()
+
+	if err := s.messageGorm.Update(db.DB, message); err != nil {
+		log.Printf("Failed to save message test %d: %v", message.ID, err)
+	}
+	log.Printf("Message test %d finished: %s, %d results", message.ID, message.Status, len(results))
+}
+
+// allReported 判断slaves是否都已上报结果
+func (s *Service) allReported(messageID int64, slaveIDs []int64) bool {
+	for _, slaveID := range slaveIDs {
+		if !s.masterServer.MessageTestReported(messageID, slaveID) {
+			return false
+		}
+	}
+	return true
+}
+
+// saveFailure 为未能完成测试的slave记录失败结果，testCase为dispatch（下发失败）或report（未上报结果）
+func (s *Service) saveFailure(messageID int64, slaveID int64, testCase string, evidence string) {
+	result := &models.MessageTestResult{
+		MessageID: messageID,
+		SlaveID:   slaveID,
+		Case:      testCase,
+		Passed:    false,
+		Evidence:  evidence,
+	}
+	if err := s.testResultGorm.Insert(db.DB, result); err != nil {
+		log.Printf("Failed to save message test result: %v", err)
+	}
+}
+
+// finish 将测试从运行列表中移除
+func (s *Service) finish(id int64) {
+	s.runningMutex.Lock()
+	defer s.runningMutex.Unlock()
+
+	delete(s.running, id)
+}
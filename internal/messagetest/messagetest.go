@@ -0,0 +1,25 @@
+package messagetest
+
+// Spec 消息测试参数
+type Spec struct {
+	TestID      int64  `json:"test_id"`      // 对应的Message记录ID
+	PayloadSize int    `json:"payload_size"` // 消息大小（字节）
+	MessageType string `json:"message_type"` // 消息类型：json/text/binary
+	Retained    bool   `json:"retained"`     // 是否测试保留消息
+	Duplicate   bool   `json:"duplicate"`    // 是否测试DUP标志
+	QoS         int    `json:"qos"`          // 测试的QoS等级
+}
+
+// CaseResult 单个消息测试用例的结果
+type CaseResult struct {
+	Case     string `json:"case"`
+	Passed   bool   `json:"passed"`
+	Evidence string `json:"evidence"`
+}
+
+// Report slave上报给master的消息测试结果
+type Report struct {
+	SlaveID int          `json:"slave_id"`
+	TestID  int64        `json:"test_id"`
+	Results []CaseResult `json:"results"`
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// 直方图分桶参数：小于linearLimit的值按1微秒精确分桶，
+// 更大的值在每个2的幂区间内再划分subBuckets个桶，相对误差约为1/subBuckets
+const (
+	linearLimit = 128
+	subBuckets  = 64
+	subBits     = 6
+	maxExponent = 64 - subBits - 1
+	bucketCount = linearLimit + maxExponent*subBuckets
+)
+
+// Histogram HDR风格的延迟直方图，以微秒为单位记录，可并发写入
+type Histogram struct {
+	counts [bucketCount]int64
+	count  int64
+	sum    int64
+	max    int64
+}
+
+// NewHistogram 创建新的直方图
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+// Record 记录一个延迟值，负值按0处理
+func (h *Histogram) Record(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+
+	atomic.AddInt64(&h.counts[bucketIndex(v)], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+
+	for {
+		current := atomic.LoadInt64(&h.max)
+		if v <= current || atomic.CompareAndSwapInt64(&h.max, current, v) {
+			break
+		}
+	}
+}
+
+// Reset 清空直方图
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+// Stats 计算当前的延迟统计结果，包含用于合并的稀疏分桶计数
+func (h *Histogram) Stats() LatencyStats {
+	buckets := make(map[int]int64)
+	for i := range h.counts {
+		if c := atomic.LoadInt64(&h.counts[i]); c > 0 {
+			buckets[i] = c
+		}
+	}
+
+	return newLatencyStats(buckets, atomic.LoadInt64(&h.sum), atomic.LoadInt64(&h.max))
+}
+
+// LatencyStats 延迟统计结果，时间单位为毫秒
+type LatencyStats struct {
+	Count   int64         `json:"count"`
+	Mean    float64       `json:"mean"`
+	P50     float64       `json:"p50"`
+	P90     float64       `json:"p90"`
+	P99     float64       `json:"p99"`
+	P999    float64       `json:"p999"`
+	Max     float64       `json:"max"`
+	SumUs   int64         `json:"sum_us"`            // 延迟总和（微秒），用于合并后计算平均值
+	MaxUs   int64         `json:"max_us"`            // 最大延迟（微秒），用于合并
+	Buckets map[int]int64 `json:"buckets,omitempty"` // 稀疏分桶计数，用于master端合并
+}
+
+// MergeLatencyStats 合并多个slave的延迟统计结果，重新计算整体百分位
+func MergeLatencyStats(stats ...*LatencyStats) LatencyStats {
+	buckets := make(map[int]int64)
+	var sum, maxUs int64
+	for _, s := range stats {
+		if s == nil {
+			continue
+		}
+		for i, c := range s.Buckets {
+			buckets[i] += c
+		}
+		sum += s.SumUs
+		maxUs = max(maxUs, s.MaxUs)
+	}
+
+	return newLatencyStats(buckets, sum, maxUs)
+}
+
+// newLatencyStats 根据分桶计数计算统计结果
+func newLatencyStats(buckets map[int]int64, sum int64, maxUs int64) LatencyStats {
+	stats := LatencyStats{
+		SumUs:   sum,
+		MaxUs:   maxUs,
+		Max:     usToMs(maxUs),
+		Buckets: buckets,
+	}
+
+	for i, c := range buckets {
+		if i < 0 || i >= bucketCount {
+			continue
+		}
+		stats.Count += c
+	}
+	if stats.Count == 0 {
+		return stats
+	}
+
+	stats.Mean = usToMs(sum) / float64(stats.Count)
+	stats.P50 = usToMs(min(percentile(buckets, stats.Count, 0.50), maxUs))
+	stats.P90 = usToMs(min(percentile(buckets, stats.Count, 0.90), maxUs))
+	stats.P99 = usToMs(min(percentile(buckets, stats.Count, 0.99), maxUs))
+	stats.P999 = usToMs(min(percentile(buckets, stats.Count, 0.999), maxUs))
+	return stats
+}
+
+// percentile 按分桶计数计算百分位值（微秒），返回所在桶的上界
+func percentile(buckets map[int]int64, total int64, q float64) int64 {
+	target := int64(q*float64(total) + 0.5)
+	target = max(target, 1)
+
+	var seen int64
+	for i := 0; i < bucketCount; i++ {
+		seen += buckets[i]
+		if seen >= target {
+			return bucketUpperBound(i)
+		}
+	}
+	return 0
+}
+
+// bucketIndex 计算值所在的桶
+func bucketIndex(v int64) int {
+	if v < linearLimit {
+		return int(v)
+	}
+
+	exponent := bits.Len64(uint64(v)) - subBits - 1
+	sub := int(v>>exponent) - subBuckets
+	return linearLimit + (exponent-1)*subBuckets + sub
+}
+
+// bucketUpperBound 计算桶能表示的最大值
+func bucketUpperBound(index int) int64 {
+	if index < linearLimit {
+		return int64(index)
+	}
+
+	k := index - linearLimit
+	exponent := k/subBuckets + 1
+	sub := int64(k%subBuckets + subBuckets)
+	return (sub+1)<<exponent - 1
+}
+
+// usToMs 微秒转换为毫秒
+func usToMs(us int64) float64 {
+	return float64(us) / 1000
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucketIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		value int64
+		index int
+	}{
+		{"zero", 0, 0},
+		{"linear", 100, 100},
+		{"last linear", linearLimit - 1, linearLimit - 1},
+		{"first log bucket", linearLimit, linearLimit},
+		{"same log bucket", linearLimit + 1, linearLimit},
+		{"end of first power of two", 255, linearLimit + subBuckets - 1},
+		{"start of second power of two", 256, linearLimit + subBuckets},
+		{"one millisecond", 1000, linearLimit + 2*subBuckets + 61},
+		{"one second", 1000000, linearLimit + 12*subBuckets + 58},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := bucketIndex(tt.value)
+			if index != tt.index {
+				t.Fatalf("bucketIndex(%d) = %d, want %d", tt.value, index, tt.index)
+			}
+
+			// 值必须落在桶的范围内，且桶宽不超过值的1/subBuckets
+			upper := bucketUpperBound(index)
+			lower := int64(0)
+			if index > 0 {
+				lower = bucketUpperBound(index-1) + 1
+			}
+			if tt.value < lower || tt.value > upper {
+				t.Errorf("value %d outside bucket %d [%d, %d]", tt.value, index, lower, upper)
+			}
+			if width := upper - lower + 1; tt.value >= linearLimit && width*subBuckets > tt.value {
+				t.Errorf("bucket %d too wide for %d: %d", index, tt.value, width)
+			}
+		})
+	}
+}
+
+func TestHistogramStats(t *testing.T) {
+	sequence := func(from, to int, unit time.Duration) []time.Duration {
+		var values []time.Duration
+		for i := from; i <= to; i++ {
+			values = append(values, time.Duration(i)*unit)
+		}
+		return values
+	}
+
+	tests := []struct {
+		name   string
+		values []time.Duration
+		want   LatencyStats
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "single value is capped at max",
+			values: []time.Duration{time.Millisecond},
+			want:   LatencyStats{Count: 1, Mean: 1, P50: 1, P90: 1, P99: 1, P999: 1, Max: 1},
+		},
+		{
+			name:   "negative recorded as zero",
+			values: []time.Duration{-time.Second, 2 * time.Millisecond},
+			want:   LatencyStats{Count: 2, Mean: 1, P50: 0, P90: 2, P99: 2, P999: 2, Max: 2},
+		},
+		{
+			name:   "exact below linear limit",
+			values: sequence(1, 100, time.Microsecond),
+			want:   LatencyStats{Count: 100, Mean: 0.0505, P50: 0.050, P90: 0.090, P99: 0.099, P999: 0.100, Max: 0.100},
+		},
+		{
+			name:   "uniform milliseconds",
+			values: sequence(1, 1000, time.Millisecond),
+			want:   LatencyStats{Count: 1000, Mean: 500.5, P50: 500, P90: 900, P99: 990, P999: 999, Max: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistogram()
+			for _, v := range tt.values {
+				h.Record(v)
+			}
+			assertStats(t, h.Stats(), tt.want)
+
+			h.Reset()
+			assertStats(t, h.Stats(), LatencyStats{})
+		})
+	}
+}
+
+func TestMergeLatencyStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		slaves [][]time.Duration
+		want   LatencyStats
+	}{
+		{
+			name: "no stats",
+		},
+		{
+			name:   "nil and empty stats",
+			slaves: [][]time.Duration{nil, {}},
+		},
+		{
+			name:   "percentiles across slaves",
+			slaves: [][]time.Duration{{time.Millisecond, time.Millisecond, time.Millisecond}, {10 * time.Millisecond}},
+			want:   LatencyStats{Count: 4, Mean: 3.25, P50: 1, P90: 10, P99: 10, P999: 10, Max: 10},
+		},
+		{
+			name:   "max from slowest slave",
+			slaves: [][]time.Duration{{2 * time.Millisecond}, {5 * time.Millisecond}, nil},
+			want:   LatencyStats{Count: 2, Mean: 3.5, P50: 2, P90: 5, P99: 5, P999: 5, Max: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats []*LatencyStats
+			for _, values := range tt.slaves {
+				if values == nil {
+					stats = append(stats, nil)
+					continue
+				}
+				h := NewHistogram()
+				for _, v := range values {
+					h.Record(v)
+				}
+				s := h.Stats()
+				stats = append(stats, &s)
+			}
+			assertStats(t, MergeLatencyStats(stats...), tt.want)
+		})
+	}
+}
+
+// assertStats 比较统计结果，百分位允许分桶带来的1/subBuckets相对误差
+func assertStats(t *testing.T, got, want LatencyStats) {
+	t.Helper()
+
+	if got.Count != want.Count {
+		t.Errorf("Count = %d, want %d", got.Count, want.Count)
+	}
+	if !approx(got.Mean, want.Mean, 1e-9) {
+		t.Errorf("Mean = %v, want %v", got.Mean, want.Mean)
+	}
+	if !approx(got.Max, want.Max, 1e-9) {
+		t.Errorf("Max = %v, want %v", got.Max, want.Max)
+	}
+
+	percentiles := []struct {
+		name      string
+		got, want float64
+	}{
+		{"P50", got.P50, want.P50},
+		{"P90", got.P90, want.P90},
+		{"P99", got.P99, want.P99},
+		{"P999", got.P999, want.P999},
+	}
+	for _, p := range percentiles {
+		// 百分位取所在桶的上界，不会小于实际值
+		if p.got < p.want || !approx(p.got, p.want, 1.0/subBuckets) {
+			t.Errorf("%s = %v, want %v", p.name, p.got, p.want)
+		}
+	}
+}
+
+// approx 判断相对误差是否不超过tolerance
+func approx(got, want, tolerance float64) bool {
+	if want == 0 {
+		return got == 0
+	}
+	return math.Abs(got-want) <= math.Abs(want)*tolerance
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ContentType Prometheus文本格式的Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultLatencyBuckets 延迟直方图导出时使用的桶上界（秒）
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Label 指标标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// PromWriter 以Prometheus文本格式输出指标。同一指标的所有样本需要在一次Header之后连续写入
+type PromWriter struct {
+	w   io.Writer
+	err error
+}
+
+// NewPromWriter 创建Prometheus文本格式输出
+func NewPromWriter(w io.Writer) *PromWriter {
+	return &PromWriter{w: w}
+}
+
+// Err 返回写入过程中遇到的第一个错误
+func (p *PromWriter) Err() error {
+	return p.err
+}
+
+// Header 输出指标的HELP和TYPE行，metricType为gauge/counter/histogram
+func (p *PromWriter) Header(name, metricType, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, metricType)
+}
+
+// Sample 输出一个样本
+func (p *PromWriter) Sample(name string, value float64, labels ...Label) {
+	p.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Gauge 输出没有标签的gauge指标
+func (p *PromWriter) Gauge(name, help string, value float64) {
+	p.Header(name, "gauge", help)
+	p.Sample(name, value)
+}
+
+// Counter 输出没有标签的counter指标
+func (p *PromWriter) Counter(name, help string, value float64) {
+	p.Header(name, "counter", help)
+	p.Sample(name, value)
+}
+
+// Histogram 将延迟统计按bounds（秒）输出为histogram指标。
+// 只统计上界不超过bound的内部分桶，因此每个bucket的计数是保守值
+func (p *PromWriter) Histogram(name, help string, stats LatencyStats, bounds []float64) {
+	p.Header(name, "histogram", help)
+
+	for _, bound := range bounds {
+		limitUs := int64(bound * 1e6)
+		var count int64
+		for i, c := range stats.Buckets {
+			if i >= 0 && i < bucketCount && bucketUpperBound(i) <= limitUs {
+				count += c
+			}
+		}
+		p.Sample(name+"_bucket", float64(count), Label{"le", formatValue(bound)})
+	}
+	p.Sample(name+"_bucket", float64(stats.Count), Label{"le", "+Inf"})
+	p.Sample(name+"_sum", float64(stats.SumUs)/1e6)
+	p.Sample(name+"_count", float64(stats.Count))
+}
+
+// WriteRuntimeMetrics 输出Go运行时指标
+func (p *PromWriter) WriteRuntimeMetrics() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	p.Gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	p.Gauge("go_threads", "Number of OS threads created.", float64(threadCount()))
+	p.Gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(mem.Alloc))
+	p.Counter("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(mem.TotalAlloc))
+	p.Gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(mem.Sys))
+	p.Gauge("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", float64(mem.HeapAlloc))
+	p.Gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(mem.HeapInuse))
+	p.Gauge("go_memstats_heap_objects", "Number of allocated objects.", float64(mem.HeapObjects))
+	p.Counter("go_memstats_gc_total", "Number of completed GC cycles.", float64(mem.NumGC))
+	p.Counter("go_gc_pause_seconds_total", "Total GC pause time in seconds.", float64(mem.PauseTotalNs)/1e9)
+}
+
+// threadCount 获取当前的OS线程数
+func threadCount() int {
+	n, _ := runtime.ThreadCreateProfile(nil)
+	return n
+}
+
+func (p *PromWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+// formatLabels 格式化标签，没有标签时返回空字符串
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(label.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// formatValue 格式化样本值
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// escapeLabelValue 转义标签值中的反斜杠、换行和双引号
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// escapeHelp 转义HELP文本中的反斜杠和换行
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
@@ -0,0 +1,22 @@
+package metrics
+
+// SequenceStats 消息序号检查结果，slave按订阅者、发布者和主题分别检查，master汇总各slave的结果
+type SequenceStats struct {
+	Streams    int64 `json:"streams"`      // 检查的消息流数量
+	Lost       int64 `json:"lost"`         // 仍未收到的消息数
+	Duplicates int64 `json:"duplicates"`   // 重复收到的消息数
+	OutOfOrder int64 `json:"out_of_order"` // 晚于后续序号到达的消息数
+	Gaps       int64 `json:"gaps"`         // 序号出现跳跃的次数
+}
+
+// Add 累加另一个slave的检查结果，other为nil时不变
+func (s *SequenceStats) Add(other *SequenceStats) {
+	if other == nil {
+		return
+	}
+	s.Streams += other.Streams
+	s.Lost += other.Lost
+	s.Duplicates += other.Duplicates
+	s.OutOfOrder += other.OutOfOrder
+	s.Gaps += other.Gaps
+}
@@ -14,12 +14,36 @@ type Message struct {
 	Retained    bool      `json:"retained"`     // Retained flag
 	Duplicate   bool      `json:"duplicate"`    // Duplicate flag
 	QoSLevel    int       `json:"qos_level"`    // QoS level
-	Status      string    `json:"status"`       // Status
+	Status      string    `json:"status"`       // Status (pending/running/passed/failed)
 	StartTime   time.Time `json:"start_time"`   // Start time
 	EndTime     time.Time `json:"end_time"`     // End time
 	CreatedAt   time.Time `json:"created_at"`   // Creation time
 }
 
+// Message test status
+const (
+	MessageStatusPending = "pending"
+	MessageStatusRunning = "running"
+	MessageStatusPassed  = "passed"
+	MessageStatusFailed  = "failed"
+)
+
+// MessageTestResult represents the result of one test case run by a slave for a Message
+type MessageTestResult struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	MessageID int64     `json:"message_id" gorm:"index"` // ID of the Message row
+	SlaveID   int64     `json:"slave_id"`                // Slave that ran the case
+	Case      string    `json:"case"`                    // Test case (qos/retained/duplicate)
+	Passed    bool      `json:"passed"`                  // Whether the broker behaved as expected
+	Evidence  string    `json:"evidence"`                // What was observed
+	CreatedAt time.Time `json:"created_at"`              // Creation time
+}
+
+// TableName specifies the table name for MessageTestResult
+func (MessageTestResult) TableName() string {
+	return "message_test_results"
+}
+
 // TableName specifies the table name for Message
 func (Message) TableName() string {
 	return "messages"
@@ -111,3 +135,49 @@ func (g *MessageGorm) Delete(db *gorm.DB, id int64) error {
 	result := db.Delete(&Message{}, id)
 	return result.Error
 }
+
+// CountByStatus counts message records by status using GORM
+func (g *MessageGorm) CountByStatus(db *gorm.DB) (map[string]int64, error) {
+	return countByStatus(db, &Message{})
+}
+
+// MessageTestResultGorm provides GORM-based database operations for MessageTestResult
+type MessageTestResultGorm struct{}
+
+// GetByMessageID retrieves all results of a message test using GORM
+func (g *MessageTestResultGorm) GetByMessageID(db *gorm.DB, messageID int64) ([]*MessageTestResult, error) {
+	var results []*MessageTestResult
+	result := db.Where("message_id = ?", messageID).Order("slave_id, id").Find(&results)
+	return results, result.Error
+}
+
+// Insert inserts a new message test result using GORM
+func (g *MessageTestResultGorm) Insert(db *gorm.DB, testResult *MessageTestResult) error {
+	testResult.CreatedAt = time.Now()
+	result := db.Create(testResult)
+	return result.Error
+}
+
+// DeleteByMessageID deletes all results of a message test using GORM
+func (g *MessageTestResultGorm) DeleteByMessageID(db *gorm.DB, messageID int64) error {
+	result := db.Where("message_id = ?", messageID).Delete(&MessageTestResult{})
+	return result.Error
+}
+
+// countByStatus counts the rows of a table grouped by its status column
+func countByStatus(db *gorm.DB, model interface{}) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	result := db.Model(model).Select("status, count(*) as count").Group("status").Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MetricSample represents one periodic metrics sample pushed by a slave
+type MetricSample struct {
+	ID               int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	SlaveID          int64     `json:"slave_id" gorm:"index:idx_metric_samples_slave_time"`  // Slave that took the sample
+	Timestamp        time.Time `json:"timestamp" gorm:"index:idx_metric_samples_slave_time"` // Receive time on the master (UTC)
+	Interval         float64   `json:"interval"`                                             // Seconds covered by the sample
+	ConnectedClients int       `json:"connected_clients"`                                    // Currently connected MQTT clients
+	ReceivedRate     float64   `json:"received_rate"`                                        // Messages received per second
+	PublishRate      float64   `json:"publish_rate"`                                         // Messages published per second
+	AckRate          float64   `json:"ack_rate"`                                             // ACKs sent per second
+	PublishFailures  int64     `json:"publish_failures"`                                     // Failed publishes in the interval
+	AckFailures      int64     `json:"ack_failures"`                                         // Failed ACKs in the interval
+	Reconnects       int64     `json:"reconnects"`                                           // Reconnect attempts in the interval
+	LatencyCount     int64     `json:"latency_count"`                                        // Latency samples in the interval
+	LatencyP50       float64   `json:"latency_p50"`                                          // Milliseconds
+	LatencyP90       float64   `json:"latency_p90"`                                          // Milliseconds
+	LatencyP99       float64   `json:"latency_p99"`                                          // Milliseconds
+	LatencyMax       float64   `json:"latency_max"`                                          // Milliseconds
+}
+
+// TableName specifies the table name for MetricSample
+func (MetricSample) TableName() string {
+	return "metric_samples"
+}
+
+// MetricSampleGorm provides GORM-based database operations for MetricSample
+type MetricSampleGorm struct{}
+
+// Insert inserts a new metric sample using GORM
+func (g *MetricSampleGorm) Insert(db *gorm.DB, sample *MetricSample) error {
+	result := db.Create(sample)
+	return result.Error
+}
+
+// GetSince retrieves the samples taken after since, ordered by time.
+// A slaveID of 0 returns the samples of all slaves
+func (g *MetricSampleGorm) GetSince(db *gorm.DB, slaveID int64, since time.Time) ([]*MetricSample, error) {
+	var samples []*MetricSample
+	query := db.Where("timestamp > ?", since)
+	if slaveID != 0 {
+		query = query.Where("slave_id = ?", slaveID)
+	}
+	result := query.Order("timestamp, slave_id").Find(&samples)
+	return samples, result.Error
+}
+
+// DeleteBefore deletes the samples taken before the given time using GORM
+func (g *MetricSampleGorm) DeleteBefore(db *gorm.DB, before time.Time) error {
+	result := db.Where("timestamp < ?", before).Delete(&MetricSample{})
+	return result.Error
+}
@@ -13,12 +13,39 @@ type Performance struct {
 	MessageRate  int       `json:"message_rate"`  // Message rate (messages per second)
 	MessageSize  int       `json:"message_size"`  // Message size (bytes)
 	QoSLevel     int       `json:"qos_level"`     // QoS level
-	Status       string    `json:"status"`        // Status
+	Status       string    `json:"status"`        // Status (pending/running/completed/stopped/failed)
+	SlaveIDs     string    `json:"slave_ids"`     // Comma separated IDs of the slaves driven by the test
 	StartTime    time.Time `json:"start_time"`    // Start time
 	EndTime      time.Time `json:"end_time"`      // End time
 	CreatedAt    time.Time `json:"created_at"`    // Creation time
+
+	// Aggregated results
+	PublishedCount  int64   `json:"published_count"`    // Messages published by all slaves
+	PublishFailures int64   `json:"publish_failures"`   // Failed publishes of all slaves
+	PublishSkipped  int64   `json:"publish_skipped"`    // Publishes skipped because too many messages were awaiting acknowledgement
+	ReceivedCount   int64   `json:"received_count"`     // Messages received by all slaves
+	Throughput      float64 `json:"throughput"`         // Published messages per second
+	LatencyCount    int64   `json:"latency_count"`      // Number of latency samples
+	LatencyP50      float64 `json:"latency_p50"`        // Latency p50 (ms)
+	LatencyP90      float64 `json:"latency_p90"`        // Latency p90 (ms)
+	LatencyP99      float64 `json:"latency_p99"`        // Latency p99 (ms)
+	LatencyP999     float64 `json:"latency_p999"`       // Latency p99.9 (ms)
+	LatencyMax      float64 `json:"latency_max"`        // Latency max (ms)
+	LostCount       int64   `json:"lost_count"`         // Messages missing from their publisher's sequence
+	DuplicateCount  int64   `json:"duplicate_count"`    // Messages received more than once
+	OutOfOrderCount int64   `json:"out_of_order_count"` // Messages received after a later sequence number
+	ErrorMessage    string  `json:"error_message"`      // Error message when the test failed
 }
 
+// Performance test status
+const (
+	PerformanceStatusPending   = "pending"
+	PerformanceStatusRunning   = "running"
+	PerformanceStatusCompleted = "completed"
+	PerformanceStatusStopped   = "stopped"
+	PerformanceStatusFailed    = "failed"
+)
+
 // TableName specifies the table name for Performance
 func (Performance) TableName() string {
 	return "performances"
@@ -67,3 +94,8 @@ func (g *PerformanceGorm) Delete(db *gorm.DB, id int64) error {
 func TestFunction() string {
 	return "Test function in models package"
 }
+
+// CountByStatus counts performance records by status using GORM
+func (g *PerformanceGorm) CountByStatus(db *gorm.DB) (map[string]int64, error) {
+	return countByStatus(db, &Performance{})
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"log"
 	"time"
 
@@ -10,22 +11,146 @@ import (
 // Slave represents a slave configuration
 type Slave struct {
 	ID          int64     `json:"id" gorm:"primaryKey;autoIncrement"`
-	Name        string    `json:"name"`                         // Slave name
-	MqttHost    string    `json:"mqtt_host"`                    // MQTT Host address
-	MqttPort    int       `json:"mqtt_port"`                    // MQTT Port number
-	SlaveHost   string    `json:"slave_host"`                   // Slave Host address
-	SlavePort   int       `json:"slave_port"`                   // Slave Port number
-	ClientID    string    `json:"client_id"`                    // Client ID
-	KeepAlive   int       `json:"keep_alive" gorm:"default:60"` // Keep alive interval
-	Topic       string    `json:"topic"`                        // MQTT Topic
-	QoS         int       `json:"qos" gorm:"column:qos"`        // MQTT QoS, default is 0
-	Start       int       `json:"start"`                        // Start value
-	Step        int       `json:"step"`                         // Step value (替代原来的End字段)
-	AckTopic    string    `json:"ack_topic"`                    // ACK Topic
-	Status      string    `json:"status"`                       // Slave status (online/offline)
-	Connections int       `json:"connections"`                  // Number of MQTT connections
-	CreatedAt   time.Time `json:"created_at"`                   // Creation time (slave first registered time)
-	UpdatedAt   time.Time `json:"updated_at"`                   // Update time
+	Name        string    `json:"name"`                          // Slave name
+	MqttHost    string    `json:"mqtt_host"`                     // MQTT Host address
+	MqttPort    int       `json:"mqtt_port"`                     // MQTT Port number
+	SlaveHost   string    `json:"slave_host"`                    // Slave Host address
+	SlavePort   int       `json:"slave_port"`                    // Slave Port number
+	ClientID    string    `json:"client_id"`                     // Client ID
+	KeepAlive   int       `json:"keep_alive" gorm:"default:60"`  // Keep alive interval
+	Topic       string    `json:"topic"`                         // MQTT Topic
+	QoS         int       `json:"qos" gorm:"column:qos"`         // MQTT QoS, default is 0
+	Start       int       `json:"start"`                         // Start value
+	Step        int       `json:"step"`                          // Step value (替代原来的End字段)
+	AckTopic    string    `json:"ack_topic"`                     // ACK Topic
+	Mode        string    `json:"mode"`                          // Client mode (subscribe/publish/both), empty means subscribe
+	PubTopic    string    `json:"pub_topic"`                     // Publish topic, empty means Topic
+	PubRate     float64   `json:"pub_rate"`                      // Publish rate per client (messages per second)
+	PayloadSize int       `json:"payload_size"`                  // Publish payload size (bytes)
+	PubQoS      int       `json:"pub_qos" gorm:"column:pub_qos"` // Publish QoS
+	Capacity    int       `json:"capacity"`                      // Relative weight for client partitioning, 0 means 1
+	Status      string    `json:"status"`                        // Slave status (online/offline)
+	Connections int       `json:"connections"`                   // Number of MQTT connections
+	CreatedAt   time.Time `json:"created_at"`                    // Creation time (slave first registered time)
+	UpdatedAt   time.Time `json:"updated_at"`                    // Update time
+
+	// Connection ramp-up strategy
+	RampStrategy   string  `json:"ramp_strategy"`    // immediate/rate/linear/batch, empty means immediate
+	RampRate       float64 `json:"ramp_rate"`        // rate: connections per second
+	RampDuration   int     `json:"ramp_duration"`    // linear: seconds to open all connections
+	RampBatchSize  int     `json:"ramp_batch_size"`  // batch: connections per batch
+	RampBatchPause int     `json:"ramp_batch_pause"` // batch: pause between batches (milliseconds)
+
+	// MQTT protocol
+	ProtocolVersion   int               `json:"protocol_version"`                       // 3 (3.1), 4 (3.1.1) or 5 (5.0), 0 means 3.1.1
+	SessionExpiry     int64             `json:"session_expiry"`                         // MQTT 5: session expiry interval (seconds)
+	ReceiveMaximum    int               `json:"receive_maximum"`                        // MQTT 5: receive maximum, 0 means the protocol default
+	TopicAliasMaximum int               `json:"topic_alias_maximum"`                    // MQTT 5: topic aliases accepted from the broker
+	TopicAlias        bool              `json:"topic_alias"`                            // MQTT 5: use topic aliases when publishing
+	UserProperties    map[string]string `json:"user_properties" gorm:"serializer:json"` // MQTT 5: user properties sent in CONNECT and PUBLISH
+
+	// TLS, certificates and keys are PEM text sent to the slave at deploy time.
+	// The private key is never serialized to JSON, see MarshalJSON
+	TLSEnabled            bool   `json:"tls_enabled" gorm:"column:tls_enabled"`
+	TLSCACert             string `json:"tls_ca_cert" gorm:"column:tls_ca_cert"`                           // CA bundle, empty means the system roots
+	TLSClientCert         string `json:"tls_client_cert" gorm:"column:tls_client_cert"`                   // Client certificate for mTLS
+	TLSClientKey          string `json:"-" gorm:"column:tls_client_key"`                                  // Client private key for mTLS
+	TLSServerName         string `json:"tls_server_name" gorm:"column:tls_server_name"`                   // SNI server name, empty means MqttHost
+	TLSMinVersion         string `json:"tls_min_version" gorm:"column:tls_min_version"`                   // 1.0/1.1/1.2/1.3, empty means 1.2
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify" gorm:"column:tls_insecure_skip_verify"` // Skip broker certificate verification
+
+	// Transport
+	Transport string            `json:"transport"`                                           // tcp/ssl/ws/wss, empty means tcp, or ssl when TLS is enabled
+	WSPath    string            `json:"ws_path" gorm:"column:ws_path"`                       // WebSocket path, empty means /mqtt
+	WSHeaders map[string]string `json:"ws_headers" gorm:"column:ws_headers;serializer:json"` // Extra HTTP headers for the WebSocket handshake
+
+	// Credentials, the credential file content is sent to the slave at deploy time.
+	// The password and token secret are never serialized to JSON, see MarshalJSON
+	CredentialMode       string `json:"credential_mode" gorm:"column:credential_mode"`               // client_id/static/template/file/token, empty means client_id
+	CredentialUsername   string `json:"credential_username" gorm:"column:credential_username"`       // static: username; template/token: username template
+	CredentialPassword   string `json:"-" gorm:"column:credential_password"`                         // static: password; template: password template
+	CredentialFile       string `json:"credential_file" gorm:"column:credential_file"`               // file: CSV or JSON credential file content
+	CredentialFileFormat string `json:"credential_file_format" gorm:"column:credential_file_format"` // file: csv/json, empty means csv
+	TokenSecret          string `json:"-" gorm:"column:token_secret"`                                // token: HMAC signing secret
+	TokenAlgorithm       string `json:"token_algorithm" gorm:"column:token_algorithm"`               // token: HS256/HS384/HS512, empty means HS256
+	TokenTTL             int    `json:"token_ttl" gorm:"column:token_ttl"`                           // token: lifetime in seconds, 0 means 3600
+	TokenIssuer          string `json:"token_issuer" gorm:"column:token_issuer"`                     // token: iss claim, empty means none
+	TokenAudience        string `json:"token_audience" gorm:"column:token_audience"`                 // token: aud claim, empty means none
+
+	// Publish payload, sample file contents are sent to the slave at deploy time
+	PayloadType     string   `json:"payload_type" gorm:"column:payload_type"`                       // json/random/template/file, empty means json
+	PayloadContent  string   `json:"payload_content" gorm:"column:payload_content"`                 // json/random padding: random/compressible, empty means random
+	PayloadTemplate string   `json:"payload_template" gorm:"column:payload_template"`               // template: payload template with placeholders
+	PayloadSamples  []string `json:"payload_samples" gorm:"column:payload_samples;serializer:json"` // file: sample payloads, published in turn
+
+	// ACK replies, AckTopic is the topic template
+	AckMode   string            `json:"ack_mode" gorm:"column:ack_mode"`                     // eew/template/off, empty means eew
+	AckFields map[string]string `json:"ack_fields" gorm:"column:ack_fields;serializer:json"` // template: ACK field name to value template
+	AckQoS    *int              `json:"ack_qos" gorm:"column:ack_qos"`                       // ACK QoS, nil means the QoS of the received message
+	AckDelay  int               `json:"ack_delay" gorm:"column:ack_delay"`                   // Delay before sending the ACK (milliseconds)
+
+	// Topic templates, Topic and PubTopic may also contain placeholders
+	Subscriptions  []Subscription `json:"subscriptions" gorm:"column:subscriptions;serializer:json"` // Per-client subscriptions, empty means Topic with QoS
+	TopicGroupSize int            `json:"topic_group_size" gorm:"column:topic_group_size"`           // Clients per {{group}}, 0 means {{group}} is not allowed
+
+	// Will message, published by the broker when a client goes away without DISCONNECT
+	WillTopic   string `json:"will_topic" gorm:"column:will_topic"`     // Topic template, empty means no will
+	WillPayload string `json:"will_payload" gorm:"column:will_payload"` // Payload text
+	WillQoS     int    `json:"will_qos" gorm:"column:will_qos"`
+	WillRetain  bool   `json:"will_retain" gorm:"column:will_retain"`
+
+	// Broker cluster nodes, clients are spread across them by BrokerPolicy
+	Brokers      []BrokerNode `json:"brokers" gorm:"column:brokers;serializer:json"` // Empty means MqttHost:MqttPort
+	BrokerPolicy string       `json:"broker_policy" gorm:"column:broker_policy"`     // round_robin/random/weighted/hash, empty means round_robin
+
+	// Local source addresses, each an IP or CIDR, assigned to clients in turn
+	SourceIPs []string `json:"source_ips" gorm:"column:source_ips;serializer:json"` // Empty means the system picks the source address
+}
+
+// Subscription is a topic filter subscribed by every client of a slave
+type Subscription struct {
+	Topic string `json:"topic"` // Topic filter, may contain placeholders and wildcards
+	QoS   int    `json:"qos"`
+}
+
+// BrokerNode is one node of a clustered broker
+type BrokerNode struct {
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Weight int    `json:"weight"` // Share of clients for the weighted policy, 0 means none
+}
+
+// slaveUpdateColumns lists the columns written by the update methods, excluding connections
+var slaveUpdateColumns = []string{"name", "mqtt_host", "mqtt_port", "slave_host", "slave_port", "client_id", "keep_alive", "topic", "qos", "start", "step",
+	"ack_topic", "mode", "pub_topic", "pub_rate", "payload_size", "pub_qos", "capacity",
+	"ramp_strategy", "ramp_rate", "ramp_duration", "ramp_batch_size", "ramp_batch_pause",
+	"protocol_version", "session_expiry", "receive_maximum", "topic_alias_maximum", "topic_alias", "user_properties",
+	"tls_enabled", "tls_ca_cert", "tls_client_cert", "tls_client_key", "tls_server_name", "tls_min_version", "tls_insecure_skip_verify",
+	"transport", "ws_path", "ws_headers",
+	"credential_mode", "credential_username", "credential_password", "credential_file", "credential_file_format",
+	"token_secret", "token_algorithm", "token_ttl", "token_issuer", "token_audience",
+	"payload_type", "payload_content", "payload_template", "payload_samples",
+	"ack_mode", "ack_fields", "ack_qos", "ack_delay", "subscriptions", "topic_group_size",
+	"will_topic", "will_payload", "will_qos", "will_retain", "brokers", "broker_policy", "source_ips", "status", "updated_at"}
+
+// slaveUpdateColumnsWithConnections lists the columns written by the update methods, including connections
+var slaveUpdateColumnsWithConnections = append(append([]string{}, slaveUpdateColumns...), "connections")
+
+// MarshalJSON adds whether the secrets are set instead of their values,
+// so the UI and API responses never contain them
+func (s Slave) MarshalJSON() ([]byte, error) {
+	type slave Slave // without the MarshalJSON method
+	return json.Marshal(struct {
+		slave
+		TLSClientKeySet       bool `json:"tls_client_key_set"`
+		CredentialPasswordSet bool `json:"credential_password_set"`
+		TokenSecretSet        bool `json:"token_secret_set"`
+	}{
+		slave:                 slave(s),
+		TLSClientKeySet:       s.TLSClientKey != "",
+		CredentialPasswordSet: s.CredentialPassword != "",
+		TokenSecretSet:        s.TokenSecret != "",
+	})
 }
 
 // TableName specifies the table name for Slave
@@ -143,7 +268,7 @@ func (m *SlaveModel) UpdateWithConnections(slave *Slave) error {
 	slave.UpdatedAt = time.Now()
 
 	// 不更新创建时间，保持为第一次注册的时间
-	result := m.DB.Model(slave).Select("name", "mqtt_host", "mqtt_port", "slave_host", "slave_port", "client_id", "keep_alive", "topic", "qos", "start", "step", "status", "connections", "updated_at").Updates(slave)
+	result := m.DB.Model(slave).Select(slaveUpdateColumnsWithConnections).Updates(slave)
 
 	// 添加详细的错误日志
 	if result.Error != nil {
@@ -162,7 +287,7 @@ func (m *SlaveModel) UpdateWithoutConnections(slave *Slave) error {
 	slave.UpdatedAt = time.Now()
 
 	// 不更新创建时间，保持为第一次注册的时间，不更新connections字段
-	result := m.DB.Model(slave).Select("name", "mqtt_host", "mqtt_port", "slave_host", "slave_port", "client_id", "keep_alive", "topic", "qos", "start", "step", "status", "updated_at").Updates(slave)
+	result := m.DB.Model(slave).Select(slaveUpdateColumns).Updates(slave)
 
 	// 添加详细的错误日志
 	if result.Error != nil {
@@ -230,7 +355,7 @@ func (g *SlaveGorm) UpdateWithConnections(db *gorm.DB, slave *Slave) error {
 	slave.UpdatedAt = time.Now()
 
 	// 不更新创建时间，保持为第一次注册的时间
-	result := db.Model(slave).Select("name", "mqtt_host", "mqtt_port", "slave_host", "slave_port", "client_id", "keep_alive", "topic", "qos", "start", "step", "status", "connections", "updated_at").Updates(slave)
+	result := db.Model(slave).Select(slaveUpdateColumnsWithConnections).Updates(slave)
 	return result.Error
 }
 
@@ -240,7 +365,7 @@ func (g *SlaveGorm) UpdateWithoutConnections(db *gorm.DB, slave *Slave) error {
 	slave.UpdatedAt = time.Now()
 
 	// 不更新创建时间，保持为第一次注册的时间，不更新connections字段
-	result := db.Model(slave).Select("name", "mqtt_host", "mqtt_port", "slave_host", "slave_port", "client_id", "keep_alive", "topic", "qos", "start", "step", "status", "updated_at").Updates(slave)
+	result := db.Model(slave).Select(slaveUpdateColumns).Updates(slave)
 	return result.Error
 }
 
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TestPlan represents a declarative multi-phase test plan and the state of its last run
+type TestPlan struct {
+	ID           int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name         string    `json:"name"`          // Plan name
+	Content      string    `json:"content"`       // Plan definition (YAML or JSON)
+	Status       string    `json:"status"`        // Status (pending/running/completed/stopped/failed)
+	SlaveIDs     string    `json:"slave_ids"`     // Comma separated IDs of the slaves of the last run
+	CurrentPhase int       `json:"current_phase"` // Index of the running phase, -1 when not running
+	StartTime    time.Time `json:"start_time"`    // Start time
+	EndTime      time.Time `json:"end_time"`      // End time
+	ErrorMessage string    `json:"error_message"` // Error message when the run failed
+	CreatedAt    time.Time `json:"created_at"`    // Creation time
+}
+
+// Test plan and phase status
+const (
+	TestPlanStatusPending   = "pending"
+	TestPlanStatusRunning   = "running"
+	TestPlanStatusCompleted = "completed"
+	TestPlanStatusStopped   = "stopped"
+	TestPlanStatusFailed    = "failed"
+	TestPlanStatusSkipped   = "skipped" // Only used for phases that were not reached
+)
+
+// TestPlanPhase represents the run of one phase of a TestPlan
+type TestPlanPhase struct {
+	ID           int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	PlanID       int64     `json:"plan_id" gorm:"index"` // ID of the TestPlan row
+	Index        int       `json:"index"`                // Position of the phase in the plan
+	Name         string    `json:"name"`                 // Phase name
+	Type         string    `json:"type"`                 // Phase type (ramp_up/steady/burst/reconnect_storm/teardown)
+	Duration     int       `json:"duration"`             // Phase duration (seconds)
+	Rate         float64   `json:"rate"`                 // Connections or messages per second, depending on the type
+	SlaveIDs     string    `json:"slave_ids"`            // Comma separated IDs of the slaves the phase applied to
+	Status       string    `json:"status"`               // Status (pending/running/completed/stopped/failed/skipped)
+	StartTime    time.Time `json:"start_time"`           // Start time
+	EndTime      time.Time `json:"end_time"`             // End time
+	ErrorMessage string    `json:"error_message"`        // Error message when the phase failed
+}
+
+// TableName specifies the table name for TestPlan
+func (TestPlan) TableName() string {
+	return "test_plans"
+}
+
+// TableName specifies the table name for TestPlanPhase
+func (TestPlanPhase) TableName() string {
+	return "test_plan_phases"
+}
+
+// TestPlanGorm provides GORM-based database operations for TestPlan
+type TestPlanGorm struct{}
+
+// GetAll retrieves all test plans using GORM
+func (g *TestPlanGorm) GetAll(db *gorm.DB) ([]*TestPlan, error) {
+	var plans []*TestPlan
+	result := db.Order("created_at DESC").Find(&plans)
+	return plans, result.Error
+}
+
+// GetByID retrieves a test plan by ID using GORM
+func (g *TestPlanGorm) GetByID(db *gorm.DB, id int64) (*TestPlan, error) {
+	var plan TestPlan
+	result := db.First(&plan, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &plan, nil
+}
+
+// Insert inserts a new test plan using GORM
+func (g *TestPlanGorm) Insert(db *gorm.DB, plan *TestPlan) error {
+	plan.CreatedAt = time.Now()
+	result := db.Create(plan)
+	return result.Error
+}
+
+// Update updates a test plan using GORM
+func (g *TestPlanGorm) Update(db *gorm.DB, plan *TestPlan) error {
+	result := db.Save(plan)
+	return result.Error
+}
+
+// Delete deletes a test plan and its phases using GORM
+func (g *TestPlanGorm) Delete(db *gorm.DB, id int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("plan_id = ?", id).Delete(&TestPlanPhase{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&TestPlan{}, id).Error
+	})
+}
+
+// TestPlanPhaseGorm provides GORM-based database operations for TestPlanPhase
+type TestPlanPhaseGorm struct{}
+
+// GetByPlanID retrieves the phases of a test plan ordered by their position using GORM
+func (g *TestPlanPhaseGorm) GetByPlanID(db *gorm.DB, planID int64) ([]*TestPlanPhase, error) {
+	var phases []*TestPlanPhase
+	result := db.Where("plan_id = ?", planID).Order("`index`").Find(&phases)
+	return phases, result.Error
+}
+
+// Insert inserts a new phase using GORM
+func (g *TestPlanPhaseGorm) Insert(db *gorm.DB, phase *TestPlanPhase) error {
+	result := db.Create(phase)
+	return result.Error
+}
+
+// Update updates a phase using GORM
+func (g *TestPlanPhaseGorm) Update(db *gorm.DB, phase *TestPlanPhase) error {
+	result := db.Save(phase)
+	return result.Error
+}
+
+// DeleteByPlanID deletes all phases of a test plan using GORM
+func (g *TestPlanPhaseGorm) DeleteByPlanID(db *gorm.DB, planID int64) error {
+	result := db.Where("plan_id = ?", planID).Delete(&TestPlanPhase{})
+	return result.Error
+}
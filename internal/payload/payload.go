@@ -0,0 +1,188 @@
+package payload
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// 消息内容类型
+const (
+	TypeJSON     = "json"     // 嵌入发送时间、发布者ID和序号的JSON消息，填充到指定大小（默认）
+	TypeRandom   = "random"   // 指定大小的随机字节，不嵌入发送时间和序号
+	TypeTemplate = "template" // 按模板生成，模板中的占位符在每条消息中替换
+	TypeFile     = "file"     // 依次使用样本文件的内容
+)
+
+// 填充内容，决定消息能否被broker或传输层压缩
+const (
+	ContentRandom       = "random"       // 随机内容，几乎不可压缩（默认）
+	ContentCompressible = "compressible" // 重复的文本，可高度压缩
+)
+
+// JSON消息中嵌入发送时间、发布者ID和序号的字段，订阅端据此统计延迟和检查序号
+const (
+	TimestampKey = "ts"  // 发送时间（Unix纳秒）
+	PublisherKey = "pid" // 发布者的客户端ID
+	SequenceKey  = "seq" // 发布者的消息序号，从1开始递增
+)
+
+// 可压缩内容重复使用的文本
+const compressibleText = "mqttbench payload "
+
+// Config 消息生成配置，master和slave共用
+type Config struct {
+	Type     string   `json:"type"`     // 消息内容类型，为空时为json
+	Content  string   `json:"content"`  // json和random类型的填充内容：random/compressible，为空时为random
+	Template string   `json:"template"` // template类型的模板
+	Samples  []string `json:"samples"`  // file类型的样本内容，每个样本为一条消息
+}
+
+// Generator 为一个发布者生成消息，不能并发调用
+type Generator interface {
+	// Next 生成序号为seq的消息
+	Next(seq uint64) []byte
+}
+
+// Validate 校验消息生成配置，为nil时使用默认的json类型
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	switch c.Content {
+	case "", ContentRandom, ContentCompressible:
+	default:
+		return fmt.Errorf("unsupported payload content: %s", c.Content)
+	}
+
+	switch c.Type {
+	case "", TypeJSON, TypeRandom:
+	case TypeTemplate:
+		if c.Template == "" {
+			return fmt.Errorf("payload template is empty")
+		}
+		if _, err := parseTemplate(c.Template); err != nil {
+			return err
+		}
+	case TypeFile:
+		if len(c.Samples) == 0 {
+			return fmt.Errorf("no payload samples")
+		}
+	default:
+		return fmt.Errorf("unsupported payload type: %s", c.Type)
+	}
+	return nil
+}
+
+// NewGenerator 为客户端创建消息生成器，size为json和random类型的消息大小（字节）
+func (c *Config) NewGenerator(clientID string, size int) (Generator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	config := Config{}
+	if c != nil {
+		config = *c
+	}
+
+	switch config.Type {
+	case TypeRandom:
+		return &randomGenerator{
+			size:         max(size, 0),
+			compressible: config.Content == ContentCompressible,
+			rng:          newRand(),
+		}, nil
+	case TypeTemplate:
+		segments, _ := parseTemplate(config.Template)
+		return &templateGenerator{clientID: clientID, segments: segments, rng: newRand()}, nil
+	case TypeFile:
+		return &sampleGenerator{samples: config.Samples}, nil
+	}
+
+	publisher, _ := json.Marshal(clientID)
+	return &jsonGenerator{
+		size:      size,
+		publisher: publisher,
+		padding:   Padding(size, config.Content),
+	}, nil
+}
+
+// Padding 生成指定长度的可打印字符，用于填充文本和JSON消息
+func Padding(size int, content string) []byte {
+	padding := make([]byte, max(size, 0))
+	if content == ContentCompressible {
+		for i := range padding {
+			padding[i] = compressibleText[i%len(compressibleText)]
+		}
+		return padding
+	}
+
+	rand.Read(padding)
+	for i, b := range padding {
+		padding[i] = randomAlphabet[int(b)%len(randomAlphabet)]
+	}
+	return padding
+}
+
+// newRand 创建生成器使用的伪随机数源，每个生成器独立使用，不需要加锁
+func newRand() *mathrand.ChaCha8 {
+	var seed [32]byte
+	rand.Read(seed[:])
+	return mathrand.NewChaCha8(seed)
+}
+
+// jsonGenerator 生成嵌入发送时间、发布者ID和序号的JSON消息，每个发布者生成一次填充内容并重复使用
+type jsonGenerator struct {
+	size      int
+	publisher []byte // JSON编码后的发布者ID
+	padding   []byte
+}
+
+func (g *jsonGenerator) Next(seq uint64) []byte {
+	payload := make([]byte, 0, max(g.size, 96))
+	payload = append(payload, `{"`+TimestampKey+`":`...)
+	payload = strconv.AppendInt(payload, time.Now().UnixNano(), 10)
+	payload = append(payload, `,"`+PublisherKey+`":`...)
+	payload = append(payload, g.publisher...)
+	payload = append(payload, `,"`+SequenceKey+`":`...)
+	payload = strconv.AppendUint(payload, seq, 10)
+	payload = append(payload, `,"pad":"`...)
+
+	// 消息大小小于头部长度时不再填充
+	if n := g.size - len(payload) - 2; n > 0 {
+		payload = append(payload, g.padding[:min(n, len(g.padding))]...)
+	}
+	return append(payload, `"}`...)
+}
+
+// randomGenerator 生成指定大小的随机字节，可压缩内容为重复的文本
+type randomGenerator struct {
+	size         int
+	compressible bool
+	rng          *mathrand.ChaCha8
+}
+
+func (g *randomGenerator) Next(seq uint64) []byte {
+	payload := make([]byte, g.size)
+	if g.compressible {
+		for i := range payload {
+			payload[i] = compressibleText[i%len(compressibleText)]
+		}
+		return payload
+	}
+	g.rng.Read(payload)
+	return payload
+}
+
+// sampleGenerator 依次使用样本内容
+type sampleGenerator struct {
+	samples []string
+}
+
+func (g *sampleGenerator) Next(seq uint64) []byte {
+	return []byte(g.samples[(seq-1)%uint64(len(g.samples))])
+}
@@ -0,0 +1,137 @@
+package payload
+
+import (
+	"fmt"
+	mathrand "math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 模板中的占位符，格式为{{名称 参数...}}：
+//
+//	{{client_id}}           发布者的客户端ID
+//	{{seq}}                 发布者的消息序号，从1开始递增
+//	{{timestamp}}           发送时间（Unix纳秒），放在ts字段中时订阅端可统计延迟
+//	{{timestamp_ms}}        发送时间（Unix毫秒）
+//	{{time}}                发送时间（RFC 3339格式）
+//	{{rand_int MIN MAX}}    [MIN, MAX]范围内的随机整数
+//	{{rand_string N}}       N个随机字母和数字
+
+// 随机字符串使用的字符
+const randomAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// segment 模板的一段，literal不为空时为原样输出的文本，否则为占位符
+type segment struct {
+	literal string
+	name    string
+	min     int64 // rand_int：最小值
+	max     int64 // rand_int：最大值
+	length  int   // rand_string：长度
+}
+
+// parseTemplate 将模板拆分为文本和占位符
+func parseTemplate(template string) ([]segment, error) {
+	var segments []segment
+	for template != "" {
+		start := strings.Index(template, "{{")
+		if start < 0 {
+			segments = append(segments, segment{literal: template})
+			break
+		}
+		if start > 0 {
+			segments = append(segments, segment{literal: template[:start]})
+		}
+
+		end := strings.Index(template[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in payload template")
+		}
+		placeholder, err := parsePlaceholder(template[start+2 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, placeholder)
+		template = template[start+end+2:]
+	}
+	return segments, nil
+}
+
+// parsePlaceholder 解析占位符的名称和参数
+func parsePlaceholder(text string) (segment, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return segment{}, fmt.Errorf("empty placeholder in payload template")
+	}
+
+	s := segment{name: fields[0]}
+	args := fields[1:]
+	switch s.name {
+	case "client_id", "seq", "timestamp", "timestamp_ms", "time":
+		if len(args) != 0 {
+			return segment{}, fmt.Errorf("placeholder %s takes no arguments", s.name)
+		}
+	case "rand_int":
+		if len(args) != 2 {
+			return segment{}, fmt.Errorf("placeholder rand_int requires MIN and MAX")
+		}
+		var err1, err2 error
+		s.min, err1 = strconv.ParseInt(args[0], 10, 64)
+		s.max, err2 = strconv.ParseInt(args[1], 10, 64)
+		if err1 != nil || err2 != nil || s.min > s.max {
+			return segment{}, fmt.Errorf("invalid rand_int range: %s %s", args[0], args[1])
+		}
+	case "rand_string":
+		if len(args) != 1 {
+			return segment{}, fmt.Errorf("placeholder rand_string requires a length")
+		}
+		length, err := strconv.Atoi(args[0])
+		if err != nil || length < 0 {
+			return segment{}, fmt.Errorf("invalid rand_string length: %s", args[0])
+		}
+		s.length = length
+	default:
+		return segment{}, fmt.Errorf("unknown placeholder in payload template: %s", s.name)
+	}
+	return s, nil
+}
+
+// templateGenerator 按模板生成消息
+type templateGenerator struct {
+	clientID string
+	segments []segment
+	rng      *mathrand.ChaCha8
+}
+
+func (g *templateGenerator) Next(seq uint64) []byte {
+	now := time.Now()
+	payload := make([]byte, 0, 256)
+	for _, s := range g.segments {
+		switch s.name {
+		case "":
+			payload = append(payload, s.literal...)
+		case "client_id":
+			payload = append(payload, g.clientID...)
+		case "seq":
+			payload = strconv.AppendUint(payload, seq, 10)
+		case "timestamp":
+			payload = strconv.AppendInt(payload, now.UnixNano(), 10)
+		case "timestamp_ms":
+			payload = strconv.AppendInt(payload, now.UnixMilli(), 10)
+		case "time":
+			payload = now.AppendFormat(payload, time.RFC3339Nano)
+		case "rand_int":
+			value := g.rng.Uint64()
+			// 范围覆盖整个int64时span溢出为0，直接使用随机数
+			if span := uint64(s.max-s.min) + 1; span != 0 {
+				value %= span
+			}
+			payload = strconv.AppendInt(payload, s.min+int64(value), 10)
+		case "rand_string":
+			for i := 0; i < s.length; i++ {
+				payload = append(payload, randomAlphabet[g.rng.Uint64()%uint64(len(randomAlphabet))])
+			}
+		}
+	}
+	return payload
+}
@@ -1,19 +1,39 @@
 package performance
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"mqttbench/internal/db"
+	"mqttbench/internal/master"
+	"mqttbench/internal/metrics"
 	"mqttbench/internal/models"
+	"mqttbench/internal/workload"
 )
 
+// 停止后等待slave上报最终结果的时间
+const resultTimeout = 15 * time.Second
+
 // Service 性能测试服务
 type Service struct {
 	performanceGorm *models.PerformanceGorm
+	masterServer    *master.Server
+	// 正在运行的测试，用于停止测试
+	running      map[int64]context.CancelFunc
+	runningMutex sync.Mutex
 }
 
 // NewService 创建新的性能测试服务实例
-func NewService() *Service {
+func NewService(masterServer *master.Server) *Service {
 	return &Service{
 		performanceGorm: &models.PerformanceGorm{},
+		masterServer:    masterServer,
+		running:         make(map[int64]context.CancelFunc),
 	}
 }
 
@@ -21,3 +41,309 @@ func NewService() *Service {
 func (s *Service) GetPerformanceTests() ([]*models.Performance, error) {
 	return s.performanceGorm.GetAll(db.DB)
 }
+
+// GetPerformanceTest 获取指定的性能测试记录
+func (s *Service) GetPerformanceTest(id int64) (*models.Performance, error) {
+	return s.performanceGorm.GetByID(db.DB, id)
+}
+
+// IsRunning 检查性能测试是否正在运行
+func (s *Service) IsRunning(id int64) bool {
+	s.runningMutex.Lock()
+	defer s.runningMutex.Unlock()
+
+	_, exists := s.running[id]
+	return exists
+}
+
+// CreatePerformanceTest 创建性能测试记录
+func (s *Service) CreatePerformanceTest(testDuration int, messageRate int, messageSize int, qosLevel int, slaveIDs []int64) (*models.Performance, error) {
+	if testDuration <= 0 {
+		return nil, fmt.Errorf("invalid test duration: %d", testDuration)
+	}
+	if messageRate <= 0 {
+		return nil, fmt.Errorf("invalid message rate: %d", messageRate)
+	}
+	if qosLevel < 0 || qosLevel > 2 {
+		return nil, fmt.Errorf("invalid qos level: %d", qosLevel)
+	}
+	if len(slaveIDs) == 0 {
+		return nil, fmt.Errorf("no slaves selected")
+	}
+
+	ids := make([]string, 0, len(slaveIDs))
+	for _, id := range slaveIDs {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+
+	performance := &models.Performance{
+		TestDuration: testDuration,
+		MessageRate:  messageRate,
+		MessageSize:  max(messageSize, 0),
+		QoSLevel:     qosLevel,
+		SlaveIDs:     strings.Join(ids, ","),
+		Status:       models.PerformanceStatusPending,
+	}
+
+	if err := s.performanceGorm.Insert(db.DB, performance); err != nil {
+		return nil, err
+	}
+	return performance, nil
+}
+
+// StartPerformanceTest 启动性能测试，测试在后台运行TestDuration秒
+func (s *Service) StartPerformanceTest(id int64) error {
+	performance, err := s.performanceGorm.GetByID(db.DB, id)
+	if err != nil {
+		return err
+	}
+
+	slaveIDs, err := parseSlaveIDs(performance.SlaveIDs)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.runningMutex.Lock()
+	if _, exists := s.running[id]; exists {
+		s.runningMutex.Unlock()
+		cancel()
+		return fmt.Errorf("performance test %d is already running", id)
+	}
+	s.running[id] = cancel
+	s.runningMutex.Unlock()
+
+	// 重置上一次运行的结果
+	*performance = models.Performance{
+		ID:           performance.ID,
+		TestDuration: performance.TestDuration,
+		MessageRate:  performance.MessageRate,
+		MessageSize:  performance.MessageSize,
+		QoSLevel:     performance.QoSLevel,
+		SlaveIDs:     performance.SlaveIDs,
+		CreatedAt:    performance.CreatedAt,
+		Status:       models.PerformanceStatusRunning,
+		StartTime:    time.Now(),
+	}
+	if err := s.performanceGorm.Update(db.DB, performance); err != nil {
+		s.finish(id)
+		return err
+	}
+
+	go s.run(ctx, performance, slaveIDs)
+	return nil
+}
+
+// StopPerformanceTest 提前停止正在运行的性能测试
+func (s *Service) StopPerformanceTest(id int64) error {
+	s.runningMutex.Lock()
+	cancel, exists := s.running[id]
+	s.runningMutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("performance test %d is not running", id)
+	}
+
+	cancel()
+	return nil
+}
+
+// DeletePerformanceTest 删除性能测试记录，运行中的测试不能删除
+func (s *Service) DeletePerformanceTest(id int64) error {
+	s.runningMutex.Lock()
+	_, exists := s.running[id]
+	s.runningMutex.Unlock()
+
+	if exists {
+		return fmt.Errorf("performance test %d is running, stop it first", id)
+	}
+
+	return s.performanceGorm.Delete(db.DB, id)
+}
+
+// run 驱动slave执行测试，到时或被停止后汇总结果
+func (s *Service) run(ctx context.Context, performance *models.Performance, slaveIDs []int64) {
+	defer s.finish(performance.ID)
+
+	log.Printf("Performance test %d started: duration=%ds, rate=%d/s, size=%d, qos=%d, slaves=%v",
+		performance.ID, performance.TestDuration, performance.MessageRate, performance.MessageSize, performance.QoSLevel, slaveIDs)
+
+	started, err := s.startSlaves(performance, slaveIDs)
+	if err != nil {
+		log.Printf("Performance test %d failed to start: %v", performance.ID, err)
+		performance.Status = models.PerformanceStatusFailed
+		performance.ErrorMessage = err.Error()
+		performance.EndTime = time.Now()
+		s.save(performance)
+		return
+	}
+
+	// 等待测试时间结束或被停止
+	status := models.PerformanceStatusCompleted
+	timer := time.NewTimer(time.Duration(performance.TestDuration) * time.Second)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+		status = models.PerformanceStatusStopped
+	}
+
+	// 停止前清除旧结果，以便收集停止后的最终结果
+	for _, slaveID := range started {
+		s.masterServer.ClearConfigResult(int(slaveID))
+	}
+	for _, slaveID := range started {
+		if err := s.masterServer.StopSlave(slaveID); err != nil {
+			log.Printf("Performance test %d failed to stop slave %d: %v", performance.ID, slaveID, err)
+		}
+	}
+	performance.EndTime = time.Now()
+
+	results := s.collectResults(started)
+	aggregate(performance, results)
+	performance.Status = status
+	if len(results) < len(started) {
+		performance.ErrorMessage = fmt.Sprintf("received results from %d of %d slaves", len(results), len(started))
+	}
+	s.save(performance)
+
+	log.Printf("Performance test %d %s: published=%d, received=%d, throughput=%.2f/s, p99=%.3fms",
+		performance.ID, performance.Status, performance.PublishedCount, performance.ReceivedCount, performance.Throughput, performance.LatencyP99)
+}
+
+// startSlaves 按测试参数启动slave，返回成功启动的slave
+func (s *Service) startSlaves(performance *models.Performance, slaveIDs []int64) ([]int64, error) {
+	slaves := make([]*models.Slave, 0, len(slaveIDs))
+	totalClients := 0
+	for _, slaveID := range slaveIDs {
+		slave, err := s.masterServer.GetSlaveModel().GetByID(slaveID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting slave %d: %v", slaveID, err)
+		}
+		if slave == nil {
+			return nil, fmt.Errorf("slave %d not found", slaveID)
+		}
+		if slave.Step <= 0 {
+			return nil, fmt.Errorf("slave %d has no clients configured", slaveID)
+		}
+		slaves = append(slaves, slave)
+		totalClients += slave.Step
+	}
+
+	// MessageRate为所有客户端的总速率，平均分配到每个客户端
+	perClientRate := float64(performance.MessageRate) / float64(totalClients)
+
+	started := make([]int64, 0, len(slaves))
+	var errs []string
+	for _, slave := range slaves {
+		configData := master.NewConfigData(slave)
+		// 保留slave自身的订阅配置，只覆盖发布参数
+		if configData.Mode != workload.ModePublish {
+			configData.Mode = workload.ModeBoth
+		}
+		configData.PubRate = perClientRate
+		configData.PayloadSize = performance.MessageSize
+		configData.PubQoS = performance.QoSLevel
+
+		s.masterServer.ClearConfigResult(int(slave.ID))
+		if err := s.masterServer.StartSlaveWithConfig(slave, configData); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		started = append(started, slave.ID)
+	}
+
+	if len(started) == 0 {
+		return nil, fmt.Errorf("no slave started: %s", strings.Join(errs, "; "))
+	}
+	return started, nil
+}
+
+// collectResults 等待slave上报停止后的最终结果
+func (s *Service) collectResults(slaveIDs []int64) map[int64]*master.ConfigResult {
+	results := make(map[int64]*master.ConfigResult)
+	deadline := time.Now().Add(resultTimeout)
+
+	for len(results) < len(slaveIDs) && time.Now().Before(deadline) {
+		for _, slaveID := range slaveIDs {
+			if _, ok := results[slaveID]; ok {
+				continue
+			}
+			if result := s.masterServer.GetConfigResult(int(slaveID)); result != nil && result.Stopped {
+				results[slaveID] = result
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return results
+}
+
+// aggregate 汇总所有slave的结果到测试记录
+func aggregate(performance *models.Performance, results map[int64]*master.ConfigResult) {
+	latencies := make([]*metrics.LatencyStats, 0, len(results))
+	sequence := metrics.SequenceStats{}
+	for _, result := range results {
+		performance.PublishedCount += result.PublishCount
+		performance.PublishFailures += result.PublishFailureCount
+		performance.PublishSkipped += result.PublishSkippedCount
+		performance.ReceivedCount += result.ReceivedCount
+		latencies = append(latencies, result.Latency)
+		sequence.Add(result.Sequence)
+	}
+	performance.LostCount = sequence.Lost
+	performance.DuplicateCount = sequence.Duplicates
+	performance.OutOfOrderCount = sequence.OutOfOrder
+
+	if elapsed := performance.EndTime.Sub(performance.StartTime).Seconds(); elapsed > 0 {
+		performance.Throughput = float64(performance.PublishedCount) / elapsed
+	}
+
+	latency := metrics.MergeLatencyStats(latencies...)
+	performance.LatencyCount = latency.Count
+	performance.LatencyP50 = latency.P50
+	performance.LatencyP90 = latency.P90
+	performance.LatencyP99 = latency.P99
+	performance.LatencyP999 = latency.P999
+	performance.LatencyMax = latency.Max
+}
+
+// save 保存测试记录
+func (s *Service) save(performance *models.Performance) {
+	if err := s.performanceGorm.Update(db.DB, performance); err != nil {
+		log.Printf("Failed to save performance test %d: %v", performance.ID, err)
+	}
+}
+
+// finish 将测试从运行列表中移除
+func (s *Service) finish(id int64) {
+	s.runningMutex.Lock()
+	defer s.runningMutex.Unlock()
+
+	if cancel, exists := s.running[id]; exists {
+		cancel()
+		delete(s.running, id)
+	}
+}
+
+// parseSlaveIDs 解析逗号分隔的slave ID
+func parseSlaveIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slave id %q: %v", part, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no slaves configured")
+	}
+	return ids, nil
+}
@@ -0,0 +1,85 @@
+package ramp
+
+import (
+	"fmt"
+	"time"
+)
+
+// 建连策略
+const (
+	Immediate = "immediate" // 同时建立所有连接（默认）
+	Rate      = "rate"      // 按固定速率（连接/秒）建立连接
+	Linear    = "linear"    // 在指定时长内均匀建立所有连接
+	Batch     = "batch"     // 分批建立连接，每批完成后暂停指定时间
+)
+
+// Config 建连策略配置，master和slave共用
+type Config struct {
+	Strategy   string  `json:"strategy"`    // 建连策略，为空时为immediate
+	Rate       float64 `json:"rate"`        // rate策略：每秒建立的连接数
+	Duration   int     `json:"duration"`    // linear策略：建立所有连接的时长（秒）
+	BatchSize  int     `json:"batch_size"`  // batch策略：每批建立的连接数
+	BatchPause int     `json:"batch_pause"` // batch策略：两批之间暂停的时间（毫秒）
+}
+
+// Progress 建连进度，建连期间由slave定时上报给master
+type Progress struct {
+	SlaveID   int     `json:"slave_id"`
+	Strategy  string  `json:"strategy"`
+	Target    int     `json:"target"`    // 需要建立的连接数
+	Attempted int     `json:"attempted"` // 已开始建立的连接数
+	Connected int     `json:"connected"` // 成功建立的连接数
+	Failed    int     `json:"failed"`    // 建立失败的连接数
+	Elapsed   float64 `json:"elapsed"`   // 已用时间（秒）
+	Rate      float64 `json:"rate"`      // 最近一个上报间隔内每秒成功建立的连接数，结束时为整个建连过程的平均值
+	Done      bool    `json:"done"`      // 建连是否已结束
+	Aborted   bool    `json:"aborted"`   // 是否因停止命令提前结束
+}
+
+// Validate 校验建连策略配置
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	switch c.Strategy {
+	case "", Immediate:
+	case Rate:
+		if c.Rate <= 0 {
+			return fmt.Errorf("invalid ramp rate %v, must be greater than 0", c.Rate)
+		}
+	case Linear:
+		if c.Duration <= 0 {
+			return fmt.Errorf("invalid ramp duration %d, must be greater than 0", c.Duration)
+		}
+	case Batch:
+		if c.BatchSize <= 0 {
+			return fmt.Errorf("invalid ramp batch size %d, must be greater than 0", c.BatchSize)
+		}
+		if c.BatchPause < 0 {
+			return fmt.Errorf("invalid ramp batch pause %d, must not be negative", c.BatchPause)
+		}
+	default:
+		return fmt.Errorf("unknown ramp strategy: %s", c.Strategy)
+	}
+	return nil
+}
+
+// StrategyName 返回实际使用的策略，为nil时为immediate
+func (c *Config) StrategyName() string {
+	if c == nil || c.Strategy == "" {
+		return Immediate
+	}
+	return c.Strategy
+}
+
+// Interval 返回rate和linear策略下相邻两个连接开始的间隔，其他策略为0
+func (c *Config) Interval(total int) time.Duration {
+	switch c.StrategyName() {
+	case Rate:
+		return time.Duration(float64(time.Second) / c.Rate)
+	case Linear:
+		return time.Duration(c.Duration) * time.Second / time.Duration(max(total, 1))
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package slave
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"mqttbench/internal/broker"
+)
+
+// brokerCounters 一个broker节点的计数器，客户端持有指针以便收发消息时直接计数
+type brokerCounters struct {
+	connected atomic.Int64
+	failed    atomic.Int64
+	published atomic.Int64
+	received  atomic.Int64
+}
+
+// 各broker节点的计数器，连接数随客户端连接和断开变化，其余计数在每次启动时重置
+var (
+	brokerStatsMutex sync.Mutex
+	brokerStats      = make(map[string]*brokerCounters)
+)
+
+// ValidateBrokers 校验broker节点列表和分配方式
+func (c *ConfigData) ValidateBrokers() error {
+	return broker.ValidateNodes(c.Brokers, c.BrokerPolicy)
+}
+
+// BrokerNodes 返回broker节点列表，未设置节点列表时只有MqttHost:MqttPort一个节点
+func (c *ConfigData) BrokerNodes() []broker.Node {
+	if len(c.Brokers) == 0 {
+		return []broker.Node{{Host: c.MqttHost, Port: c.MqttPort, Weight: 1}}
+	}
+	return c.Brokers
+}
+
+// PickBroker 按分配方式为客户端选择broker节点，index为客户端在本slave中的序号
+func (c *ConfigData) PickBroker(index int, clientID string) broker.Node {
+	return broker.Pick(c.BrokerNodes(), c.BrokerPolicy, index, clientID)
+}
+
+// brokerCountersOf 获取broker节点的计数器，不存在时创建
+func brokerCountersOf(node broker.Node) *brokerCounters {
+	address := node.Address()
+
+	brokerStatsMutex.Lock()
+	defer brokerStatsMutex.Unlock()
+
+	counters, ok := brokerStats[address]
+	if !ok {
+		counters = &brokerCounters{}
+		brokerStats[address] = counters
+	}
+	return counters
+}
+
+// CountBrokerFailed 记录broker节点上一个客户端建立连接失败
+func CountBrokerFailed(node broker.Node) {
+	brokerCountersOf(node).failed.Add(1)
+}
+
+// GetBrokerStats 获取各broker节点的统计，按地址排序，忽略所有计数均为0的节点
+func GetBrokerStats() []broker.Stats {
+	brokerStatsMutex.Lock()
+	defer brokerStatsMutex.Unlock()
+
+	result := make([]broker.Stats, 0, len(brokerStats))
+	for address, counters := range brokerStats {
+		stats := broker.Stats{
+			Broker:    address,
+			Connected: counters.connected.Load(),
+			Failed:    counters.failed.Load(),
+			Published: counters.published.Load(),
+			Received:  counters.received.Load(),
+		}
+		if stats.Connected != 0 || stats.Failed != 0 || stats.Published != 0 || stats.Received != 0 {
+			result = append(result, stats)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Broker < result[j].Broker })
+	return result
+}
+
+// ResetBrokerStats 重置各broker节点本次运行的失败数和消息数，连接数随客户端断开自然归零
+func ResetBrokerStats() {
+	brokerStatsMutex.Lock()
+	defer brokerStatsMutex.Unlock()
+
+	for _, counters := range brokerStats {
+		counters.failed.Store(0)
+		counters.published.Store(0)
+		counters.received.Store(0)
+	}
+}
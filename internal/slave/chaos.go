@@ -0,0 +1,400 @@
+package slave
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mqttbench/internal/chaos"
+	"mqttbench/internal/metrics"
+)
+
+const (
+	// chaosProgressInterval 执行期间上报进度的间隔
+	chaosProgressInterval = time.Second
+	// chaosPauseGrace 恢复读取后等待连接断开被发现的时间，暂停期间broker断开的连接在恢复读取时才会读到EOF
+	chaosPauseGrace = time.Second
+)
+
+// chaosRun 一次故障注入的计数
+type chaosRun struct {
+	ctx          context.Context // 中止时取消，不再重连被断开的客户端
+	action       chaos.Action
+	start        time.Time
+	reconnect    *metrics.Histogram
+	rounds       atomic.Int64
+	affected     atomic.Int64
+	disconnected atomic.Int64
+	reconnected  atomic.Int64
+}
+
+// chaosDisruption 一个客户端受到的一次故障注入，客户端重连后清除
+type chaosDisruption struct {
+	run    *chaosRun
+	mutex  sync.Mutex
+	lostAt time.Time // 连接断开的时间，为零值时连接尚未断开
+}
+
+// chaosConn 可注入故障的网络连接，包装到broker的连接
+type chaosConn struct {
+	net.Conn
+	mutex     sync.Mutex
+	resume    chan struct{} // 暂停读取时创建，恢复读取时关闭
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var (
+	// chaosReconnectHistogram 本次运行所有故障注入的重连耗时
+	chaosReconnectHistogram = metrics.NewHistogram()
+
+	// 正在执行的故障注入，同一时间只执行一个
+	chaosMutex   sync.Mutex
+	chaosCancel  context.CancelFunc
+	chaosRunning int64 // 正在执行的动作ID
+)
+
+// newChaosConn 包装网络连接
+func newChaosConn(conn net.Conn) *chaosConn {
+	return &chaosConn{Conn: conn, closed: make(chan struct{})}
+}
+
+// Read 暂停期间阻塞，直到恢复读取或连接关闭
+func (c *chaosConn) Read(p []byte) (int, error) {
+	c.mutex.Lock()
+	resume := c.resume
+	c.mutex.Unlock()
+
+	if resume != nil {
+		select {
+		case <-resume:
+		case <-c.closed:
+			return 0, net.ErrClosed
+		}
+	}
+	return c.Conn.Read(p)
+}
+
+// Close 关闭连接，唤醒暂停中的读取
+func (c *chaosConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// pause 暂停读取指定时长，已在暂停时忽略
+func (c *chaosConn) pause(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.resume != nil {
+		return
+	}
+	resume := make(chan struct{})
+	c.resume = resume
+	time.AfterFunc(d, func() {
+		c.mutex.Lock()
+		c.resume = nil
+		c.mutex.Unlock()
+		close(resume)
+	})
+}
+
+// newChaosRun 开始记录一次故障注入
+func newChaosRun(ctx context.Context, action chaos.Action) *chaosRun {
+	return &chaosRun{ctx: ctx, action: action, start: time.Now(), reconnect: metrics.NewHistogram()}
+}
+
+// pending 返回尚未重连的连接数
+func (r *chaosRun) pending() int64 {
+	return r.disconnected.Load() - r.reconnected.Load()
+}
+
+// report 返回当前进度
+func (r *chaosRun) report() chaos.Report {
+	report := chaos.Report{
+		ActionID:     r.action.ID,
+		Type:         r.action.Type,
+		Rounds:       r.rounds.Load(),
+		Affected:     r.affected.Load(),
+		Disconnected: r.disconnected.Load(),
+		Reconnected:  r.reconnected.Load(),
+		Pending:      r.pending(),
+		Elapsed:      time.Since(r.start).Seconds(),
+	}
+	if report.Reconnected > 0 {
+		stats := r.reconnect.Stats()
+		stats.Buckets = nil
+		report.ReconnectTime = &stats
+	}
+	return report
+}
+
+// lost 记录连接断开的时间，只记录第一次
+func (d *chaosDisruption) lost(at time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.lostAt.IsZero() {
+		return
+	}
+	d.lostAt = at
+	d.run.disconnected.Add(1)
+}
+
+// isLost 返回连接是否已断开
+func (d *chaosDisruption) isLost() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return !d.lostAt.IsZero()
+}
+
+// reconnected 记录从连接断开到重新连接的耗时
+func (d *chaosDisruption) reconnected() {
+	d.mutex.Lock()
+	lostAt := d.lostAt
+	d.mutex.Unlock()
+
+	if lostAt.IsZero() {
+		return
+	}
+	elapsed := time.Since(lostAt)
+	d.run.reconnect.Record(elapsed)
+	chaosReconnectHistogram.Record(elapsed)
+	d.run.reconnected.Add(1)
+}
+
+// disrupt 对已连接的客户端执行故障注入，客户端未连接或上一次故障尚未恢复时返回false
+func (m *MQTTClient) disrupt(run *chaosRun) bool {
+	conn := m.conn.Load()
+	if conn == nil || !m.IsConnected() {
+		return false
+	}
+	disruption := &chaosDisruption{run: run}
+	if !m.disruption.CompareAndSwap(nil, disruption) {
+		return false
+	}
+	run.affected.Add(1)
+
+	switch run.action.Type {
+	case chaos.Pause:
+		conn.pause(time.Duration(run.action.Duration) * time.Millisecond)
+	case chaos.Disconnect:
+		disruption.lost(time.Now())
+		go m.reconnect(run)
+	default:
+		disruption.lost(time.Now())
+		conn.Close()
+	}
+	return true
+}
+
+// reconnect 由客户端发送DISCONNECT断开连接后重新连接，broker不会发布遗嘱消息。
+// 主动断开会停止自动重连，因此需要重新调用Connect
+func (m *MQTTClient) reconnect(run *chaosRun) {
+	m.mutex.RLock()
+	client := m.client
+	m.mutex.RUnlock()
+
+	client.Disconnect()
+	m.setConnected(false)
+	if run.ctx.Err() != nil {
+		return
+	}
+	if err := client.Connect(120 * time.Second); err != nil {
+		log.Printf("故障注入 %d 断开的客户端重新连接失败: %v", run.action.ID, err)
+	}
+}
+
+// endDisruption 连接在故障注入后没有断开时清除记录，不计入重连
+func (m *MQTTClient) endDisruption(run *chaosRun) {
+	disruption := m.disruption.Load()
+	if disruption != nil && disruption.run == run && !disruption.isLost() {
+		m.disruption.CompareAndSwap(disruption, nil)
+	}
+}
+
+// StartChaos 在后台对clients执行故障注入，执行期间和结束时通过report上报进度。
+// 同一时间只执行一个动作，上一个动作未结束时返回错误
+func StartChaos(clients []*MQTTClient, action chaos.Action, report func(chaos.Report)) error {
+	if err := action.Validate(); err != nil {
+		return err
+	}
+
+	chaosMutex.Lock()
+	defer chaosMutex.Unlock()
+	if chaosCancel != nil {
+		return fmt.Errorf("chaos action %d is still running", chaosRunning)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	chaosCancel = cancel
+	chaosRunning = action.ID
+
+	go func() {
+		defer func() {
+			chaosMutex.Lock()
+			chaosCancel = nil
+			chaosMutex.Unlock()
+			cancel()
+		}()
+		runChaos(ctx, clients, action, report)
+	}()
+	return nil
+}
+
+// StopChaos 中止正在执行的故障注入，不再等待客户端重连
+func StopChaos() {
+	chaosMutex.Lock()
+	defer chaosMutex.Unlock()
+
+	if chaosCancel != nil {
+		chaosCancel()
+	}
+}
+
+// runChaos 执行故障注入并等待受影响的客户端重连，直到超时或被中止
+func runChaos(ctx context.Context, clients []*MQTTClient, action chaos.Action, report func(chaos.Report)) {
+	run := newChaosRun(ctx, action)
+	log.Printf("开始故障注入 %d: %s, 比例%v%%", action.ID, action.Type, action.Percent)
+
+	// 定时上报进度
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(chaosProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progressDone:
+				return
+			case <-ticker.C:
+				report(run.report())
+			}
+		}
+	}()
+
+	sleep := func(d time.Duration) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+
+	duration := time.Duration(action.Duration) * time.Millisecond
+	aborted := false
+	switch action.Type {
+	case chaos.Flap:
+		interval := time.Duration(action.Interval) * time.Millisecond
+		for round := time.Duration(0); round < duration; round += interval {
+			disruptClients(clients, run)
+			if !sleep(interval) {
+				aborted = true
+				break
+			}
+		}
+	case chaos.Pause:
+		selected := disruptClients(clients, run)
+		if !sleep(duration + chaosPauseGrace) {
+			aborted = true
+		}
+		for _, client := range selected {
+			client.endDisruption(run)
+		}
+	default:
+		disruptClients(clients, run)
+	}
+
+	// 等待断开的连接重连
+	timeout := time.Duration(action.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = chaos.DefaultTimeout * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for !aborted && run.pending() > 0 && time.Now().Before(deadline) {
+		if !sleep(100 * time.Millisecond) {
+			aborted = true
+		}
+	}
+
+	close(progressDone)
+	final := run.report()
+	final.Done = true
+	final.Aborted = aborted
+	report(final)
+	log.Printf("故障注入 %d 结束: 影响%d个连接, 断开%d个, 重连%d个, 未重连%d个",
+		action.ID, final.Affected, final.Disconnected, final.Reconnected, final.Pending)
+}
+
+// disruptClients 随机选择比例内的已连接客户端执行一轮故障注入，返回受影响的客户端
+func disruptClients(clients []*MQTTClient, run *chaosRun) []*MQTTClient {
+	connected := make([]*MQTTClient, 0, len(clients))
+	for _, client := range clients {
+		if client.IsConnected() {
+			connected = append(connected, client)
+		}
+	}
+	rand.Shuffle(len(connected), func(i, j int) { connected[i], connected[j] = connected[j], connected[i] })
+	count := int(math.Ceil(float64(len(connected)) * run.action.Percent / 100))
+
+	selected := make([]*MQTTClient, 0, count)
+	for _, client := range connected[:count] {
+		if client.disrupt(run) {
+			selected = append(selected, client)
+		}
+	}
+	run.rounds.Add(1)
+	return selected
+}
+
+// GetChaosReconnectStats 获取本次运行故障注入后的重连耗时统计
+func GetChaosReconnectStats() metrics.LatencyStats {
+	return chaosReconnectHistogram.Stats()
+}
+
+// ResetChaosStats 重置故障注入的重连耗时统计
+func ResetChaosStats() {
+	chaosReconnectHistogram.Reset()
+}
+
+// SendChaosReport 发送故障注入进度到master，控制通道已连接时通过控制通道发送，否则使用HTTP
+func SendChaosReport(masterIP string, masterPort int, report chaos.Report) error {
+	if err := SendControlMessage("chaos_report", report); err == nil {
+		return nil
+	}
+
+	// 将数据序列化为JSON
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chaos report: %v", err)
+	}
+
+	// 构造master的故障注入进度URL
+	reportURL := fmt.Sprintf("http://%s/chaos-report", net.JoinHostPort(masterIP, strconv.Itoa(masterPort)))
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
+	// 发送POST请求
+	resp, err := client.Post(reportURL, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to send chaos report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 检查响应状态
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("chaos report failed with status code: %d", resp.StatusCode)
+	}
+	return nil
+}
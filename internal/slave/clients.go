@@ -0,0 +1,215 @@
+package slave
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mqttbench/internal/broker"
+	"mqttbench/internal/diagnostics"
+)
+
+// 查询客户端记录时默认和最多返回的记录数
+const (
+	defaultClientQueryLimit = 100
+	maxClientQueryLimit     = 1000
+)
+
+// clientTracker 记录一个客户端的连接生命周期，连接回调和Connect并发更新
+type clientTracker struct {
+	mutex  sync.Mutex
+	record diagnostics.Record
+	// 本次连接过程中是否已记录过连接尝试的错误
+	attemptFailed bool
+}
+
+// 各客户端的记录，在每次启动时重置
+var (
+	clientRecordsMutex sync.RWMutex
+	clientRecords      = make(map[string]*clientTracker)
+)
+
+// trackClient 开始记录客户端的连接，同一客户端ID已有记录时覆盖
+func trackClient(clientID string, broker broker.Node, sourceIP string) *clientTracker {
+	clientRecordsMutex.Lock()
+	defer clientRecordsMutex.Unlock()
+
+	tracker := &clientTracker{
+		record: diagnostics.Record{
+			ClientID:  clientID,
+			Broker:    broker.Address(),
+			SourceIP:  sourceIP,
+			State:     diagnostics.StateConnecting,
+			UpdatedAt: time.Now(),
+		},
+	}
+	clientRecords[clientID] = tracker
+	return tracker
+}
+
+// update 在持有锁的情况下修改记录，并刷新更新时间
+func (t *clientTracker) update(fn func(record *diagnostics.Record)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	fn(&t.record)
+	t.record.UpdatedAt = time.Now()
+}
+
+// setError 记录错误及其原因和类别，调用者需持有锁
+func (t *clientTracker) setError(err error, reason string) {
+	t.record.LastError = err.Error()
+	t.record.FailureReason = reason
+	t.record.ErrorCategory = diagnostics.Category(reason)
+}
+
+// tcpConnected 记录TCP建连耗时
+func (t *clientTracker) tcpConnected(elapsed time.Duration) {
+	t.update(func(record *diagnostics.Record) {
+		record.TCPConnectMs = durationMs(elapsed)
+	})
+}
+
+// connectAttemptFailed 记录一次连接尝试失败的原因，客户端随后会重试。
+// 客户端已失败或已断开时忽略停止重连引起的错误
+func (t *clientTracker) connectAttemptFailed(err error) {
+	t.update(func(record *diagnostics.Record) {
+		if record.State == diagnostics.StateFailed || record.State == diagnostics.StateDisconnected {
+			return
+		}
+		t.attemptFailed = true
+		t.setError(err, ClassifyFailure(err))
+	})
+}
+
+// connected 记录首次连接成功及从开始连接到收到CONNACK的耗时
+func (t *clientTracker) connected(elapsed time.Duration) {
+	t.update(func(record *diagnostics.Record) {
+		record.ConnackMs = durationMs(elapsed)
+	})
+	t.up()
+}
+
+// up 记录连接已建立，包括自动重连成功
+func (t *clientTracker) up() {
+	t.update(func(record *diagnostics.Record) {
+		record.State = diagnostics.StateConnected
+		t.attemptFailed = false
+	})
+}
+
+// subscribed 记录连接建立后完成所有订阅的耗时
+func (t *clientTracker) subscribed(elapsed time.Duration) {
+	t.update(func(record *diagnostics.Record) {
+		record.SubscribeMs = durationMs(elapsed)
+	})
+}
+
+// subscribeFailed 记录订阅失败，连接状态不变
+func (t *clientTracker) subscribeFailed(err error) {
+	t.update(func(record *diagnostics.Record) {
+		t.setError(err, diagnostics.FailureSubscribe)
+	})
+	countFailure(diagnostics.FailureSubscribe)
+}
+
+// reconnecting 记录开始一次自动重连
+func (t *clientTracker) reconnecting() {
+	t.update(func(record *diagnostics.Record) {
+		record.State = diagnostics.StateReconnecting
+		record.Reconnects++
+	})
+}
+
+// lost 记录连接丢失的原因
+func (t *clientTracker) lost(err error) {
+	t.update(func(record *diagnostics.Record) {
+		if record.State != diagnostics.StateDisconnected {
+			record.State = diagnostics.StateReconnecting
+		}
+		if err != nil {
+			t.setError(err, ClassifyFailure(err))
+		}
+	})
+}
+
+// failed 记录首次连接失败并按原因计数。连接过程中已记录过连接尝试的错误时保留该错误，
+// 它比最终的超时更能说明失败原因
+func (t *clientTracker) failed(err error, reason string) {
+	var counted string
+	t.update(func(record *diagnostics.Record) {
+		record.State = diagnostics.StateFailed
+		if !t.attemptFailed {
+			t.setError(err, reason)
+		}
+		counted = record.FailureReason
+	})
+	countFailure(counted)
+}
+
+// disconnected 记录客户端已主动断开，首次连接失败的客户端保持失败状态
+func (t *clientTracker) disconnected() {
+	t.update(func(record *diagnostics.Record) {
+		if record.State != diagnostics.StateFailed {
+			record.State = diagnostics.StateDisconnected
+		}
+	})
+}
+
+// snapshot 返回记录的副本
+func (t *clientTracker) snapshot() diagnostics.Record {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.record
+}
+
+// durationMs 将耗时转换为毫秒，保留小数
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// QueryClients 按过滤条件查询客户端记录
+func QueryClients(query diagnostics.Query) (diagnostics.QueryResult, error) {
+	if err := query.Validate(); err != nil {
+		return diagnostics.QueryResult{}, err
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultClientQueryLimit
+	}
+	limit = min(limit, maxClientQueryLimit)
+
+	clientRecordsMutex.RLock()
+	records := make([]diagnostics.Record, 0, len(clientRecords))
+	for _, tracker := range clientRecords {
+		records = append(records, tracker.snapshot())
+	}
+	clientRecordsMutex.RUnlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].ClientID < records[j].ClientID })
+
+	result := diagnostics.QueryResult{States: make(map[string]int), Records: []diagnostics.Record{}}
+	for _, record := range records {
+		result.States[record.State]++
+
+		if (query.ClientID != "" && !strings.Contains(record.ClientID, query.ClientID)) ||
+			(query.State != "" && record.State != query.State) ||
+			(query.Category != "" && record.ErrorCategory != query.Category) ||
+			(query.Broker != "" && record.Broker != query.Broker) {
+			continue
+		}
+		if result.Total >= query.Offset && len(result.Records) < limit {
+			result.Records = append(result.Records, record)
+		}
+		result.Total++
+	}
+	return result, nil
+}
+
+// ResetClientRecords 清空客户端记录
+func ResetClientRecords() {
+	clientRecordsMutex.Lock()
+	defer clientRecordsMutex.Unlock()
+
+	clientRecords = make(map[string]*clientTracker)
+}
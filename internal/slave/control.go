@@ -0,0 +1,137 @@
+package slave
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 控制通道参数
+const (
+	controlRetryInterval = 5 * time.Second  // 连接断开后的重连间隔
+	controlWriteTimeout  = 10 * time.Second // 单条消息的写超时
+	controlReadTimeout   = 90 * time.Second // 超过该时间未收到master的数据视为连接断开
+)
+
+// errControlNotConnected 控制通道未建立
+var errControlNotConnected = errors.New("control channel not connected")
+
+// 当前的控制通道连接，写操作需要持有controlMutex
+var (
+	controlConn  *websocket.Conn
+	controlMutex sync.Mutex
+)
+
+// StartControlChannel 向master建立WebSocket控制通道，断开后自动重连。
+// 连接由slave主动发起，master通过该连接下发命令，slave通过该连接发送心跳和结果，
+// 因此slave位于NAT或防火墙后也能被控制。slavePort为旧版TCP监听端口，供master回退使用
+func StartControlChannel(masterIP string, masterPort int, slaveID int, slavePort int, messageChan chan<- Message, configChan chan<- ConfigData) {
+	controlURL := url.URL{
+		Scheme:   "ws",
+		Host:     net.JoinHostPort(masterIP, strconv.Itoa(masterPort)),
+		Path:     "/control",
+		RawQuery: url.Values{"slave_id": {strconv.Itoa(slaveID)}, "port": {strconv.Itoa(slavePort)}}.Encode(),
+	}
+
+	go func() {
+		for {
+			if err := runControlChannel(controlURL.String(), messageChan, configChan); err != nil {
+				log.Printf("控制通道断开: %v，%v后重连", err, controlRetryInterval)
+			}
+			time.Sleep(controlRetryInterval)
+		}
+	}()
+}
+
+// runControlChannel 建立一次控制通道连接并读取消息，直到连接断开
+func runControlChannel(controlURL string, messageChan chan<- Message, configChan chan<- ConfigData) error {
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	conn, _, err := dialer.Dial(controlURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect control channel: %v", err)
+	}
+	defer conn.Close()
+
+	log.Printf("控制通道已连接: %s", controlURL)
+	setControlConn(conn)
+	defer setControlConn(nil)
+
+	conn.SetReadDeadline(time.Now().Add(controlReadTimeout))
+	conn.SetPingHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(controlReadTimeout))
+
+		controlMutex.Lock()
+		defer controlMutex.Unlock()
+		return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(controlWriteTimeout))
+	})
+
+	for {
+		_, reader, err := conn.NextReader()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(controlReadTimeout))
+
+		var msg Message
+		decoder := json.NewDecoder(reader)
+		decoder.UseNumber()
+		if err := decoder.Decode(&msg); err != nil {
+			log.Printf("解码控制消息错误: %v", err)
+			continue
+		}
+
+		result, err := dispatchMessage(msg, messageChan, configChan)
+
+		// 带ID的命令回复处理结果
+		if msg.ID != 0 {
+			if err := writeControlMessage(newReply(msg.ID, result, err)); err != nil {
+				log.Printf("发送命令回复失败: %v", err)
+			}
+		}
+	}
+}
+
+// setControlConn 设置当前的控制通道连接
+func setControlConn(conn *websocket.Conn) {
+	controlMutex.Lock()
+	defer controlMutex.Unlock()
+
+	controlConn = conn
+}
+
+// IsControlConnected 检查控制通道是否已连接
+func IsControlConnected() bool {
+	controlMutex.Lock()
+	defer controlMutex.Unlock()
+
+	return controlConn != nil
+}
+
+// SendControlMessage 通过控制通道向master发送消息，未连接时返回错误
+func SendControlMessage(msgType string, content interface{}) error {
+	return writeControlMessage(Message{Type: msgType, Content: content})
+}
+
+// writeControlMessage 通过控制通道发送消息
+func writeControlMessage(msg Message) error {
+	controlMutex.Lock()
+	defer controlMutex.Unlock()
+
+	if controlConn == nil {
+		return errControlNotConnected
+	}
+
+	controlConn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	if err := controlConn.WriteJSON(msg); err != nil {
+		return fmt.Errorf("failed to send %s over control channel: %v", msg.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package slave
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"mqttbench/internal/broker"
+	"mqttbench/internal/metrics"
+)
+
+// MQTT连接耗时直方图，从发起连接到收到CONNACK，不随每次运行重置
+var connectHistogram = metrics.NewHistogram()
+
+// GetConnectLatencyStats 获取MQTT连接耗时统计
+func GetConnectLatencyStats() metrics.LatencyStats {
+	return connectHistogram.Stats()
+}
+
+// MetricsHandler 以Prometheus文本格式导出slave指标。
+// 消息和ACK计数器在每次启动时重置，Prometheus会将其识别为计数器重置
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+
+	p := metrics.NewPromWriter(w)
+
+	p.Gauge("mqttbench_slave_clients_connected", "MQTT clients currently connected.", float64(GetConnectedClients()))
+	p.Gauge("mqttbench_slave_clients_expected", "MQTT clients the current configuration asks for.", float64(GetExpectedConnections()))
+
+	controlConnected := 0.0
+	if IsControlConnected() {
+		controlConnected = 1
+	}
+	p.Gauge("mqttbench_slave_control_channel_connected", "Whether the control channel to the master is connected.", controlConnected)
+
+	p.Counter("mqttbench_slave_messages_received_total", "Messages received by subscribing clients.", float64(GetMessageCount()))
+	p.Counter("mqttbench_slave_messages_published_total", "Messages published by publishing clients.", float64(GetPublishCount()))
+	p.Counter("mqttbench_slave_publish_failures_total", "Publishes that failed or timed out.", float64(GetPublishFailureCount()))
+	p.Counter("mqttbench_slave_publishes_skipped_total", "Publishes skipped because too many messages were awaiting acknowledgement.", float64(GetPublishSkippedCount()))
+	p.Counter("mqttbench_slave_acks_sent_total", "ACK messages sent.", float64(GetAckMessageCount()))
+	p.Counter("mqttbench_slave_ack_failures_total", "ACK messages that failed or timed out.", float64(GetAckFailureCount()))
+	p.Counter("mqttbench_slave_reconnects_total", "Automatic reconnect attempts after a lost connection.", float64(GetReconnectCount()))
+	p.Counter("mqttbench_slave_tls_handshake_failures_total", "TLS handshakes with the broker that failed.", float64(GetTLSHandshakeFailures()))
+
+	// 丢失数在迟到的消息到达后会减少，因此导出为gauge
+	sequence := GetSequenceStats()
+	p.Gauge("mqttbench_slave_sequence_streams", "Publisher/topic streams checked for sequence numbers, per subscriber.", float64(sequence.Streams))
+	p.Gauge("mqttbench_slave_messages_lost", "Messages missing from the sequence of their stream.", float64(sequence.Lost))
+	p.Counter("mqttbench_slave_messages_duplicated_total", "Messages received more than once.", float64(sequence.Duplicates))
+	p.Counter("mqttbench_slave_messages_out_of_order_total", "Messages received after a later sequence number of the same stream.", float64(sequence.OutOfOrder))
+	p.Counter("mqttbench_slave_sequence_gaps_total", "Jumps in the sequence numbers of a stream.", float64(sequence.Gaps))
+
+	p.Header("mqttbench_slave_reason_codes_total", "counter", "Reason codes returned by the broker, by packet type and code.")
+	for _, count := range GetReasonCodeCounts() {
+		p.Sample("mqttbench_slave_reason_codes_total", float64(count.Count),
+			metrics.Label{Name: "packet", Value: count.Packet},
+			metrics.Label{Name: "code", Value: fmt.Sprintf("0x%02X", count.Code)},
+			metrics.Label{Name: "reason", Value: count.Reason})
+	}
+
+	// 失败数在每次启动时重置，因此和连接数一样导出为gauge
+	sources := GetSourceStats()
+	p.Header("mqttbench_slave_source_connections", "gauge", "MQTT clients currently connected from each source IP.")
+	for _, source := range sources {
+		p.Sample("mqttbench_slave_source_connections", float64(source.Connected), metrics.Label{Name: "source_ip", Value: source.SourceIP})
+	}
+	p.Header("mqttbench_slave_source_connect_failures", "gauge", "MQTT clients that failed to connect from each source IP in the current run.")
+	for _, source := range sources {
+		p.Sample("mqttbench_slave_source_connect_failures", float64(source.Failed), metrics.Label{Name: "source_ip", Value: source.SourceIP})
+	}
+
+	// 各broker节点的计数在每次启动时重置，导出为gauge
+	brokers := GetBrokerStats()
+	brokerGauges := []struct {
+		name  string
+		help  string
+		value func(stats broker.Stats) int64
+	}{
+		{"mqttbench_slave_broker_connections", "MQTT clients currently connected to each broker node.",
+			func(stats broker.Stats) int64 { return stats.Connected }},
+		{"mqttbench_slave_broker_connect_failures", "MQTT clients that failed to connect to each broker node in the current run.",
+			func(stats broker.Stats) int64 { return stats.Failed }},
+		{"mqttbench_slave_broker_messages_published", "Messages published through each broker node in the current run.",
+			func(stats broker.Stats) int64 { return stats.Published }},
+		{"mqttbench_slave_broker_messages_received", "Messages received from each broker node in the current run.",
+			func(stats broker.Stats) int64 { return stats.Received }},
+	}
+	for _, gauge := range brokerGauges {
+		p.Header(gauge.name, "gauge", gauge.help)
+		for _, stats := range brokers {
+			p.Sample(gauge.name, float64(gauge.value(stats)), metrics.Label{Name: "broker", Value: stats.Broker})
+		}
+	}
+
+	// 各失败原因的计数在每次启动时重置，导出为gauge
+	p.Header("mqttbench_slave_connection_failures", "gauge", "Connection and subscribe failures by reason in the current run.")
+	for _, failure := range GetFailureCounts() {
+		p.Sample("mqttbench_slave_connection_failures", float64(failure.Count),
+			metrics.Label{Name: "reason", Value: failure.Reason},
+			metrics.Label{Name: "category", Value: failure.Category})
+	}
+
+	p.Histogram("mqttbench_slave_connect_duration_seconds", "Time from MQTT connect to CONNACK.",
+		GetConnectLatencyStats(), metrics.DefaultLatencyBuckets)
+	p.Histogram("mqttbench_slave_tls_handshake_duration_seconds", "Time of the TLS handshake with the broker, excluding TCP connect and MQTT CONNECT.",
+		GetTLSHandshakeStats(), metrics.DefaultLatencyBuckets)
+	p.Histogram("mqttbench_slave_chaos_reconnect_duration_seconds", "Time from a connection dropped by a chaos action to the next CONNACK.",
+		GetChaosReconnectStats(), metrics.DefaultLatencyBuckets)
+	p.Histogram("mqttbench_slave_message_latency_seconds", "End-to-end latency of received messages carrying a send timestamp.",
+		GetLatencyStats(), metrics.DefaultLatencyBuckets)
+
+	p.WriteRuntimeMetrics()
+
+	if err := p.Err(); err != nil {
+		log.Printf("写入Prometheus指标失败: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package slave
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/gorilla/websocket"
+
+	"mqttbench/internal/diagnostics"
+)
+
+// errConnectTimeout 在超时时间内未能连接到broker
+var errConnectTimeout = errors.New("连接到MQTT服务器超时")
+
+// 各失败原因的计数，在每次启动时重置
+var (
+	failureCountsMutex sync.Mutex
+	failureCounts      = make(map[string]int64)
+)
+
+// ClassifyFailure 判断连接错误的具体原因。MQTT库返回的错误可能只保留了错误信息，
+// 无法通过错误链判断时按错误信息匹配
+func ClassifyFailure(err error) string {
+	if err == nil {
+		return ""
+	}
+	message := err.Error()
+
+	// TLS错误可能包装了超时或网络错误，需要最先判断
+	var handshakeErr *tlsHandshakeError
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &handshakeErr) || errors.As(err, &verifyErr) || errors.As(err, &recordErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) ||
+		strings.Contains(message, "tls: ") || strings.Contains(message, "x509: ") {
+		return diagnostics.FailureTLSHandshake
+	}
+
+	// broker在CONNACK中拒绝连接
+	var connackErr *autopaho.ConnackError
+	if errors.As(err, &connackErr) {
+		switch connackErr.ReasonCode {
+		case 0x86, 0x8C: // 用户名或密码错误、认证方法错误
+			return diagnostics.FailureBadCredentials
+		case 0x87, 0x8A: // 未授权、已被禁止
+			return diagnostics.FailureNotAuthorized
+		case 0x88, 0x89, 0x97, 0x9F: // 服务不可用、服务繁忙、超出配额、超出连接速率
+			return diagnostics.FailureServerUnavailable
+		}
+		return diagnostics.FailureConnackRejected
+	}
+	switch {
+	case errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword):
+		return diagnostics.FailureBadCredentials
+	case errors.Is(err, packets.ErrorRefusedNotAuthorised):
+		return diagnostics.FailureNotAuthorized
+	case errors.Is(err, packets.ErrorRefusedServerUnavailable):
+		return diagnostics.FailureServerUnavailable
+	case errors.Is(err, packets.ErrorRefusedBadProtocolVersion), errors.Is(err, packets.ErrorRefusedIDRejected):
+		return diagnostics.FailureConnackRejected
+	}
+
+	// 域名解析错误也实现了net.Error，需要在超时和网络错误之前判断
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return diagnostics.FailureDNS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(message, "connection refused") {
+		return diagnostics.FailureTCPRefused
+	}
+	if errors.Is(err, websocket.ErrBadHandshake) {
+		return diagnostics.FailureWebSocketHandshake
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return diagnostics.FailureTCPTimeout
+	}
+	var netErr net.Error
+	if errors.Is(err, errConnectTimeout) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return diagnostics.FailureConnectTimeout
+	}
+
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, packets.ErrorNetworkError) || errors.Is(err, net.ErrClosed) {
+		return diagnostics.FailureNetwork
+	}
+	return diagnostics.FailureOther
+}
+
+// countFailure 按原因记录一次失败
+func countFailure(reason string) {
+	if reason == "" {
+		return
+	}
+	failureCountsMutex.Lock()
+	failureCounts[reason]++
+	failureCountsMutex.Unlock()
+}
+
+// GetFailureCounts 获取本次运行各失败原因的计数，按计数从多到少排序
+func GetFailureCounts() []diagnostics.FailureCount {
+	failureCountsMutex.Lock()
+	defer failureCountsMutex.Unlock()
+
+	result := make([]diagnostics.FailureCount, 0, len(failureCounts))
+	for reason, count := range failureCounts {
+		result = append(result, diagnostics.FailureCount{Reason: reason, Category: diagnostics.Category(reason), Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Reason < result[j].Reason
+	})
+	return result
+}
+
+// ResetFailureCounts 清空各失败原因的计数
+func ResetFailureCounts() {
+	failureCountsMutex.Lock()
+	defer failureCountsMutex.Unlock()
+
+	failureCounts = make(map[string]int64)
+}
@@ -0,0 +1,69 @@
+package slave
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/gorilla/websocket"
+
+	"mqttbench/internal/diagnostics"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+
+		{"tls handshake timeout", &tlsHandshakeError{err: os.ErrDeadlineExceeded}, diagnostics.FailureTLSHandshake},
+		{"unknown authority", fmt.Errorf("connect: %w", x509.UnknownAuthorityError{}), diagnostics.FailureTLSHandshake},
+		{"tls message only", errors.New("remote error: tls: bad certificate"), diagnostics.FailureTLSHandshake},
+
+		{"mqtt5 bad credentials", &autopaho.ConnackError{ReasonCode: 0x86}, diagnostics.FailureBadCredentials},
+		{"mqtt5 bad auth method", &autopaho.ConnackError{ReasonCode: 0x8C}, diagnostics.FailureBadCredentials},
+		{"mqtt5 not authorized", &autopaho.ConnackError{ReasonCode: 0x87}, diagnostics.FailureNotAuthorized},
+		{"mqtt5 banned", &autopaho.ConnackError{ReasonCode: 0x8A}, diagnostics.FailureNotAuthorized},
+		{"mqtt5 quota exceeded", &autopaho.ConnackError{ReasonCode: 0x97}, diagnostics.FailureServerUnavailable},
+		{"mqtt5 other reason", &autopaho.ConnackError{ReasonCode: 0x85}, diagnostics.FailureConnackRejected},
+
+		{"mqtt3 bad credentials", fmt.Errorf("connect: %w", packets.ErrorRefusedBadUsernameOrPassword), diagnostics.FailureBadCredentials},
+		{"mqtt3 not authorized", packets.ErrorRefusedNotAuthorised, diagnostics.FailureNotAuthorized},
+		{"mqtt3 server unavailable", packets.ErrorRefusedServerUnavailable, diagnostics.FailureServerUnavailable},
+		{"mqtt3 id rejected", packets.ErrorRefusedIDRejected, diagnostics.FailureConnackRejected},
+
+		{"dns timeout", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "i/o timeout", Name: "broker", IsTimeout: true}}, diagnostics.FailureDNS},
+		{"tcp refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, diagnostics.FailureTCPRefused},
+		{"tcp refused message only", errors.New("dial tcp 10.0.0.1:1883: connect: connection refused"), diagnostics.FailureTCPRefused},
+		{"websocket handshake", fmt.Errorf("ws: %w", websocket.ErrBadHandshake), diagnostics.FailureWebSocketHandshake},
+
+		{"tcp dial timeout", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, diagnostics.FailureTCPTimeout},
+		{"connack timeout", errConnectTimeout, diagnostics.FailureConnectTimeout},
+		{"context deadline", fmt.Errorf("connect: %w", context.DeadlineExceeded), diagnostics.FailureConnectTimeout},
+		{"read timeout", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, diagnostics.FailureConnectTimeout},
+
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, diagnostics.FailureNetwork},
+		{"eof", fmt.Errorf("read connack: %w", io.EOF), diagnostics.FailureNetwork},
+		{"mqtt3 network error", packets.ErrorNetworkError, diagnostics.FailureNetwork},
+
+		{"unknown", errors.New("something else"), diagnostics.FailureOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyFailure(tt.err); got != tt.want {
+				t.Errorf("ClassifyFailure(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -16,7 +16,7 @@ type HeartbeatData struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// SendHeartbeat 发送心跳包到master
+// SendHeartbeat 发送心跳包到master，控制通道已连接时通过控制通道发送，否则使用HTTP
 func SendHeartbeat(masterIP string, masterPort int, slaveID int) error {
 	// 构造心跳数据
 	heartbeatData := HeartbeatData{
@@ -24,6 +24,11 @@ func SendHeartbeat(masterIP string, masterPort int, slaveID int) error {
 		Timestamp: time.Now(),
 	}
 
+	if err := SendControlMessage("heartbeat", heartbeatData); err == nil {
+		log.Printf("Heartbeat sent to master over control channel")
+		return nil
+	}
+
 	// 将数据序列化为JSON
 	data, err := json.Marshal(heartbeatData)
 	if err != nil {
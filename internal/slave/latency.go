@@ -0,0 +1,71 @@
+package slave
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"mqttbench/internal/metrics"
+	"mqttbench/internal/payload"
+)
+
+// TimestampKey 发布消息中嵌入发送时间（Unix纳秒）的JSON字段
+const TimestampKey = payload.TimestampKey
+
+// 本次运行的端到端延迟直方图
+var latencyHistogram = metrics.NewHistogram()
+
+// 当前采样周期的延迟直方图，每次采样时替换为新的直方图
+var sampleHistogram atomic.Pointer[metrics.Histogram]
+
+func init() {
+	sampleHistogram.Store(metrics.NewHistogram())
+}
+
+// GetLatencyStats 获取本次运行的延迟统计结果
+func GetLatencyStats() metrics.LatencyStats {
+	return latencyHistogram.Stats()
+}
+
+// ResetLatency 重置延迟统计
+func ResetLatency() {
+	latencyHistogram.Reset()
+}
+
+// recordLatency 根据消息中嵌入的发送时间记录端到端延迟
+func recordLatency(data map[string]interface{}, recvTime time.Time) {
+	sendTime, ok := extractSendTime(data)
+	if !ok {
+		return
+	}
+	latency := recvTime.Sub(sendTime)
+	latencyHistogram.Record(latency)
+	sampleHistogram.Load().Record(latency)
+}
+
+// takeSampleLatency 获取当前采样周期的延迟统计，并开始新的采样周期
+func takeSampleLatency() metrics.LatencyStats {
+	return sampleHistogram.Swap(metrics.NewHistogram()).Stats()
+}
+
+// extractSendTime 从消息中解析嵌入的发送时间
+func extractSendTime(data map[string]interface{}) (time.Time, bool) {
+	var nanos int64
+	switch v := data[TimestampKey].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		nanos = n
+	case float64:
+		nanos = int64(v)
+	default:
+		return time.Time{}, false
+	}
+
+	if nanos <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
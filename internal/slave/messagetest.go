@@ -0,0 +1,503 @@
+package slave
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"mqttbench/internal/broker"
+	"mqttbench/internal/messagetest"
+	"mqttbench/internal/payload"
+)
+
+// 消息测试参数
+const (
+	messageTestCount   = 20               // QoS用例发布的消息数
+	messageTestTimeout = 10 * time.Second // 等待消息到达的时间
+)
+
+// RunMessageTests 使用配置中的MQTT服务器执行消息测试用例
+func RunMessageTests(config ConfigData) []messagetest.CaseResult {
+	spec := config.MessageTest
+	if spec == nil {
+		return []messagetest.CaseResult{{Case: "config", Passed: false, Evidence: "missing message test parameters"}}
+	}
+
+	// 使用唯一的主题前缀，避免与其他测试互相干扰
+	prefix := fmt.Sprintf("mqttbench/msgtest/%d/%s/%d", spec.TestID, config.ClientID, time.Now().UnixNano())
+	qos := byte(spec.QoS)
+
+	results := []messagetest.CaseResult{runQoSCase(config, spec, prefix+"/qos", qos)}
+	if spec.Retained {
+		results = append(results, runRetainedCase(config, spec, prefix+"/retained", qos))
+	}
+	if spec.Duplicate {
+		results = append(results, runDuplicateCase(config, spec, prefix+"/duplicate", max(qos, 1)))
+	}
+
+	// 用例只支持MQTT 3.x，在证据中记录实际使用的协议
+	protocol := testProtocolName(config)
+	for i := range results {
+		results[i].Evidence = fmt.Sprintf("protocol %s: %s", protocol, results[i].Evidence)
+		log.Printf("消息测试 %d 用例 %s: passed=%v, %s", spec.TestID, results[i].Case, results[i].Passed, results[i].Evidence)
+	}
+	return results
+}
+
+// testProtocolVersion 返回消息测试使用的协议版本，配置为MQTT 3.1时使用3.1，其余情况（包括MQTT 5.0）使用3.1.1
+func testProtocolVersion(config ConfigData) byte {
+	if config.ProtocolVersion == broker.ProtocolMQTT31 {
+		return broker.ProtocolMQTT31
+	}
+	return broker.ProtocolMQTT311
+}
+
+// testProtocolName 返回消息测试实际使用的协议，配置为MQTT 5.0时注明未使用5.0
+func testProtocolName(config ConfigData) string {
+	if testProtocolVersion(config) == broker.ProtocolMQTT31 {
+		return "MQTT 3.1"
+	}
+	if config.ProtocolVersion == broker.ProtocolMQTT5 {
+		return "MQTT 3.1.1 (configured MQTT 5.0 is not supported by message tests)"
+	}
+	return "MQTT 3.1.1"
+}
+
+// runQoSCase 验证指定QoS下的投递保证：QoS0最多一次，QoS1至少一次，QoS2恰好一次
+func runQoSCase(config ConfigData, spec *messagetest.Spec, topic string, qos byte) messagetest.CaseResult {
+	result := messagetest.CaseResult{Case: fmt.Sprintf("qos%d", qos)}
+
+	received := make(map[string]int)
+	var wrongQoS int
+	var mutex sync.Mutex
+	sub, err := connectTestClient(config, "sub", spec.TestID)
+	if err != nil {
+		result.Evidence = fmt.Sprintf("subscriber connect failed: %v", err)
+		return result
+	}
+	defer sub.Disconnect(250)
+
+	token := sub.Subscribe(topic, qos, func(c mqtt.Client, msg mqtt.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received[string(msg.Payload())]++
+		if msg.Qos() != qos {
+			wrongQoS++
+		}
+	})
+	if err := waitToken(token); err != nil {
+		result.Evidence = fmt.Sprintf("subscribe failed: %v", err)
+		return result
+	}
+
+	pub, err := connectTestClient(config, "pub", spec.TestID)
+	if err != nil {
+		result.Evidence = fmt.Sprintf("publisher connect failed: %v", err)
+		return result
+	}
+	defer pub.Disconnect(250)
+
+	sent := make([]string, 0, messageTestCount)
+	for i := 0; i < messageTestCount; i++ {
+		payload := newTestPayload(spec.MessageType, spec.PayloadSize, i)
+		if err := waitToken(pub.Publish(topic, qos, false, payload)); err != nil {
+			result.Evidence = fmt.Sprintf("publish %d failed: %v", i, err)
+			return result
+		}
+		sent = append(sent, string(payload))
+	}
+
+	// 等待消息到达，QoS0不保证全部到达，同样等待到超时或全部到达
+	countReceived := func() (missing int, duplicates int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, payload := range sent {
+			switch n := received[payload]; {
+			case n == 0:
+				missing++
+			case n > 1:
+				duplicates += n - 1
+			}
+		}
+		return missing, duplicates
+	}
+	deadline := time.Now().Add(messageTestTimeout)
+	missing, duplicates := countReceived()
+	for missing > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		missing, duplicates = countReceived()
+	}
+
+	mutex.Lock()
+	qosMismatch := wrongQoS
+	mutex.Unlock()
+
+	switch qos {
+	case 0:
+		result.Passed = duplicates == 0
+	case 1:
+		result.Passed = missing == 0
+	default:
+		result.Passed = missing == 0 && duplicates == 0
+	}
+	result.Passed = result.Passed && qosMismatch == 0
+	result.Evidence = fmt.Sprintf("sent %d, missing %d, duplicates %d, delivered with wrong qos %d",
+		len(sent), missing, duplicates, qosMismatch)
+	return result
+}
+
+// runRetainedCase 验证保留消息能投递给后来的订阅者，并带有retain标志
+func runRetainedCase(config ConfigData, spec *messagetest.Spec, topic string, qos byte) messagetest.CaseResult {
+	result := messagetest.CaseResult{Case: "retained"}
+
+	pub, err := connectTestClient(config, "pub", spec.TestID)
+	if err != nil {
+		result.Evidence = fmt.Sprintf("publisher connect failed: %v", err)
+		return result
+	}
+	defer func() {
+		// 清除保留消息
+		pub.Publish(topic, qos, true, []byte{}).WaitTimeout(messageTestTimeout)
+		pub.Disconnect(250)
+	}()
+
+	payload := newTestPayload(spec.MessageType, spec.PayloadSize, 0)
+	if err := waitToken(pub.Publish(topic, qos, true, payload)); err != nil {
+		result.Evidence = fmt.Sprintf("publish retained message failed: %v", err)
+		return result
+	}
+
+	// 发布完成后再连接订阅者
+	sub, err := connectTestClient(config, "late", spec.TestID)
+	if err != nil {
+		result.Evidence = fmt.Sprintf("late subscriber connect failed: %v", err)
+		return result
+	}
+	defer sub.Disconnect(250)
+
+	messages := make(chan mqtt.Message, 1)
+	token := sub.Subscribe(topic, qos, func(c mqtt.Client, msg mqtt.Message) {
+		select {
+		case messages <- msg:
+		default:
+		}
+	})
+	if err := waitToken(token); err != nil {
+		result.Evidence = fmt.Sprintf("late subscribe failed: %v", err)
+		return result
+	}
+
+	select {
+	case msg := <-messages:
+		sameBody := bytes.Equal(msg.Payload(), payload)
+		result.Passed = msg.Retained() && sameBody
+		result.Evidence = fmt.Sprintf("late subscriber received message: retain flag %v, payload matches %v", msg.Retained(), sameBody)
+	case <-time.After(messageTestTimeout):
+		result.Evidence = fmt.Sprintf("late subscriber received nothing within %v", messageTestTimeout)
+	}
+	return result
+}
+
+// runDuplicateCase 通过原始连接发送DUP=1的PUBLISH，验证broker正确确认、
+// 不向订阅者传递DUP标志，并且QoS2下重发的报文只投递一次
+func runDuplicateCase(config ConfigData, spec *messagetest.Spec, topic string, qos byte) messagetest.CaseResult {
+	result := messagetest.CaseResult{Case: "duplicate"}
+
+	var count, dupFlags int
+	var mutex sync.Mutex
+	sub, err := connectTestClient(config, "sub", spec.TestID)
+	if err != nil {
+		result.Evidence = fmt.Sprintf("subscriber connect failed: %v", err)
+		return result
+	}
+	defer sub.Disconnect(250)
+
+	token := sub.Subscribe(topic, qos, func(c mqtt.Client, msg mqtt.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		count++
+		if msg.Duplicate() {
+			dupFlags++
+		}
+	})
+	if err := waitToken(token); err != nil {
+		result.Evidence = fmt.Sprintf("subscribe failed: %v", err)
+		return result
+	}
+
+	clientID := fmt.Sprintf("%s_mt_%d_raw", config.ClientID, spec.TestID)
+	conn, err := dialRaw(config, clientID)
+	if err != nil {
+		result.Evidence = fmt.Sprintf("raw connect failed: %v", err)
+		return result
+	}
+	defer conn.Close()
+
+	publish := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	publish.Qos = qos
+	publish.Dup = true
+	publish.TopicName = topic
+	publish.MessageID = 1
+	publish.Payload = newTestPayload(spec.MessageType, spec.PayloadSize, 0)
+
+	// QoS2下模拟重传：同一个报文标识符发送两次
+	sends := 1
+	if qos == 2 {
+		sends = 2
+	}
+	for i := 0; i < sends; i++ {
+		if err := publish.Write(conn); err != nil {
+			result.Evidence = fmt.Sprintf("write publish failed: %v", err)
+			return result
+		}
+	}
+
+	if err := completeRawPublish(conn, qos, publish.MessageID, sends); err != nil {
+		result.Evidence = fmt.Sprintf("broker acknowledgement failed: %v", err)
+		return result
+	}
+
+	// 等待投递完成，再多等一段时间以便发现重复投递
+	deadline := time.Now().Add(messageTestTimeout)
+	for time.Now().Before(deadline) {
+		mutex.Lock()
+		done := count > 0
+		mutex.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(time.Second)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if qos == 2 {
+		result.Passed = count == 1 && dupFlags == 0
+	} else {
+		result.Passed = count >= 1 && dupFlags == 0
+	}
+	result.Evidence = fmt.Sprintf("sent %d DUP publish(es) at qos %d, subscriber received %d, with DUP flag %d",
+		sends, qos, count, dupFlags)
+	return result
+}
+
+// completeRawPublish 读取broker的确认报文并完成QoS1/QoS2的发布流程
+func completeRawPublish(conn net.Conn, qos byte, messageID uint16, sends int) error {
+	conn.SetReadDeadline(time.Now().Add(messageTestTimeout))
+
+	acked := 0
+	for acked < sends {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return err
+		}
+
+		switch p := packet.(type) {
+		case *packets.PubackPacket:
+			if p.MessageID == messageID {
+				acked++
+			}
+		case *packets.PubrecPacket:
+			if p.MessageID == messageID {
+				acked++
+			}
+		default:
+			return fmt.Errorf("unexpected packet %s", packet.String())
+		}
+	}
+
+	if qos < 2 {
+		return nil
+	}
+
+	pubrel := packets.NewControlPacket(packets.Pubrel).(*packets.PubrelPacket)
+	pubrel.MessageID = messageID
+	if err := pubrel.Write(conn); err != nil {
+		return err
+	}
+
+	packet, err := packets.ReadPacket(conn)
+	if err != nil {
+		return err
+	}
+	if _, ok := packet.(*packets.PubcompPacket); !ok {
+		return fmt.Errorf("expected PUBCOMP, got %s", packet.String())
+	}
+	return nil
+}
+
+// dialRaw 建立原始MQTT连接并完成CONNECT/CONNACK握手
+func dialRaw(config ConfigData, clientID string) (net.Conn, error) {
+	endpoint, err := newBrokerEndpoint(config, config.BrokerNodes()[0])
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := config.Credentials.Provider()
+	if err != nil {
+		return nil, err
+	}
+	username, password, err := credentials.Credentials(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := endpoint.dial(context.Background(), messageTestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.ProtocolName = "MQTT"
+	connect.ProtocolVersion = testProtocolVersion(config)
+	if connect.ProtocolVersion == broker.ProtocolMQTT31 {
+		connect.ProtocolName = "MQIsdp"
+	}
+	connect.CleanSession = true
+	connect.Keepalive = 60
+	connect.ClientIdentifier = clientID
+	connect.UsernameFlag = true
+	connect.Username = username
+	connect.PasswordFlag = password != ""
+	connect.Password = []byte(password)
+
+	if err := connect.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(messageTestTimeout))
+	packet, err := packets.ReadPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	connack, ok := packet.(*packets.ConnackPacket)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("expected CONNACK, got %s", packet.String())
+	}
+	if connack.ReturnCode != packets.Accepted {
+		conn.Close()
+		return nil, fmt.Errorf("connection refused: %s", packets.ConnackReturnCodes[connack.ReturnCode])
+	}
+	return conn, nil
+}
+
+// connectTestClient 创建并连接用于消息测试的客户端
+func connectTestClient(config ConfigData, role string, testID int64) (mqtt.Client, error) {
+	clientID := fmt.Sprintf("%s_mt_%d_%s", config.ClientID, testID, role)
+
+	endpoint, err := newBrokerEndpoint(config, config.BrokerNodes()[0])
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := config.Credentials.Provider()
+	if err != nil {
+		return nil, err
+	}
+	username, password, err := credentials.Credentials(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(endpoint.url.String())
+	opts.SetCustomOpenConnectionFn(func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+		return endpoint.dial(context.Background(), options.ConnectTimeout)
+	})
+	opts.SetClientID(clientID)
+	opts.SetProtocolVersion(uint(testProtocolVersion(config)))
+	opts.SetUsername(username)
+	opts.SetPassword(password)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(false)
+	opts.SetConnectTimeout(messageTestTimeout)
+
+	client := mqtt.NewClient(opts)
+	if err := waitToken(client.Connect()); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// waitToken 等待MQTT操作完成
+func waitToken(token mqtt.Token) error {
+	if !token.WaitTimeout(messageTestTimeout) {
+		return fmt.Errorf("timeout after %v", messageTestTimeout)
+	}
+	return token.Error()
+}
+
+// newTestPayload 按消息类型构造测试消息，seq用于区分每条消息
+func newTestPayload(messageType string, size int, seq int) []byte {
+	switch messageType {
+	case "binary":
+		message := make([]byte, max(size, 8))
+		rand.Read(message)
+		// 前8字节写入序号，保证每条消息不同
+		for i := 0; i < 8; i++ {
+			message[i] = byte(seq >> (8 * i))
+		}
+		return message
+	case "text":
+		header := fmt.Sprintf("message %d ", seq)
+		return []byte(header + string(payload.Padding(size-len(header), payload.ContentRandom)))
+	default:
+		message, _ := json.Marshal(map[string]interface{}{
+			"seq": seq,
+			"pad": string(payload.Padding(size-24, payload.ContentRandom)),
+		})
+		return message
+	}
+}
+
+// SendMessageTestReport 发送消息测试结果到master，控制通道已连接时通过控制通道发送，否则使用HTTP
+func SendMessageTestReport(masterIP string, masterPort int, report messagetest.Report) error {
+	if err := SendControlMessage("message_test_result", report); err == nil {
+		return nil
+	}
+
+	// 将数据序列化为JSON
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message test report: %v", err)
+	}
+
+	// 构造master的消息测试结果URL
+	reportURL := fmt.Sprintf("http://%s/message-test-result", net.JoinHostPort(masterIP, strconv.Itoa(masterPort)))
+
+	// 创建HTTP客户端，设置超时时间
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	// 发送POST请求
+	resp, err := client.Post(reportURL, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to send message test report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 检查响应状态
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("message test report failed with status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
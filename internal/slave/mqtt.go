@@ -1,15 +1,20 @@
 package slave
 
 import (
-	"crypto/tls"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/netip"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"mqttbench/internal/ack"
+	"mqttbench/internal/broker"
+	"mqttbench/internal/diagnostics"
+	"mqttbench/internal/topic"
+	"mqttbench/internal/workload"
 )
 
 // 用于跟踪连接数的全局变量
@@ -18,6 +23,9 @@ var (
 	expectedConnections  int64
 	messageCount         int64 // 添加消息计数器
 	ackMessageCount      int64 // 添加ACK消息计数器
+	ackFailureCount      int64 // 发送失败的ACK消息数
+	reconnectCount       int64 // 掉线后自动重连的次数
+	connectedClients     int64 // 当前处于连接状态的客户端数
 	connectionMutex      sync.RWMutex
 	onConnectionComplete func(successCount int) // 所有连接完成时的回调函数
 )
@@ -58,6 +66,11 @@ func GetMessageCount() int64 {
 	return atomic.LoadInt64(&messageCount)
 }
 
+// GetExpectedConnections 获取期望的连接数
+func GetExpectedConnections() int {
+	return int(atomic.LoadInt64(&expectedConnections))
+}
+
 // GetConnectionCount 获取当前连接数
 func GetConnectionCount() int {
 	return int(atomic.LoadInt64(&connectionCount))
@@ -79,99 +92,199 @@ func GetAckMessageCount() int64 {
 	return atomic.LoadInt64(&ackMessageCount)
 }
 
+// GetAckFailureCount 获取发送失败的ACK消息数
+func GetAckFailureCount() int64 {
+	return atomic.LoadInt64(&ackFailureCount)
+}
+
+// GetReconnectCount 获取自动重连次数
+func GetReconnectCount() int64 {
+	return atomic.LoadInt64(&reconnectCount)
+}
+
+// GetConnectedClients 获取当前处于连接状态的客户端数
+func GetConnectedClients() int {
+	return int(atomic.LoadInt64(&connectedClients))
+}
+
 // ResetAckMessageCount 重置ACK消息计数
 func ResetAckMessageCount() {
 	atomic.StoreInt64(&ackMessageCount, 0)
 }
 
+// receivedMessage 订阅收到的消息，与协议版本无关
+type receivedMessage struct {
+	Topic   string
+	QoS     byte
+	Payload []byte
+}
+
+// brokerClient 不同协议版本的MQTT连接
+type brokerClient interface {
+	// Connect 连接到MQTT服务器，失败后自动重试直到超时
+	Connect(timeout time.Duration) error
+	IsConnected() bool
+	Subscribe(topic string, qos byte, timeout time.Duration, handler func(receivedMessage)) error
+	// Publish 按调用顺序发送PUBLISH报文，返回等待PUBACK/PUBCOMP的函数，timeout从发送时开始计算
+	Publish(topic string, qos byte, payload []byte, timeout time.Duration) (wait func() error)
+	// Disconnect 断开连接并停止自动重连
+	Disconnect()
+}
+
+// connectionHandlers 连接状态变化时的回调
+type connectionHandlers struct {
+	onConnect        func()      // 连接成功，包括自动重连成功
+	onReconnecting   func()      // 开始一次自动重连
+	onConnectionLost func(error) // 连接丢失
+	onConnectError   func(error) // 一次连接尝试失败，包括自动重连，客户端随后会重试
+}
+
 // MQTTClient 封装MQTT客户端
 type MQTTClient struct {
-	client   mqtt.Client
-	config   ConfigData
-	topic    string       // 用于存储订阅的主题
-	qos      byte         // 用于存储订阅的QoS
-	ackTopic string       // 用于存储ACK主题
-	mutex    sync.RWMutex // 用于保护客户端状态的互斥锁
+	client        brokerClient
+	config        ConfigData
+	topicVars     topic.Vars                      // 展开主题模板使用的客户端信息
+	subscriptions []topic.Subscription            // 展开后的订阅列表，连接成功后自动订阅
+	sourceIP      netip.Addr                      // 绑定的本地源地址，无效时由系统选择
+	broker        broker.Node                     // 连接的broker节点
+	brokerStats   *brokerCounters                 // broker节点的计数器
+	connected     atomic.Bool                     // 是否已计入连接数，Connect返回和连接回调都会更新，只计数一次
+	lifecycle     *clientTracker                  // 连接生命周期记录，调用Connect后才创建
+	conn          atomic.Pointer[chaosConn]       // 当前到broker的网络连接，用于故障注入
+	disruption    atomic.Pointer[chaosDisruption] // 尚未恢复的故障注入，重连成功后清除
+	ack           *ack.Responder                  // ACK构造器，为nil时不回复ACK
+	publishStop   chan struct{}                   // 用于停止发布循环，为nil时表示未在发布
+	publishSeq    atomic.Uint64                   // 最近发布的消息序号，重新开始发布时继续递增
+	mutex         sync.RWMutex                    // 用于保护客户端状态的互斥锁
 }
 
-// NewMQTTClient 创建新的MQTT客户端
-func NewMQTTClient(config ConfigData) *MQTTClient {
-	// 如果配置中没有设置ACK主题，则使用默认值
-	ackTopic := config.AckTopic
-	if ackTopic == "" {
-		ackTopic = "EEW/ACK/Channel1"
+// NewMQTTClient 创建新的MQTT客户端，按vars展开订阅和发布主题模板
+func NewMQTTClient(config ConfigData, vars topic.Vars) *MQTTClient {
+	// ACK配置已在下发配置时校验，未设置ACK主题时使用默认值
+	ack, err := config.Ack.Responder(config.AckTopic)
+	if err != nil {
+		log.Printf("ACK设置无效，不回复ACK: %v", err)
 	}
 
-	return &MQTTClient{
-		config:   config,
-		ackTopic: ackTopic,
+	m := &MQTTClient{
+		config:    config,
+		ack:       ack,
+		topicVars: vars,
 	}
+	m.SetBroker(config.BrokerNodes()[0])
+
+	// 遗嘱消息的主题按客户端展开
+	m.config.Will = config.WillFor(vars)
+
+	// 订阅模式下记录订阅列表，连接成功后会自动订阅
+	if workload.IsSubscribeMode(config.Mode) {
+		m.subscriptions = config.SubscriptionsFor(vars)
+	}
+
+	return m
+}
+
+// SetSourceIP 设置连接broker时绑定的本地源地址，需要在Connect之前调用
+func (m *MQTTClient) SetSourceIP(addr netip.Addr) {
+	m.sourceIP = addr
+}
+
+// SetBroker 设置连接的broker节点，需要在Connect之前调用
+func (m *MQTTClient) SetBroker(node broker.Node) {
+	m.broker = node
+	m.brokerStats = brokerCountersOf(node)
 }
 
-// Connect 连接到MQTT服务器
+// Connect 按配置的协议版本连接到MQTT服务器
 func (m *MQTTClient) Connect(clientID string) error {
-	// 构造MQTT服务器地址
-	broker := fmt.Sprintf("tcp://%s:%d", m.config.MqttHost, m.config.MqttPort)
-
-	// 设置MQTT客户端选项
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(broker)
-
-	// 设置用户名和密码为clientID，满足username=password=clientID的要求
-	opts.SetClientID(clientID)
-	opts.SetUsername(clientID)
-	opts.SetPassword(clientID)
-
-	// 设置其他选项
-	opts.SetCleanSession(true)
-	opts.SetAutoReconnect(true)
-	opts.SetConnectRetry(true)
-	opts.SetConnectRetryInterval(10 * time.Second)
-	opts.SetKeepAlive(120 * time.Second)
-
-	// 设置TLS配置（如果需要）
-	if m.config.MqttPort == 8883 {
-		opts.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	// 记录连接生命周期，供master按客户端查询
+	sourceIP := ""
+	if m.sourceIP.IsValid() {
+		sourceIP = m.sourceIP.String()
 	}
+	tracker := trackClient(clientID, m.broker, sourceIP)
+	m.mutex.Lock()
+	m.lifecycle = tracker
+	m.mutex.Unlock()
 
-	// 设置连接和断开连接的回调
-	opts.SetOnConnectHandler(func(c mqtt.Client) {
-		// 如果已有主题信息，则自动订阅
-		m.mutex.RLock()
-		topic := m.topic
-		qos := m.qos
-		m.mutex.RUnlock()
-
-		if topic != "" {
-			err := m.Subscribe(topic, qos, clientID)
-			if err != nil {
-				log.Printf("MQTT客户端 %s 自动订阅主题 %s 失败: %v", clientID, topic, err)
+	handlers := connectionHandlers{
+		onConnect: func() {
+			if disruption := m.disruption.Swap(nil); disruption != nil {
+				disruption.reconnected()
+			}
+			m.setConnected(true)
+			tracker.up()
+
+			// 如果已有订阅列表，则自动订阅
+			subscriptions := m.GetSubscriptions()
+			subscribeStart := time.Now()
+			subscribeFailed := false
+			for _, subscription := range subscriptions {
+				err := m.Subscribe(subscription.Topic, byte(subscription.QoS), clientID)
+				if err != nil {
+					log.Printf("MQTT客户端 %s 自动订阅主题 %s 失败: %v", clientID, subscription.Topic, err)
+					tracker.subscribeFailed(err)
+					subscribeFailed = true
+				}
+			}
+			if len(subscriptions) > 0 && !subscribeFailed {
+				tracker.subscribed(time.Since(subscribeStart))
+			}
+			// 增加连接计数（会在所有连接完成时触发回调）
+			incrementConnectionCount()
+		},
+		onReconnecting: func() {
+			atomic.AddInt64(&reconnectCount, 1)
+			tracker.reconnecting()
+		},
+		onConnectionLost: func(err error) {
+			log.Printf("MQTT客户端 %s 连接丢失: %v", clientID, err)
+			m.setConnected(false)
+			tracker.lost(err)
+			if disruption := m.disruption.Load(); disruption != nil {
+				disruption.lost(time.Now())
 			}
-		}
-		// 增加连接计数（会在所有连接完成时触发回调）
-		incrementConnectionCount()
-	})
 
-	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
-		log.Printf("MQTT客户端 %s 连接丢失: %v", clientID, err)
+			for _, subscription := range m.GetSubscriptions() {
+				err = m.Subscribe(subscription.Topic, byte(subscription.QoS), clientID)
+				if err != nil {
+					log.Printf("MQTT客户端 %s 自动订阅主题 %s 失败: %v", clientID, subscription.Topic, err)
+				} else {
+					log.Printf("MQTT客户端 %s 掉线后自动订阅主题 %s 成功", clientID, subscription.Topic)
+				}
+			}
+		},
+		onConnectError: tracker.connectAttemptFailed,
+	}
 
-		m.mutex.RLock()
-		topic := m.topic
-		qos := m.qos
-		m.mutex.RUnlock()
+	// 按传输方式构造broker节点的地址
+	endpoint, err := newBrokerEndpoint(m.config, m.broker)
+	if err != nil {
+		tracker.failed(err, ClassifyFailure(err))
+		return err
+	}
+	endpoint.localAddr = sourceTCPAddr(m.sourceIP)
+	endpoint.onTCPConnect = tracker.tcpConnected
+	endpoint.onConnection = m.conn.Store
 
-		if topic != "" {
-			err = m.Subscribe(topic, qos, clientID)
-			if err != nil {
-				log.Printf("MQTT客户端 %s 自动订阅主题 %s 失败: %v", clientID, topic, err)
-			} else {
-				log.Printf("MQTT客户端 %s 掉线后自动订阅主题 %s 成功", clientID, topic)
-			}
-		}
-	})
+	// 连接前检查能否为该客户端生成凭据
+	credentials, err := m.config.Credentials.Provider()
+	if err != nil {
+		tracker.failed(err, diagnostics.FailureCredentials)
+		return err
+	}
+	if _, _, err := credentials.Credentials(clientID); err != nil {
+		tracker.failed(err, diagnostics.FailureCredentials)
+		return err
+	}
 
 	// 创建MQTT客户端
-	client := mqtt.NewClient(opts)
+	var client brokerClient
+	if m.config.ProtocolVersion == broker.ProtocolMQTT5 {
+		client = newMQTT5Client(m.config, clientID, endpoint, credentials, handlers)
+	} else {
+		client = newMQTT3Client(m.config, clientID, endpoint, credentials, handlers)
+	}
 
 	// 安全地设置客户端实例
 	m.mutex.Lock()
@@ -179,19 +292,35 @@ func (m *MQTTClient) Connect(clientID string) error {
 	m.mutex.Unlock()
 
 	// 连接到MQTT服务器
-	token := client.Connect()
-	if !token.WaitTimeout(120 * time.Second) {
-		return fmt.Errorf("连接到MQTT服务器超时")
+	connectStart := time.Now()
+	if err := client.Connect(120 * time.Second); err != nil {
+		tracker.failed(err, ClassifyFailure(err))
+		return err
 	}
+	connectHistogram.Record(time.Since(connectStart))
+	tracker.connected(time.Since(connectStart))
 
-	if token.Error() != nil {
-		return fmt.Errorf("连接到MQTT服务器失败: %v", token.Error())
-	}
+	// 连接回调在单独的goroutine中执行，Connect返回时即计入连接数，使建连完成后上报的结果包含所有连接
+	m.setConnected(true)
 
 	// log.Printf("MQTT客户端 %s 连接成功到 %s", clientID, broker)
 	return nil
 }
 
+// setConnected 更新客户端的连接状态，状态变化时同步更新连接数以及源地址和broker节点的连接数
+func (m *MQTTClient) setConnected(connected bool) {
+	if !m.connected.CompareAndSwap(!connected, connected) {
+		return
+	}
+	delta := int64(1)
+	if !connected {
+		delta = -1
+	}
+	atomic.AddInt64(&connectedClients, delta)
+	countSourceConnected(m.sourceIP, delta)
+	m.brokerStats.connected.Add(delta)
+}
+
 // Subscribe 订阅主题
 func (m *MQTTClient) Subscribe(topic string, qos byte, clientID string) error {
 	m.mutex.RLock()
@@ -202,46 +331,57 @@ func (m *MQTTClient) Subscribe(topic string, qos byte, clientID string) error {
 		return fmt.Errorf("MQTT客户端未连接")
 	}
 
-	// 保存主题信息和QoS，用于重连后重新订阅
-	m.mutex.Lock()
-	m.topic = topic
-	m.qos = qos
-	m.mutex.Unlock()
+	return client.Subscribe(topic, qos, 60*time.Second, func(msg receivedMessage) {
+		// 尽早记录接收时间，用于计算延迟和ACK中的接收时间
+		recvTime := time.Now()
 
-	token := client.Subscribe(topic, qos, func(client mqtt.Client, msg mqtt.Message) {
 		// 增加消息计数器
 		newCount := atomic.AddInt64(&messageCount, 1)
+		m.brokerStats.received.Add(1)
 		log.Printf("收到消息总数: %d,", newCount)
 
-		// 使用回调函数处理消息并发送ACK确认
-		go m.handleMessageWithACK(msg, clientID)
-	})
+		// 解析JSON数据，使用json.Number避免纳秒时间戳丢失精度
+		var jsonData map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(msg.Payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&jsonData); err != nil {
+			log.Printf("解析JSON消息失败: %v", err)
+			return
+		}
 
-	if !token.WaitTimeout(60 * time.Second) {
-		return fmt.Errorf("订阅主题 %s 超时", topic)
-	}
+		// 序号需要在回调中按到达顺序检查，ACK在单独的goroutine中发送
+		recordSequence(jsonData, clientID, msg.Topic)
 
-	if token.Error() != nil {
-		return fmt.Errorf("订阅主题 %s 失败: %v", topic, token.Error())
-	}
+		// 如果消息中嵌入了发送时间，则记录端到端延迟
+		recordLatency(jsonData, recvTime)
 
-	// log.Printf("成功订阅主题: %s, QoS: %d", topic, qos)
-	return nil
+		if m.ack == nil {
+			return
+		}
+
+		// 使用回调函数处理消息并发送ACK确认
+		go m.handleMessageWithACK(msg, jsonData, clientID, recvTime)
+	})
 }
 
 // handleMessageWithACK 处理消息并发送ACK确认
-func (m *MQTTClient) handleMessageWithACK(msg mqtt.Message, clientID string) {
-	// 解析JSON数据
-	var jsonData map[string]interface{}
-	if err := json.Unmarshal(msg.Payload(), &jsonData); err != nil {
-		log.Printf("解析JSON消息失败: %v", err)
-		return
-	}
+func (m *MQTTClient) handleMessageWithACK(msg receivedMessage, jsonData map[string]interface{}, clientID string, recvTime time.Time) {
 
 	// log.Printf("解析JSON消息成功: %+v", jsonData)
 
-	// 根据接收的数据构造ACK消息
-	ackData := constructACKData(jsonData, clientID)
+	responder := m.ack
+	if responder.Delay > 0 {
+		time.Sleep(responder.Delay)
+	}
+
+	// 根据接收的数据构造ACK主题和消息
+	ackTopic, ackData := responder.Build(&ack.Context{
+		Request:  jsonData,
+		ClientID: clientID,
+		Topic:    msg.Topic,
+		RecvTime: recvTime,
+		SendTime: time.Now(),
+	})
 
 	// 将ACK数据序列化为JSON
 	ackPayload, err := json.Marshal(ackData)
@@ -250,18 +390,20 @@ func (m *MQTTClient) handleMessageWithACK(msg mqtt.Message, clientID string) {
 		return
 	}
 
-	// 使用配置的ACK主题发布确认消息
-	ackTopic := m.ackTopic
+	// 未设置ACK的QoS时与收到的消息相同
+	qos := msg.QoS
+	if responder.QoS >= 0 {
+		qos = byte(responder.QoS)
+	}
 
 	// 发布ACK消息
-	token := m.client.Publish(ackTopic, msg.Qos(), false, ackPayload)
-	if !token.WaitTimeout(120 * time.Second) {
-		log.Printf("发布ACK消息到主题 %s 超时", ackTopic)
-		return
-	}
+	m.mutex.RLock()
+	client := m.client
+	m.mutex.RUnlock()
 
-	if token.Error() != nil {
-		log.Printf("发布ACK消息到主题 %s 失败: %v", ackTopic, token.Error())
+	if err := client.Publish(ackTopic, qos, ackPayload, 120*time.Second)(); err != nil {
+		log.Printf("发布ACK消息到主题 %s 失败: %v", ackTopic, err)
+		atomic.AddInt64(&ackFailureCount, 1)
 		return
 	}
 
@@ -270,29 +412,6 @@ func (m *MQTTClient) handleMessageWithACK(msg mqtt.Message, clientID string) {
 	log.Printf("发布ACK消息总数: %d,", newAckCount)
 }
 
-// constructACKData 根据接收的数据构造ACK响应数据
-func constructACKData(receivedData map[string]interface{}, clientID string) map[string]interface{} {
-	now := time.Now().Format("2006-01-02 15:04:05.999")
-	// 构造ACK消息，根据接收数据的字段映射到响应数据
-	ackData := map[string]interface{}{
-		"1":  getOrDefault(receivedData, "1", ""),
-		"2":  getOrDefault(receivedData, "2", ""),
-		"3":  now,                                 //接收时间
-		"4":  now,                                 //发送时间
-		"5":  clientID,                            // 使用客户端ID
-	}
-
-	return ackData
-}
-
-// getOrDefault 获取map中的值，如果不存在则返回默认值
-func getOrDefault(data map[string]interface{}, key string, defaultValue interface{}) interface{} {
-	if value, exists := data[key]; exists {
-		return value
-	}
-	return defaultValue
-}
-
 // // SubscribeWithCallback 使用自定义回调函数订阅主题
 // func (m *MQTTClient) SubscribeWithCallback(topic string, qos byte, callback mqtt.MessageHandler) error {
 // 	if m.client == nil {
@@ -314,7 +433,7 @@ func getOrDefault(data map[string]interface{}, key string, defaultValue interfac
 // }
 
 // Publish 发布消息
-func (m *MQTTClient) Publish(topic string, qos byte, payload interface{}) error {
+func (m *MQTTClient) Publish(topic string, qos byte, payload []byte) error {
 	m.mutex.RLock()
 	client := m.client
 	m.mutex.RUnlock()
@@ -323,13 +442,8 @@ func (m *MQTTClient) Publish(topic string, qos byte, payload interface{}) error
 		return fmt.Errorf("MQTT客户端未连接")
 	}
 
-	token := client.Publish(topic, qos, false, payload)
-	if !token.WaitTimeout(30 * time.Second) {
-		return fmt.Errorf("发布消息到主题 %s 超时", topic)
-	}
-
-	if token.Error() != nil {
-		return fmt.Errorf("发布消息到主题 %s 失败: %v", topic, token.Error())
+	if err := client.Publish(topic, qos, payload, 30*time.Second)(); err != nil {
+		return fmt.Errorf("发布消息到主题 %s 失败: %v", topic, err)
 	}
 
 	log.Printf("成功发布消息到主题: %s, QoS: %d", topic, qos)
@@ -339,14 +453,27 @@ func (m *MQTTClient) Publish(topic string, qos byte, payload interface{}) error
 // Disconnect 断开MQTT连接
 func (m *MQTTClient) Disconnect() {
 	log.Println("MQTTClient.Disconnect() 方法被调用")
+	// 先停止发布循环
+	m.StopPublishing()
+
 	m.mutex.RLock()
 	client := m.client
+	lifecycle := m.lifecycle
 	m.mutex.RUnlock()
 
+	if lifecycle != nil {
+		defer lifecycle.disconnected()
+	}
+
 	if client != nil && client.IsConnected() {
 		log.Println("MQTT客户端已连接，正在断开连接")
-		client.Disconnect(250)
+		client.Disconnect()
+		m.setConnected(false)
 		log.Printf("MQTT客户端已断开连接")
+	} else if client != nil {
+		// 正在自动重连的客户端也需要停止重连
+		log.Println("MQTT客户端未连接，停止自动重连")
+		client.Disconnect()
 	} else {
 		log.Println("MQTT客户端未连接或client为nil")
 	}
@@ -360,18 +487,10 @@ func (m *MQTTClient) IsConnected() bool {
 	return m.client != nil && m.client.IsConnected()
 }
 
-// GetTopic 获取订阅的主题
-func (m *MQTTClient) GetTopic() string {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
-	return m.topic
-}
-
-// GetQoS 获取订阅的QoS
-func (m *MQTTClient) GetQoS() byte {
+// GetSubscriptions 获取展开后的订阅列表
+func (m *MQTTClient) GetSubscriptions() []topic.Subscription {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	return m.qos
+	return m.subscriptions
 }
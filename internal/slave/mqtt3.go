@@ -0,0 +1,149 @@
+package slave
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"mqttbench/internal/credentials"
+)
+
+// mqtt3Client 使用paho.mqtt.golang的MQTT 3.1/3.1.1连接
+type mqtt3Client struct {
+	client          mqtt.Client
+	protocolVersion int
+}
+
+// newMQTT3Client 创建MQTT 3.1/3.1.1客户端，调用Connect后才开始连接
+func newMQTT3Client(config ConfigData, clientID string, endpoint *brokerEndpoint, credentials credentials.Provider, handlers connectionHandlers) *mqtt3Client {
+	// 设置MQTT客户端选项
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(endpoint.url.String())
+
+	// 每次连接（包括自动重连）时重新获取用户名和密码，使token类凭据不会过期
+	opts.SetClientID(clientID)
+	opts.SetCredentialsProvider(func() (string, string) {
+		username, password, err := credentials.Credentials(clientID)
+		if err != nil {
+			log.Printf("MQTT客户端 %s 获取凭据失败: %v", clientID, err)
+		}
+		return username, password
+	})
+
+	// 未指定版本时使用3.1.1，broker不支持时回退到3.1
+	if config.ProtocolVersion != 0 {
+		opts.SetProtocolVersion(uint(config.ProtocolVersion))
+	}
+
+	if will := config.Will; will != nil {
+		opts.SetWill(will.Topic, will.Payload, byte(will.QoS), will.Retain)
+	}
+
+	// 设置其他选项
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(10 * time.Second)
+	opts.SetKeepAlive(120 * time.Second)
+
+	// 网络连接自行建立，以便统计TCP建连和TLS握手耗时、附加WebSocket请求头和绑定源地址
+	opts.SetCustomOpenConnectionFn(func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+		return endpoint.dial(context.Background(), options.ConnectTimeout)
+	})
+
+	// 设置连接和断开连接的回调
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		handlers.onConnect()
+	})
+
+	opts.SetReconnectingHandler(func(c mqtt.Client, opts *mqtt.ClientOptions) {
+		handlers.onReconnecting()
+	})
+
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		handlers.onConnectionLost(err)
+	})
+
+	// 每次连接尝试失败（包括CONNACK拒绝连接）后客户端会按重试间隔再次连接
+	opts.SetConnectionNotificationHandler(func(c mqtt.Client, notification mqtt.ConnectionNotification) {
+		if failed, ok := notification.(mqtt.ConnectionNotificationFailed); ok {
+			handlers.onConnectError(failed.Reason)
+		}
+	})
+
+	return &mqtt3Client{
+		client:          mqtt.NewClient(opts),
+		protocolVersion: config.ProtocolVersion,
+	}
+}
+
+// Connect 连接到MQTT服务器
+func (c *mqtt3Client) Connect(timeout time.Duration) error {
+	token := c.client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return errConnectTimeout
+	}
+
+	// 记录CONNACK返回码
+	if connectToken, ok := token.(*mqtt.ConnectToken); ok {
+		countReasonCode(c.protocolVersion, PacketConnack, connectToken.ReturnCode())
+	}
+
+	if token.Error() != nil {
+		return fmt.Errorf("连接到MQTT服务器失败: %w", token.Error())
+	}
+	return nil
+}
+
+// IsConnected 检查是否已连接
+func (c *mqtt3Client) IsConnected() bool {
+	return c.client.IsConnected()
+}
+
+// Subscribe 订阅主题并等待SUBACK
+func (c *mqtt3Client) Subscribe(topic string, qos byte, timeout time.Duration, handler func(receivedMessage)) error {
+	token := c.client.Subscribe(topic, qos, func(client mqtt.Client, msg mqtt.Message) {
+		handler(receivedMessage{Topic: msg.Topic(), QoS: msg.Qos(), Payload: msg.Payload()})
+	})
+
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("订阅主题 %s 超时", topic)
+	}
+
+	if token.Error() != nil {
+		return fmt.Errorf("订阅主题 %s 失败: %v", topic, token.Error())
+	}
+
+	// 记录SUBACK中授予的QoS，0x80表示订阅失败
+	if subscribeToken, ok := token.(*mqtt.SubscribeToken); ok {
+		for _, code := range subscribeToken.Result() {
+			countReasonCode(c.protocolVersion, PacketSuback, code)
+			if code == 0x80 {
+				return fmt.Errorf("订阅主题 %s 被拒绝", topic)
+			}
+		}
+	}
+	return nil
+}
+
+// Publish 将消息放入发送队列，paho按调用顺序写入PUBLISH报文，返回的函数等待确认
+func (c *mqtt3Client) Publish(topic string, qos byte, payload []byte, timeout time.Duration) func() error {
+	deadline := time.Now().Add(timeout)
+	token := c.client.Publish(topic, qos, false, payload)
+	return func() error {
+		if !token.WaitTimeout(time.Until(deadline)) {
+			return fmt.Errorf("等待确认超时")
+		}
+		return token.Error()
+	}
+}
+
+// Disconnect 断开连接
+func (c *mqtt3Client) Disconnect() {
+	c.client.Disconnect(250)
+}
@@ -0,0 +1,466 @@
+package slave
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+
+	"mqttbench/internal/broker"
+	"mqttbench/internal/credentials"
+)
+
+// mqtt5Client 使用paho.golang的MQTT 5.0连接，断线后由autopaho自动重连
+type mqtt5Client struct {
+	config         ConfigData
+	options        broker.MQTT5Config
+	clientID       string
+	endpoint       *brokerEndpoint
+	credentials    credentials.Provider
+	handlers       connectionHandlers
+	userProperties paho.UserProperties
+
+	connected     atomic.Bool
+	everConnected atomic.Bool
+	rejected      chan error // 首次连接被broker拒绝时通知Connect，不再重试
+
+	mutex     sync.Mutex
+	cm        *autopaho.ConnectionManager
+	handler   func(receivedMessage) // 订阅消息的处理函数
+	lastError error                 // 最近一次连接失败的原因
+
+	// 发布按调用顺序串行写入，published在连接写完一个新的PUBLISH报文后收到通知
+	sendMutex sync.Mutex
+	published chan struct{}
+
+	// 发布使用的主题别名，连接建立后重置
+	aliasMutex   sync.Mutex
+	aliases      map[string]uint16
+	aliasMaximum uint16
+}
+
+// newMQTT5Client 创建MQTT 5.0客户端，调用Connect后才开始连接
+func newMQTT5Client(config ConfigData, clientID string, endpoint *brokerEndpoint, credentials credentials.Provider, handlers connectionHandlers) *mqtt5Client {
+	c := &mqtt5Client{
+		config:      config,
+		clientID:    clientID,
+		endpoint:    endpoint,
+		credentials: credentials,
+		handlers:    handlers,
+		rejected:    make(chan error, 1),
+		published:   make(chan struct{}, 1),
+		aliases:     make(map[string]uint16),
+	}
+	if config.MQTT5 != nil {
+		c.options = *config.MQTT5
+	}
+
+	// 按键排序，使每个报文中的用户属性顺序一致
+	keys := make([]string, 0, len(c.options.UserProperties))
+	for key := range c.options.UserProperties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c.userProperties = append(c.userProperties, paho.UserProperty{Key: key, Value: c.options.UserProperties[key]})
+	}
+
+	return c
+}
+
+// Connect 连接到MQTT服务器，首次连接被broker拒绝时立即返回
+func (c *mqtt5Client) Connect(timeout time.Duration) error {
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{c.endpoint.url},
+		KeepAlive:                     120,
+		CleanStartOnInitialConnection: true,
+		SessionExpiryInterval:         c.options.SessionExpiry,
+		ConnectRetryDelay:             10 * time.Second,
+		ConnectTimeout:                30 * time.Second,
+		// 用户名和密码在buildConnect中设置，每次连接（包括自动重连）时重新获取
+		ConnectPacketBuilder: c.buildConnect,
+		OnConnectionUp:       c.onConnectionUp,
+		OnConnectionDown:     c.onConnectionDown,
+		OnConnectError:       c.onConnectError,
+		ClientConfig: paho.ClientConfig{
+			ClientID:          c.clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.onPublishReceived},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				countReasonCode(broker.ProtocolMQTT5, PacketDisconnect, d.ReasonCode)
+			},
+			OnClientError: c.setLastError,
+		},
+	}
+
+	if will := c.config.Will; will != nil {
+		cfg.WillMessage = &paho.WillMessage{
+			Topic:   will.Topic,
+			Payload: []byte(will.Payload),
+			QoS:     byte(will.QoS),
+			Retain:  will.Retain,
+		}
+	}
+
+	// 网络连接自行建立，以便统计TCP建连和TLS握手耗时、附加WebSocket请求头和绑定源地址
+	cfg.AttemptConnection = func(ctx context.Context, cfg autopaho.ClientConfig, u *url.URL) (net.Conn, error) {
+		conn, err := c.endpoint.dial(ctx, cfg.ConnectTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &publishConn{Conn: conn, published: c.published}, nil
+	}
+
+	cm, err := autopaho.NewConnection(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("连接到MQTT服务器失败: %v", err)
+	}
+	c.mutex.Lock()
+	c.cm = cm
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	connected := make(chan error, 1)
+	go func() {
+		connected <- cm.AwaitConnection(ctx)
+	}()
+
+	select {
+	case err := <-c.rejected:
+		c.Disconnect()
+		return fmt.Errorf("连接到MQTT服务器失败: %w", err)
+	case err := <-connected:
+		if err == nil {
+			return nil
+		}
+	}
+
+	// 超时后停止重连
+	c.Disconnect()
+	if lastError := c.getLastError(); lastError != nil {
+		return fmt.Errorf("%w: %w", errConnectTimeout, lastError)
+	}
+	return errConnectTimeout
+}
+
+// buildConnect 在CONNECT报文中设置MQTT 5.0属性
+func (c *mqtt5Client) buildConnect(connect *paho.Connect, serverURL *url.URL) (*paho.Connect, error) {
+	username, password, err := c.credentials.Credentials(c.clientID)
+	if err != nil {
+		return nil, err
+	}
+	connect.UsernameFlag = true
+	connect.Username = username
+	connect.PasswordFlag = password != ""
+	connect.Password = []byte(password)
+
+	if connect.Properties == nil {
+		connect.Properties = &paho.ConnectProperties{}
+	}
+	if c.options.ReceiveMaximum > 0 {
+		connect.Properties.ReceiveMaximum = paho.Uint16(c.options.ReceiveMaximum)
+	}
+	if c.options.TopicAliasMaximum > 0 {
+		connect.Properties.TopicAliasMaximum = paho.Uint16(c.options.TopicAliasMaximum)
+	}
+	connect.Properties.User = c.userProperties
+	return connect, nil
+}
+
+// onConnectionUp 连接建立（包括自动重连）后记录CONNACK并重置主题别名
+func (c *mqtt5Client) onConnectionUp(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+	countReasonCode(broker.ProtocolMQTT5, PacketConnack, connack.ReasonCode)
+
+	c.mutex.Lock()
+	c.cm = cm
+	c.mutex.Unlock()
+
+	c.aliasMutex.Lock()
+	clear(c.aliases)
+	c.aliasMaximum = 0
+	if connack.Properties != nil && connack.Properties.TopicAliasMaximum != nil {
+		c.aliasMaximum = *connack.Properties.TopicAliasMaximum
+	}
+	c.aliasMutex.Unlock()
+
+	c.everConnected.Store(true)
+	c.connected.Store(true)
+
+	// 回调中会订阅主题并等待SUBACK，autopaho要求该函数不能阻塞
+	go c.handlers.onConnect()
+}
+
+// onConnectionDown 连接丢失后继续自动重连
+func (c *mqtt5Client) onConnectionDown() bool {
+	c.connected.Store(false)
+
+	err := c.getLastError()
+	if err == nil {
+		err = errors.New("connection lost")
+	}
+	go c.handlers.onConnectionLost(err)
+	c.handlers.onReconnecting()
+	return true
+}
+
+// onConnectError 记录连接失败的原因，首次连接被broker拒绝时通知Connect
+func (c *mqtt5Client) onConnectError(err error) {
+	c.setLastError(err)
+	c.handlers.onConnectError(err)
+
+	var connackErr *autopaho.ConnackError
+	if errors.As(err, &connackErr) {
+		countReasonCode(broker.ProtocolMQTT5, PacketConnack, connackErr.ReasonCode)
+		if !c.everConnected.Load() {
+			select {
+			case c.rejected <- err:
+			default:
+			}
+			return
+		}
+	}
+
+	// 已连接过的客户端失败后会再次重连
+	if c.everConnected.Load() {
+		c.handlers.onReconnecting()
+	}
+}
+
+// onPublishReceived 将收到的消息交给订阅时设置的处理函数
+func (c *mqtt5Client) onPublishReceived(pr paho.PublishReceived) (bool, error) {
+	c.mutex.Lock()
+	handler := c.handler
+	c.mutex.Unlock()
+
+	if handler == nil {
+		return false, nil
+	}
+	handler(receivedMessage{Topic: pr.Packet.Topic, QoS: pr.Packet.QoS, Payload: pr.Packet.Payload})
+	return true, nil
+}
+
+// setLastError 记录最近一次连接错误
+func (c *mqtt5Client) setLastError(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lastError = err
+}
+
+// getLastError 获取最近一次连接错误
+func (c *mqtt5Client) getLastError() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lastError
+}
+
+// connectionManager 获取autopaho连接管理器
+func (c *mqtt5Client) connectionManager() *autopaho.ConnectionManager {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.cm
+}
+
+// IsConnected 检查是否已连接
+func (c *mqtt5Client) IsConnected() bool {
+	return c.connected.Load()
+}
+
+// Subscribe 订阅主题并等待SUBACK
+func (c *mqtt5Client) Subscribe(topic string, qos byte, timeout time.Duration, handler func(receivedMessage)) error {
+	cm := c.connectionManager()
+	if cm == nil {
+		return fmt.Errorf("MQTT客户端未连接")
+	}
+
+	c.mutex.Lock()
+	c.handler = handler
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	suback, err := cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: qos}},
+	})
+	if suback != nil {
+		for _, code := range suback.Reasons {
+			countReasonCode(broker.ProtocolMQTT5, PacketSuback, code)
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("订阅主题 %s 超时", topic)
+	}
+	if err != nil {
+		return fmt.Errorf("订阅主题 %s 失败: %v", topic, err)
+	}
+	return nil
+}
+
+// Publish 按调用顺序写入PUBLISH报文后返回等待确认的函数，开启主题别名时同一主题只在第一次发布时携带主题名
+func (c *mqtt5Client) Publish(topic string, qos byte, payload []byte, timeout time.Duration) func() error {
+	cm := c.connectionManager()
+	if cm == nil {
+		return func() error { return fmt.Errorf("MQTT客户端未连接") }
+	}
+
+	publish := &paho.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Payload:    payload,
+		Properties: &paho.PublishProperties{User: c.userProperties},
+	}
+
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if !c.options.TopicAlias {
+		wait, _ := c.send(cm, publish, timeout)
+		return wait
+	}
+
+	c.aliasMutex.Lock()
+	defer c.aliasMutex.Unlock()
+
+	alias, ok := c.aliases[topic]
+	if !ok && len(c.aliases) < int(c.aliasMaximum) {
+		// 第一次使用别名时同时发送主题名和别名，报文按顺序写入，broker先收到别名定义
+		alias = uint16(len(c.aliases) + 1)
+		publish.Properties.TopicAlias = paho.Uint16(alias)
+		wait, written := c.send(cm, publish, timeout)
+		if written {
+			c.aliases[topic] = alias
+		}
+		return wait
+	}
+
+	if ok {
+		publish.Topic = ""
+		publish.Properties.TopicAlias = paho.Uint16(alias)
+	}
+	wait, _ := c.send(cm, publish, timeout)
+	return wait
+}
+
+// send 等待PUBLISH报文写入连接后返回，确认在后台等待。written表示报文是否已写入，调用方需持有sendMutex
+func (c *mqtt5Client) send(cm *autopaho.ConnectionManager, publish *paho.Publish, timeout time.Duration) (wait func() error, written bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	// QoS 0没有确认，写入后即返回
+	if publish.QoS == 0 {
+		defer cancel()
+		err := c.publish(ctx, cm, publish)
+		return func() error { return err }, err == nil
+	}
+
+	// 丢弃之前的发布遗留的通知，此后收到的通知只能来自本次发布
+	select {
+	case <-c.published:
+	default:
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer cancel()
+		done <- c.publish(ctx, cm, publish)
+	}()
+
+	select {
+	case <-c.published:
+		return func() error { return <-done }, true
+	case err := <-done:
+		// 写入后立即收到确认时两个通知可能同时就绪，写入的通知总是先于发布返回
+		select {
+		case <-c.published:
+			written = true
+		default:
+		}
+		return func() error { return err }, written
+	}
+}
+
+// publish 发送PUBLISH报文并记录PUBACK/PUBREC/PUBCOMP的原因码
+func (c *mqtt5Client) publish(ctx context.Context, cm *autopaho.ConnectionManager, publish *paho.Publish) error {
+	resp, err := cm.Publish(ctx, publish)
+	if resp != nil && publish.QoS > 0 {
+		packet := PacketPuback
+		if publish.QoS == 2 {
+			// QoS 2在PUBREC中返回错误，成功时为PUBCOMP的原因码
+			packet = PacketPubcomp
+			if resp.ReasonCode >= 0x80 {
+				packet = PacketPubrec
+			}
+		}
+		countReasonCode(broker.ProtocolMQTT5, packet, resp.ReasonCode)
+
+		if err == nil && resp.ReasonCode >= 0x80 {
+			err = fmt.Errorf("%s reason code 0x%02X", packet, resp.ReasonCode)
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("等待确认超时")
+	}
+	return err
+}
+
+// Disconnect 断开连接并停止自动重连
+func (c *mqtt5Client) Disconnect() {
+	cm := c.connectionManager()
+	if cm == nil {
+		return
+	}
+	c.connected.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cm.Disconnect(ctx)
+}
+
+// publishConn 串行写入MQTT报文的连接。paho写报文前会加锁，
+// 解锁时如果写入的是首次发送（非DUP）的PUBLISH报文，通知等待写入的发布
+type publishConn struct {
+	net.Conn
+	published chan<- struct{}
+
+	mutex     sync.Mutex
+	first     bool // 下一次写入的是报文的第一个字节
+	isPublish bool // 当前写入的是首次发送的PUBLISH报文
+}
+
+// Lock 开始写入一个报文
+func (c *publishConn) Lock() {
+	c.mutex.Lock()
+	c.first = true
+	c.isPublish = false
+}
+
+// Unlock 报文写入结束
+func (c *publishConn) Unlock() {
+	if c.isPublish {
+		select {
+		case c.published <- struct{}{}:
+		default:
+		}
+	}
+	c.mutex.Unlock()
+}
+
+// Write 根据报文第一个字节的类型和DUP标志判断是否为首次发送的PUBLISH报文
+func (c *publishConn) Write(p []byte) (int, error) {
+	if c.first && len(p) > 0 {
+		c.first = false
+		c.isPublish = p[0]>>4 == packets.PUBLISH && p[0]&0x08 == 0
+	}
+	return c.Conn.Write(p)
+}
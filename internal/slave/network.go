@@ -7,17 +7,36 @@ import (
 	"log"
 	"net"
 	"sync"
+
+	"mqttbench/internal/ack"
+	"mqttbench/internal/broker"
+	"mqttbench/internal/chaos"
+	"mqttbench/internal/credentials"
+	"mqttbench/internal/diagnostics"
+	"mqttbench/internal/messagetest"
+	"mqttbench/internal/payload"
+	"mqttbench/internal/ramp"
+	"mqttbench/internal/topic"
 )
 
 // 定义停止函数类型
 type StopFunc func()
 
+// CommandHandler 命令处理函数，返回错误时slave向master回复error
+type CommandHandler func(config ConfigData) error
+
 // 用于存储停止函数的全局变量
 var (
 	stopSlaveWithoutStatusChangeFunc StopFunc
 	stopFuncMutex                    sync.RWMutex
 )
 
+// 用于存储命令处理函数的全局变量
+var (
+	commandHandler      CommandHandler
+	commandHandlerMutex sync.RWMutex
+)
+
 // SetMasterInfo 设置Master连接信息
 func SetMasterInfo(ip string, port int, id int) {
 	// 移除未使用的masterPort变量赋值
@@ -33,23 +52,84 @@ func SetStopFunc(stopFunc StopFunc) {
 	stopSlaveWithoutStatusChangeFunc = stopFunc
 }
 
-// Message 定义消息结构
+// SetCommandHandler 设置命令处理函数，设置后配置消息由该函数同步处理，处理结果回复给master
+func SetCommandHandler(handler CommandHandler) {
+	commandHandlerMutex.Lock()
+	defer commandHandlerMutex.Unlock()
+
+	commandHandler = handler
+}
+
+// Message 定义消息结构，master下发的命令带有ID，回复时使用相同的ID
 type Message struct {
 	Type    string      `json:"type"`
+	ID      uint64      `json:"id,omitempty"`
 	Content interface{} `json:"content"`
 }
 
+// CommandAck 命令回复内容，Error不为空表示拒绝执行命令，查询类命令的结果放在Result中
+type CommandAck struct {
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// newReply 根据命令处理结果构造回复消息，成功时类型为ack，失败时为error
+func newReply(id uint64, result interface{}, err error) Message {
+	if err != nil {
+		return Message{Type: "error", ID: id, Content: CommandAck{Error: err.Error()}}
+	}
+	return Message{Type: "ack", ID: id, Content: CommandAck{Result: result}}
+}
+
 // ConfigData 配置数据结构
 type ConfigData struct {
 	MqttHost string `json:"mqtt_host"`
 	MqttPort int    `json:"mqtt_port"`
 	Command  string `json:"command"` // 添加命令字段
-	Topic    string `json:"topic"`
+	Topic    string `json:"topic"`   // 订阅主题模板，未设置订阅列表时订阅该主题
 	QoS      int    `json:"qos"`
 	ClientID string `json:"client_id"`
 	Start    int    `json:"start"`
 	Step     int    `json:"step"`
-	AckTopic string `json:"ack_topic"` // ACK主题配置
+	AckTopic string `json:"ack_topic"` // ACK主题模板，为空时为EEW/ACK/Channel1
+
+	Ack *ack.Config `json:"ack,omitempty"` // ACK回复方式，为空时按EEW协议回复
+
+	Subscriptions  []topic.Subscription `json:"subscriptions,omitempty"` // 每个客户端的订阅列表，为空时订阅Topic
+	TopicGroupSize int                  `json:"topic_group_size"`        // {{group}}占位符的分组大小
+	Will           *topic.WillConfig    `json:"will,omitempty"`          // 遗嘱消息，为空时不设置
+
+	ProtocolVersion int                 `json:"protocol_version"` // MQTT协议版本：3/4/5，为0时使用3.1.1
+	MQTT5           *broker.MQTT5Config `json:"mqtt5,omitempty"`  // MQTT 5.0连接参数
+	TLS             *broker.TLSConfig   `json:"tls,omitempty"`    // TLS配置，为空时使用明文TCP连接
+
+	// 传输方式：tcp/ssl/ws/wss，为空时按是否启用TLS选择tcp或ssl
+	Transport string                  `json:"transport"`
+	WebSocket *broker.WebSocketConfig `json:"websocket,omitempty"` // WebSocket路径和请求头，仅用于ws/wss
+
+	Credentials *credentials.Config `json:"credentials,omitempty"` // 认证方式，为空时用户名和密码均为客户端ID
+
+	// broker集群的节点列表，为空时连接MqttHost:MqttPort
+	Brokers      []broker.Node `json:"brokers,omitempty"`
+	BrokerPolicy string        `json:"broker_policy"` // 客户端分配到节点的方式：round_robin/random/weighted/hash，为空时为round_robin
+
+	// 本地源地址，每项为IP或CIDR，客户端按序号轮流绑定；为空时由系统选择源地址
+	SourceIPs []string `json:"source_ips,omitempty"`
+
+	// 发布模式配置
+	Mode        string  `json:"mode"`         // 客户端模式：subscribe/publish/both/connect，为空时为subscribe
+	PubTopic    string  `json:"pub_topic"`    // 发布主题，为空时使用Topic
+	PubRate     float64 `json:"pub_rate"`     // 每个客户端每秒发布的消息数
+	PayloadSize int     `json:"payload_size"` // 发布消息的大小（字节）
+	PubQoS      int     `json:"pub_qos"`      // 发布消息的QoS
+
+	Payload *payload.Config `json:"payload,omitempty"` // 发布消息的生成方式，为空时为嵌入发送时间和序号的JSON消息
+
+	Ramp *ramp.Config `json:"ramp,omitempty"` // 建连策略，为空时同时建立所有连接
+
+	MessageTest *messagetest.Spec `json:"message_test,omitempty"` // 消息测试参数，仅用于message_test命令
+
+	Chaos *chaos.Action `json:"chaos,omitempty"` // 故障注入参数，仅用于chaos命令
 }
 
 // StartSlaveServer 启动slave服务器，监听随机端口
@@ -123,44 +203,89 @@ func handleConnection(conn net.Conn, messageChan chan<- Message, configChan chan
 
 		log.Printf("接收到消息: Type=%s, Content=%v", msg.Type, msg.Content)
 
-		// 检查消息类型
-		if msg.Type == "config" {
-			// 添加调试日志
-			log.Printf("Received config message: %+v", msg)
-
-			// 如果是配置消息，尝试解析为配置数据
-			if contentBytes, err := json.Marshal(msg.Content); err == nil {
-				var configData ConfigData
-				if err := json.Unmarshal(contentBytes, &configData); err == nil {
-					// 检查是否有启动命令
-					if configData.Command == "start" {
-						log.Printf("Received start command")
-					}
-
-					// 检查是否有停止命令
-					if configData.Command == "stop" {
-						log.Printf("Received stop command")
-						// 处理停止命令
-						handleStopCommand()
-					} else {
-						log.Printf("Received config command: %s", configData.Command)
-					}
-
-					// 将配置数据发送到配置通道
-					configChan <- configData
-					log.Printf("Received config update: %+v", configData)
-				} else {
-					log.Printf("Error parsing config data: %v", err)
-				}
+		result, err := dispatchMessage(msg, messageChan, configChan)
+
+		// 带ID的命令在同一连接上回复处理结果
+		if msg.ID != 0 {
+			if err := json.NewEncoder(conn).Encode(newReply(msg.ID, result, err)); err != nil {
+				log.Printf("发送命令回复失败: %v", err)
+				return
 			}
-		} else {
-			// 将其他类型的消息发送到消息通道
-			messageChan <- msg
-			log.Printf("Received message: Type=%s, Content=%v", msg.Type, msg.Content)
 		}
 	}
 }
 
+// dispatchMessage 分发master发来的消息，返回配置消息的处理结果或查询命令的结果。
+// 设置了命令处理函数时配置消息由其同步处理，否则写入配置通道；其他消息写入消息通道
+func dispatchMessage(msg Message, messageChan chan<- Message, configChan chan<- ConfigData) (interface{}, error) {
+	// 查询客户端记录，结果随回复返回
+	if msg.Type == "query_clients" {
+		return handleClientQuery(msg.Content)
+	}
+
+	// 检查消息类型
+	if msg.Type != "config" {
+		// 将其他类型的消息发送到消息通道
+		messageChan <- msg
+		log.Printf("Received message: Type=%s, Content=%v", msg.Type, msg.Content)
+		return nil, nil
+	}
+
+	// 添加调试日志，不记录原始内容，避免TLS私钥写入日志
+	log.Printf("Received config message: ID=%d", msg.ID)
+
+	// 如果是配置消息，尝试解析为配置数据
+	contentBytes, err := json.Marshal(msg.Content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config message: %v", err)
+	}
+	var configData ConfigData
+	if err := json.Unmarshal(contentBytes, &configData); err != nil {
+		log.Printf("Error parsing config data: %v", err)
+		return nil, fmt.Errorf("invalid config data: %v", err)
+	}
+
+	// 检查是否有启动命令
+	if configData.Command == "start" {
+		log.Printf("Received start command")
+	}
+
+	// 检查是否有停止命令
+	if configData.Command == "stop" {
+		log.Printf("Received stop command")
+		// 处理停止命令
+		handleStopCommand()
+	} else {
+		log.Printf("Received config command: %s", configData.Command)
+	}
+
+	commandHandlerMutex.RLock()
+	handler := commandHandler
+	commandHandlerMutex.RUnlock()
+
+	if handler != nil {
+		return nil, handler(configData)
+	}
+
+	// 将配置数据发送到配置通道
+	configChan <- configData
+	log.Printf("Received config update: %+v", configData)
+	return nil, nil
+}
+
+// handleClientQuery 解析查询条件并查询客户端记录
+func handleClientQuery(content interface{}) (interface{}, error) {
+	contentBytes, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client query: %v", err)
+	}
+	var query diagnostics.Query
+	if err := json.Unmarshal(contentBytes, &query); err != nil {
+		return nil, fmt.Errorf("invalid client query: %v", err)
+	}
+	return QueryClients(query)
+}
+
 // handleStopCommand 处理停止命令
 func handleStopCommand() {
 	// 断开所有MQTT连接
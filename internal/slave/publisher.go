@@ -0,0 +1,161 @@
+package slave
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"mqttbench/internal/workload"
+)
+
+// maxInflightPublishes 每个客户端同时等待确认的最大消息数，达到上限时跳过本次发布
+const maxInflightPublishes = 64
+
+// 发布相关的计数器
+var (
+	publishCount        int64 // 发布成功的消息数
+	publishFailureCount int64 // 发布失败的消息数
+	publishSkippedCount int64 // 因等待确认的消息过多而跳过的发布次数，跳过时不占用序号
+)
+
+// publishInterval 返回速率对应的发布间隔，速率极高时至少为1纳秒
+func publishInterval(rate float64) time.Duration {
+	return max(time.Duration(float64(time.Second)/rate), time.Nanosecond)
+}
+
+// GetPublishCount 获取发布成功的消息数
+func GetPublishCount() int64 {
+	return atomic.LoadInt64(&publishCount)
+}
+
+// GetPublishFailureCount 获取发布失败的消息数
+func GetPublishFailureCount() int64 {
+	return atomic.LoadInt64(&publishFailureCount)
+}
+
+// GetPublishSkippedCount 获取因等待确认的消息过多而跳过的发布次数
+func GetPublishSkippedCount() int64 {
+	return atomic.LoadInt64(&publishSkippedCount)
+}
+
+// ResetPublishCount 重置发布计数
+func ResetPublishCount() {
+	atomic.StoreInt64(&publishCount, 0)
+	atomic.StoreInt64(&publishFailureCount, 0)
+	atomic.StoreInt64(&publishSkippedCount, 0)
+}
+
+// StartPublishing 按配置的速率、消息大小和QoS开始发布消息
+func (m *MQTTClient) StartPublishing(clientID string) {
+	rate := m.config.PubRate
+	if err := workload.ValidatePublishRate(rate, false); err != nil {
+		log.Printf("MQTT客户端 %s 发布速率无效，不启动发布: %v", clientID, err)
+		return
+	}
+
+	topic := m.config.PubTopic
+	if topic == "" {
+		topic = m.config.Topic
+	}
+	topic = m.config.ExpandTopic(topic, m.topicVars)
+	if topic == "" {
+		log.Printf("MQTT客户端 %s 未配置发布主题，不启动发布", clientID)
+		return
+	}
+	qos := byte(m.config.PubQoS)
+
+	// 每个客户端使用独立的消息生成器，json类型只生成一次填充内容，每条消息只更新嵌入的发送时间和序号
+	generator, err := m.config.Payload.NewGenerator(clientID, m.config.PayloadSize)
+	if err != nil {
+		log.Printf("MQTT客户端 %s 创建消息生成器失败，不启动发布: %v", clientID, err)
+		return
+	}
+
+	m.mutex.Lock()
+	client := m.client
+	if client == nil {
+		m.mutex.Unlock()
+		log.Printf("MQTT客户端 %s 未连接，不启动发布", clientID)
+		return
+	}
+	if m.publishStop != nil {
+		// 已经在发布中
+		m.mutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	m.publishStop = stop
+	m.mutex.Unlock()
+
+	interval := publishInterval(rate)
+	inflight := make(chan struct{}, maxInflightPublishes)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// 断线期间跳过发布，等待自动重连
+				if !client.IsConnected() {
+					continue
+				}
+
+				// 等待确认的消息达到上限时跳过本次发布，避免确认慢时发布速率下降或协程堆积
+				select {
+				case inflight <- struct{}{}:
+				default:
+					atomic.AddInt64(&publishSkippedCount, 1)
+					continue
+				}
+
+				// 生成器不是并发安全的，在发布循环中生成消息。每次发布都使用新的序号，发布失败的消息在订阅端表现为丢失
+				seq := m.publishSeq.Add(1)
+				payload := generator.Next(seq)
+
+				// PUBLISH报文在发布循环中按序号顺序写入，只在后台等待确认
+				wait := client.Publish(topic, qos, payload, 30*time.Second)
+				go func() {
+					defer func() { <-inflight }()
+					if err := wait(); err != nil {
+						atomic.AddInt64(&publishFailureCount, 1)
+						return
+					}
+					atomic.AddInt64(&publishCount, 1)
+					m.brokerStats.published.Add(1)
+				}()
+			}
+		}
+	}()
+}
+
+// StopPublishing 停止发布循环
+func (m *MQTTClient) StopPublishing() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.publishStop != nil {
+		close(m.publishStop)
+		m.publishStop = nil
+	}
+}
+
+// UpdatePublishing 使用新的发布参数重新开始发布，速率为0时只停止发布
+func (m *MQTTClient) UpdatePublishing(clientID string, config ConfigData) {
+	m.StopPublishing()
+
+	m.mutex.Lock()
+	m.config.PubTopic = config.PubTopic
+	m.config.PubRate = config.PubRate
+	m.config.PayloadSize = config.PayloadSize
+	m.config.PubQoS = config.PubQoS
+	m.config.Payload = config.Payload
+	m.mutex.Unlock()
+
+	if config.PubRate > 0 {
+		m.StartPublishing(clientID)
+	}
+}
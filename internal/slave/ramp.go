@@ -0,0 +1,168 @@
+package slave
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mqttbench/internal/ramp"
+)
+
+// 建连期间上报进度的间隔
+const rampProgressInterval = time.Second
+
+// ErrRampAborted 连接建立后建连已被中止，connect返回该错误时既不计为成功也不计为失败
+var ErrRampAborted = errors.New("ramp aborted")
+
+// RunRamp 按建连策略为0到total-1的每个序号在新的goroutine中调用connect，等待所有连接结束后返回进度。
+// aborted返回true时不再建立剩余的连接；report不为nil时建连期间定时调用以上报进度
+func RunRamp(config *ramp.Config, total int, connect func(index int) error, aborted func() bool, report func(ramp.Progress)) ramp.Progress {
+	strategy := config.StrategyName()
+	startTime := time.Now()
+	interval := config.Interval(total)
+
+	var attempted, connected, failed atomic.Int64
+	var stopped atomic.Bool
+
+	progress := func(lastConnected int64, elapsed time.Duration) ramp.Progress {
+		current := connected.Load()
+		p := ramp.Progress{
+			Strategy:  strategy,
+			Target:    total,
+			Attempted: int(attempted.Load()),
+			Connected: int(current),
+			Failed:    int(failed.Load()),
+			Elapsed:   time.Since(startTime).Seconds(),
+			Aborted:   stopped.Load(),
+		}
+		if elapsed > 0 {
+			p.Rate = float64(current-lastConnected) / elapsed.Seconds()
+		}
+		return p
+	}
+
+	// 定时上报进度
+	reportDone := make(chan struct{})
+	var reportWg sync.WaitGroup
+	if report != nil {
+		reportWg.Add(1)
+		go func() {
+			defer reportWg.Done()
+			ticker := time.NewTicker(rampProgressInterval)
+			defer ticker.Stop()
+
+			var lastConnected int64
+			for {
+				select {
+				case <-reportDone:
+					return
+				case <-ticker.C:
+					p := progress(lastConnected, rampProgressInterval)
+					lastConnected = int64(p.Connected)
+					report(p)
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	var batchWg sync.WaitGroup
+	for i := 0; i < total; i++ {
+		// 按策略等待到第i个连接的开始时间
+		switch strategy {
+		case ramp.Rate, ramp.Linear:
+			sleepUnlessAborted(time.Until(startTime.Add(time.Duration(i)*interval)), aborted)
+		case ramp.Batch:
+			if i > 0 && i%config.BatchSize == 0 {
+				batchWg.Wait()
+				sleepUnlessAborted(time.Duration(config.BatchPause)*time.Millisecond, aborted)
+			}
+		}
+
+		if aborted() {
+			stopped.Store(true)
+			log.Printf("建连已被中止，剩余 %d 个客户端未连接", total-i)
+			break
+		}
+
+		attempted.Add(1)
+		wg.Add(1)
+		batchWg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			defer batchWg.Done()
+
+			if err := connect(index); err != nil {
+				if !errors.Is(err, ErrRampAborted) {
+					failed.Add(1)
+				}
+				return
+			}
+			connected.Add(1)
+		}(i)
+	}
+	wg.Wait()
+
+	close(reportDone)
+	reportWg.Wait()
+
+	elapsed := time.Since(startTime)
+	final := progress(0, elapsed)
+	final.Done = true
+	if report != nil {
+		report(final)
+	}
+	return final
+}
+
+// sleepUnlessAborted 等待指定时间，期间aborted返回true时提前返回
+func sleepUnlessAborted(d time.Duration, aborted func() bool) {
+	const step = 100 * time.Millisecond
+
+	deadline := time.Now().Add(d)
+	for remaining := d; remaining > 0 && !aborted(); remaining = time.Until(deadline) {
+		time.Sleep(min(remaining, step))
+	}
+}
+
+// SendRampProgress 上报建连进度，控制通道已连接时通过控制通道发送，否则使用HTTP
+func SendRampProgress(masterIP string, masterPort int, progress ramp.Progress) error {
+	if err := SendControlMessage("ramp_progress", progress); err == nil {
+		return nil
+	}
+
+	// 将数据序列化为JSON
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ramp progress: %v", err)
+	}
+
+	// 构造master的建连进度URL
+	progressURL := fmt.Sprintf("http://%s/ramp-progress", net.JoinHostPort(masterIP, strconv.Itoa(masterPort)))
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
+	// 发送POST请求
+	resp, err := client.Post(progressURL, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to send ramp progress: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 检查响应状态
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ramp progress failed with status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package slave
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"mqttbench/internal/broker"
+)
+
+// 统计原因码的报文类型
+const (
+	PacketConnack    = "connack"
+	PacketSuback     = "suback"
+	PacketPuback     = "puback"
+	PacketPubrec     = "pubrec"
+	PacketPubcomp    = "pubcomp"
+	PacketDisconnect = "disconnect"
+)
+
+// reasonCodeKey 原因码计数的键
+type reasonCodeKey struct {
+	packet string
+	code   byte
+}
+
+// 原因码计数，在每次启动时重置
+var (
+	reasonCodeCounts = make(map[reasonCodeKey]*broker.ReasonCodeCount)
+	reasonCodeMutex  sync.Mutex
+)
+
+// MQTT 5.0 原因码说明，0x00到0x02的含义与报文类型有关，由reasonCodeName单独处理
+var reasonCodeNames = map[byte]string{
+	0x04: "Disconnect with Will Message",
+	0x10: "No matching subscribers",
+	0x11: "No subscription existed",
+	0x18: "Continue authentication",
+	0x19: "Re-authenticate",
+	0x80: "Unspecified error",
+	0x81: "Malformed Packet",
+	0x82: "Protocol Error",
+	0x83: "Implementation specific error",
+	0x84: "Unsupported Protocol Version",
+	0x85: "Client Identifier not valid",
+	0x86: "Bad User Name or Password",
+	0x87: "Not authorized",
+	0x88: "Server unavailable",
+	0x89: "Server busy",
+	0x8A: "Banned",
+	0x8B: "Server shutting down",
+	0x8C: "Bad authentication method",
+	0x8D: "Keep Alive timeout",
+	0x8E: "Session taken over",
+	0x8F: "Topic Filter invalid",
+	0x90: "Topic Name invalid",
+	0x91: "Packet Identifier in use",
+	0x92: "Packet Identifier not found",
+	0x93: "Receive Maximum exceeded",
+	0x94: "Topic Alias invalid",
+	0x95: "Packet too large",
+	0x96: "Message rate too high",
+	0x97: "Quota exceeded",
+	0x98: "Administrative action",
+	0x99: "Payload format invalid",
+	0x9A: "Retain not supported",
+	0x9B: "QoS not supported",
+	0x9C: "Use another server",
+	0x9D: "Server moved",
+	0x9E: "Shared Subscriptions not supported",
+	0x9F: "Connection rate exceeded",
+	0xA0: "Maximum connect time",
+	0xA1: "Subscription Identifiers not supported",
+	0xA2: "Wildcard Subscriptions not supported",
+}
+
+// MQTT 3.1.1 CONNACK返回码说明
+var connackReturnCodeNames = map[byte]string{
+	0x00: "Connection Accepted",
+	0x01: "Unacceptable protocol version",
+	0x02: "Identifier rejected",
+	0x03: "Server unavailable",
+	0x04: "Bad user name or password",
+	0x05: "Not authorized",
+}
+
+// reasonCodeName 返回原因码的说明
+func reasonCodeName(protocolVersion int, packet string, code byte) string {
+	if protocolVersion != broker.ProtocolMQTT5 && packet == PacketConnack {
+		if name, ok := connackReturnCodeNames[code]; ok {
+			return name
+		}
+		return "Unknown"
+	}
+
+	switch {
+	case packet == PacketSuback && code <= 0x02:
+		return fmt.Sprintf("Granted QoS %d", code)
+	case packet == PacketDisconnect && code == 0x00:
+		return "Normal disconnection"
+	case code == 0x00:
+		return "Success"
+	}
+
+	if name, ok := reasonCodeNames[code]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// countReasonCode 记录一次broker返回的原因码
+func countReasonCode(protocolVersion int, packet string, code byte) {
+	reasonCodeMutex.Lock()
+	defer reasonCodeMutex.Unlock()
+
+	key := reasonCodeKey{packet: packet, code: code}
+	count, ok := reasonCodeCounts[key]
+	if !ok {
+		count = &broker.ReasonCodeCount{Packet: packet, Code: code, Reason: reasonCodeName(protocolVersion, packet, code)}
+		reasonCodeCounts[key] = count
+	}
+	count.Count++
+}
+
+// GetReasonCodeCounts 获取各原因码的次数，按报文类型和原因码排序
+func GetReasonCodeCounts() []broker.ReasonCodeCount {
+	reasonCodeMutex.Lock()
+	defer reasonCodeMutex.Unlock()
+
+	counts := make([]broker.ReasonCodeCount, 0, len(reasonCodeCounts))
+	for _, count := range reasonCodeCounts {
+		counts = append(counts, *count)
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Packet != counts[j].Packet {
+			return counts[i].Packet < counts[j].Packet
+		}
+		return counts[i].Code < counts[j].Code
+	})
+	return counts
+}
+
+// ResetReasonCodeCounts 重置原因码计数
+func ResetReasonCodeCounts() {
+	reasonCodeMutex.Lock()
+	defer reasonCodeMutex.Unlock()
+
+	clear(reasonCodeCounts)
+}
@@ -0,0 +1,145 @@
+package slave
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MetricSample 推送给master的周期性指标采样，master以接收时间保存为models.MetricSample
+type MetricSample struct {
+	SlaveID          int     `json:"slave_id"`
+	Interval         float64 `json:"interval"` // 采样周期（秒），采样时间以master接收时间为准
+	ConnectedClients int     `json:"connected_clients"`
+	ReceivedRate     float64 `json:"received_rate"` // 每秒接收的消息数
+	PublishRate      float64 `json:"publish_rate"`  // 每秒发布的消息数
+	AckRate          float64 `json:"ack_rate"`      // 每秒发送的ACK数
+	PublishFailures  int64   `json:"publish_failures"`
+	AckFailures      int64   `json:"ack_failures"`
+	Reconnects       int64   `json:"reconnects"`
+	LatencyCount     int64   `json:"latency_count"`
+	LatencyP50       float64 `json:"latency_p50"` // 毫秒
+	LatencyP90       float64 `json:"latency_p90"`
+	LatencyP99       float64 `json:"latency_p99"`
+	LatencyMax       float64 `json:"latency_max"`
+}
+
+// counterSnapshot 上一次采样时的计数器值
+type counterSnapshot struct {
+	received        int64
+	published       int64
+	acks            int64
+	publishFailures int64
+	ackFailures     int64
+	reconnects      int64
+}
+
+// takeCounterSnapshot 读取当前的计数器值
+func takeCounterSnapshot() counterSnapshot {
+	return counterSnapshot{
+		received:        GetMessageCount(),
+		published:       GetPublishCount(),
+		acks:            GetAckMessageCount(),
+		publishFailures: GetPublishFailureCount(),
+		ackFailures:     GetAckFailureCount(),
+		reconnects:      GetReconnectCount(),
+	}
+}
+
+// counterDelta 计算计数器增量，计数器在两次采样之间被重置时使用当前值
+func counterDelta(current, last int64) int64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+// StartMetricsReporter 按interval周期采样并推送到master，没有连接和流量时不推送
+func StartMetricsReporter(masterIP string, masterPort int, slaveID int, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := takeCounterSnapshot()
+		lastTime := time.Now()
+
+		for now := range ticker.C {
+			current := takeCounterSnapshot()
+			seconds := now.Sub(lastTime).Seconds()
+			latency := takeSampleLatency()
+
+			sample := MetricSample{
+				SlaveID:          slaveID,
+				Interval:         seconds,
+				ConnectedClients: GetConnectedClients(),
+				ReceivedRate:     float64(counterDelta(current.received, last.received)) / seconds,
+				PublishRate:      float64(counterDelta(current.published, last.published)) / seconds,
+				AckRate:          float64(counterDelta(current.acks, last.acks)) / seconds,
+				PublishFailures:  counterDelta(current.publishFailures, last.publishFailures),
+				AckFailures:      counterDelta(current.ackFailures, last.ackFailures),
+				Reconnects:       counterDelta(current.reconnects, last.reconnects),
+				LatencyCount:     latency.Count,
+				LatencyP50:       latency.P50,
+				LatencyP90:       latency.P90,
+				LatencyP99:       latency.P99,
+				LatencyMax:       latency.Max,
+			}
+			last = current
+			lastTime = now
+
+			if sample.isIdle() {
+				continue
+			}
+
+			if err := SendMetricSample(masterIP, masterPort, sample); err != nil {
+				log.Printf("发送指标采样到master失败: %v", err)
+			}
+		}
+	}()
+}
+
+// isIdle 检查采样周期内是否没有任何连接和流量
+func (s MetricSample) isIdle() bool {
+	return s.ConnectedClients == 0 && s.ReceivedRate == 0 && s.PublishRate == 0 && s.AckRate == 0 &&
+		s.PublishFailures == 0 && s.AckFailures == 0 && s.Reconnects == 0
+}
+
+// SendMetricSample 发送指标采样到master，控制通道已连接时通过控制通道发送，否则使用HTTP
+func SendMetricSample(masterIP string, masterPort int, sample MetricSample) error {
+	if err := SendControlMessage("metric_sample", sample); err == nil {
+		return nil
+	}
+
+	// 将数据序列化为JSON
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metric sample: %v", err)
+	}
+
+	// 构造master的指标采样URL
+	sampleURL := fmt.Sprintf("http://%s/metric-sample", net.JoinHostPort(masterIP, strconv.Itoa(masterPort)))
+
+	// 创建HTTP客户端，采样周期较短，超时时间不宜过长
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
+	// 发送POST请求
+	resp, err := client.Post(sampleURL, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to send metric sample: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 检查响应状态
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("metric sample failed with status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package slave
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"mqttbench/internal/metrics"
+	"mqttbench/internal/payload"
+)
+
+// 发布消息中嵌入发布者ID和序号的JSON字段
+const (
+	PublisherKey = payload.PublisherKey // 发布者的客户端ID
+	SequenceKey  = payload.SequenceKey  // 发布者的消息序号，从1开始递增
+)
+
+// 每个消息流最多记录的缺失序号数，超出部分直接计为丢失，之后到达时计为重复
+const maxMissingSequences = 10000
+
+// sequenceStreamKey 消息流，同一个订阅者从同一个发布者和主题收到的消息
+type sequenceStreamKey struct {
+	subscriber string
+	publisher  string
+	topic      string
+}
+
+// sequenceStream 一个消息流的序号状态
+type sequenceStream struct {
+	mutex   sync.Mutex
+	highest uint64              // 收到的最大序号
+	missing map[uint64]struct{} // 小于highest且尚未收到的序号
+}
+
+// 本次运行的序号检查状态，在每次启动时重置
+var (
+	sequenceStreams    sync.Map // sequenceStreamKey -> *sequenceStream
+	sequenceStreamNum  int64
+	sequenceLost       int64
+	sequenceDuplicates int64
+	sequenceOutOfOrder int64
+	sequenceGaps       int64
+)
+
+// GetSequenceStats 获取本次运行的消息序号检查结果
+func GetSequenceStats() metrics.SequenceStats {
+	return metrics.SequenceStats{
+		Streams:    atomic.LoadInt64(&sequenceStreamNum),
+		Lost:       atomic.LoadInt64(&sequenceLost),
+		Duplicates: atomic.LoadInt64(&sequenceDuplicates),
+		OutOfOrder: atomic.LoadInt64(&sequenceOutOfOrder),
+		Gaps:       atomic.LoadInt64(&sequenceGaps),
+	}
+}
+
+// ResetSequenceStats 重置消息序号检查状态
+func ResetSequenceStats() {
+	sequenceStreams.Clear()
+	atomic.StoreInt64(&sequenceStreamNum, 0)
+	atomic.StoreInt64(&sequenceLost, 0)
+	atomic.StoreInt64(&sequenceDuplicates, 0)
+	atomic.StoreInt64(&sequenceOutOfOrder, 0)
+	atomic.StoreInt64(&sequenceGaps, 0)
+}
+
+// recordSequence 按到达顺序检查消息中嵌入的序号，没有发布者ID或序号的消息不检查。
+// 每个消息流以收到的第一条消息为起点，之前的序号不计为丢失
+func recordSequence(data map[string]interface{}, subscriber, topic string) {
+	publisher, ok := data[PublisherKey].(string)
+	if !ok || publisher == "" {
+		return
+	}
+	seq, ok := extractSequence(data)
+	if !ok {
+		return
+	}
+
+	key := sequenceStreamKey{subscriber: subscriber, publisher: publisher, topic: topic}
+	value, ok := sequenceStreams.Load(key)
+	if !ok {
+		var loaded bool
+		value, loaded = sequenceStreams.LoadOrStore(key, &sequenceStream{highest: seq})
+		if !loaded {
+			atomic.AddInt64(&sequenceStreamNum, 1)
+			return
+		}
+	}
+
+	stream := value.(*sequenceStream)
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	switch {
+	case seq == stream.highest+1:
+		stream.highest = seq
+	case seq > stream.highest:
+		// 中间的序号尚未收到，先计为丢失，之后到达时改为乱序
+		atomic.AddInt64(&sequenceGaps, 1)
+		atomic.AddInt64(&sequenceLost, int64(seq-stream.highest-1))
+		if stream.missing == nil {
+			stream.missing = make(map[uint64]struct{})
+		}
+		for missing := stream.highest + 1; missing < seq && len(stream.missing) < maxMissingSequences; missing++ {
+			stream.missing[missing] = struct{}{}
+		}
+		stream.highest = seq
+	default:
+		if _, ok := stream.missing[seq]; ok {
+			delete(stream.missing, seq)
+			atomic.AddInt64(&sequenceLost, -1)
+			atomic.AddInt64(&sequenceOutOfOrder, 1)
+			return
+		}
+		atomic.AddInt64(&sequenceDuplicates, 1)
+	}
+}
+
+// extractSequence 从消息中解析嵌入的序号
+func extractSequence(data map[string]interface{}) (uint64, bool) {
+	switch v := data[SequenceKey].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return uint64(n), true
+	case float64:
+		if v <= 0 {
+			return 0, false
+		}
+		return uint64(v), true
+	}
+	return 0, false
+}
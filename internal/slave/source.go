@@ -0,0 +1,97 @@
+package slave
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+
+	"mqttbench/internal/broker"
+)
+
+// 各源地址的连接统计，连接数随客户端连接和断开变化，失败数在每次启动时重置
+var (
+	sourceStatsMutex sync.Mutex
+	sourceStats      = make(map[netip.Addr]*broker.SourceStats)
+)
+
+// CheckSourceIPs 检查源地址能否在本机绑定，地址需要配置在网卡上或通过本地路由允许绑定
+func CheckSourceIPs(addrs []netip.Addr) error {
+	for _, addr := range addrs {
+		conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.AddrPortFrom(addr, 0)))
+		if err != nil {
+			return fmt.Errorf("source address %s cannot be bound on this host: %v", addr, err)
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+// sourceTCPAddr 构造绑定源地址的本地TCP地址，端口由系统分配，源地址无效时返回nil
+func sourceTCPAddr(addr netip.Addr) *net.TCPAddr {
+	if !addr.IsValid() {
+		return nil
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, 0))
+}
+
+// sourceStatsOf 获取源地址的统计，不存在时创建，调用者需持有sourceStatsMutex
+func sourceStatsOf(addr netip.Addr) *broker.SourceStats {
+	stats, ok := sourceStats[addr]
+	if !ok {
+		stats = &broker.SourceStats{SourceIP: addr.String()}
+		sourceStats[addr] = stats
+	}
+	return stats
+}
+
+// countSourceConnected 记录源地址上的客户端连接或断开，未指定源地址时不记录
+func countSourceConnected(addr netip.Addr, delta int64) {
+	if !addr.IsValid() {
+		return
+	}
+	sourceStatsMutex.Lock()
+	sourceStatsOf(addr).Connected += delta
+	sourceStatsMutex.Unlock()
+}
+
+// CountSourceFailed 记录源地址上一个客户端建立连接失败，未指定源地址时不记录
+func CountSourceFailed(addr netip.Addr) {
+	if !addr.IsValid() {
+		return
+	}
+	sourceStatsMutex.Lock()
+	sourceStatsOf(addr).Failed++
+	sourceStatsMutex.Unlock()
+}
+
+// GetSourceStats 获取各源地址的连接统计，按地址排序，忽略没有连接也没有失败的地址
+func GetSourceStats() []broker.SourceStats {
+	sourceStatsMutex.Lock()
+	defer sourceStatsMutex.Unlock()
+
+	addrs := make([]netip.Addr, 0, len(sourceStats))
+	for addr, stats := range sourceStats {
+		if stats.Connected != 0 || stats.Failed != 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+
+	result := make([]broker.SourceStats, len(addrs))
+	for i, addr := range addrs {
+		result[i] = *sourceStats[addr]
+	}
+	return result
+}
+
+// ResetSourceFailures 重置各源地址的失败数，连接数随客户端断开自然归零
+func ResetSourceFailures() {
+	sourceStatsMutex.Lock()
+	defer sourceStatsMutex.Unlock()
+
+	for _, stats := range sourceStats {
+		stats.Failed = 0
+	}
+}
@@ -0,0 +1,71 @@
+package slave
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"mqttbench/internal/metrics"
+)
+
+// TLS握手统计，在每次启动时重置
+var (
+	tlsHandshakeHistogram = metrics.NewHistogram()
+	tlsHandshakeFailures  int64
+)
+
+// GetTLSHandshakeStats 获取本次运行的TLS握手耗时统计
+func GetTLSHandshakeStats() metrics.LatencyStats {
+	return tlsHandshakeHistogram.Stats()
+}
+
+// GetTLSHandshakeFailures 获取本次运行TLS握手失败的次数
+func GetTLSHandshakeFailures() int64 {
+	return atomic.LoadInt64(&tlsHandshakeFailures)
+}
+
+// ResetTLSHandshakeStats 重置TLS握手统计
+func ResetTLSHandshakeStats() {
+	tlsHandshakeHistogram.Reset()
+	atomic.StoreInt64(&tlsHandshakeFailures, 0)
+}
+
+// tlsHandshakeError TCP连接已建立，但TLS握手失败
+type tlsHandshakeError struct {
+	err error
+}
+
+func (e *tlsHandshakeError) Error() string {
+	return "TLS握手失败: " + e.err.Error()
+}
+
+func (e *tlsHandshakeError) Unwrap() error {
+	return e.err
+}
+
+// dialTLS 建立TCP连接并完成TLS握手，握手耗时单独统计，不包含TCP建连时间。timeout为0时不限制时间
+func (e *brokerEndpoint) dialTLS(ctx context.Context, address string, timeout time.Duration) (net.Conn, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	conn, err := e.dialTCP(ctx, address, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, e.tlsConfig)
+	handshakeStart := time.Now()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		atomic.AddInt64(&tlsHandshakeFailures, 1)
+		return nil, &tlsHandshakeError{err: err}
+	}
+	tlsHandshakeHistogram.Record(time.Since(handshakeStart))
+
+	return tlsConn, nil
+}
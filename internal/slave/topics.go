@@ -0,0 +1,35 @@
+package slave
+
+import "mqttbench/internal/topic"
+
+// topics 返回配置中的主题模板
+func (c *ConfigData) topics() *topic.Templates {
+	return &topic.Templates{
+		Topic:         c.Topic,
+		QoS:           c.QoS,
+		PubTopic:      c.PubTopic,
+		Subscriptions: c.Subscriptions,
+		Will:          c.Will,
+		GroupSize:     c.TopicGroupSize,
+	}
+}
+
+// ValidateTopics 校验订阅、发布和遗嘱主题模板
+func (c *ConfigData) ValidateTopics() error {
+	return c.topics().Validate()
+}
+
+// SubscriptionsFor 返回客户端展开后的订阅列表，未设置订阅列表时订阅Topic
+func (c *ConfigData) SubscriptionsFor(vars topic.Vars) []topic.Subscription {
+	return c.topics().SubscriptionsFor(vars)
+}
+
+// WillFor 返回客户端展开主题后的遗嘱消息，未设置时返回nil
+func (c *ConfigData) WillFor(vars topic.Vars) *topic.WillConfig {
+	return c.topics().WillFor(vars)
+}
+
+// ExpandTopic 将主题模板中的占位符替换为客户端的信息
+func (c *ConfigData) ExpandTopic(template string, vars topic.Vars) string {
+	return c.topics().Expand(template, vars)
+}
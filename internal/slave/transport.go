@@ -0,0 +1,225 @@
+package slave
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"mqttbench/internal/broker"
+)
+
+// defaultWebSocketPath 未配置WebSocket路径时使用的路径
+const defaultWebSocketPath = "/mqtt"
+
+// ValidateTransport 校验传输方式，明文传输不能与TLS配置同时使用
+func ValidateTransport(config ConfigData) error {
+	return broker.ValidateTransport(config.Transport, config.TLS, config.WebSocket)
+}
+
+// mqttsPort MQTT over TLS的常用端口，旧版本连接该端口时自动使用TLS
+const mqttsPort = 8883
+
+// PlaintextTLSPorts 返回使用明文TCP连接MQTT over TLS常用端口的broker节点。
+// 旧版本按端口号自动启用TLS，数据库中的旧记录升级时已改为ssl，其余来源的配置只能给出提示
+func PlaintextTLSPorts(config ConfigData) []broker.Node {
+	if config.Transport != "" && config.Transport != broker.TransportTCP {
+		return nil
+	}
+	if config.TLS != nil && config.TLS.Enabled {
+		return nil
+	}
+
+	var nodes []broker.Node
+	for _, node := range config.BrokerNodes() {
+		if node.Port == mqttsPort {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// brokerEndpoint 连接broker使用的地址、TLS配置和WebSocket请求头
+type brokerEndpoint struct {
+	url       *url.URL
+	tlsConfig *tls.Config // 为nil时不使用TLS
+	headers   http.Header
+	localAddr *net.TCPAddr // 绑定的本地源地址，为nil时由系统选择
+
+	onTCPConnect func(time.Duration) // TCP连接建立后回调建连耗时，为nil时不回调
+	onConnection func(*chaosConn)    // 连接建立后回调可注入故障的连接，为nil时不包装连接
+}
+
+// newBrokerEndpoint 根据配置构造broker节点的地址。未指定传输方式时按是否启用TLS选择tcp或ssl，
+// ssl和wss未启用TLS配置时使用系统根证书校验服务器证书
+func newBrokerEndpoint(config ConfigData, node broker.Node) (*brokerEndpoint, error) {
+	if err := ValidateTransport(config); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.TLS.ClientConfig(config.MqttHost)
+	if err != nil {
+		return nil, fmt.Errorf("TLS配置无效: %v", err)
+	}
+	// 未指定SNI时每个节点使用自己的主机名
+	if tlsConfig != nil && config.TLS.ServerName == "" && tlsConfig.ServerName != node.Host {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = node.Host
+	}
+
+	transport := config.Transport
+	if transport == "" {
+		transport = broker.TransportTCP
+		if tlsConfig != nil {
+			transport = broker.TransportSSL
+		}
+	}
+	if tlsConfig == nil && (transport == broker.TransportSSL || transport == broker.TransportWSS) {
+		tlsConfig = &tls.Config{ServerName: node.Host}
+	}
+
+	endpoint := &brokerEndpoint{
+		url:       &url.URL{Scheme: transport, Host: node.Address()},
+		tlsConfig: tlsConfig,
+	}
+
+	if transport == broker.TransportWS || transport == broker.TransportWSS {
+		endpoint.url.Path = defaultWebSocketPath
+		endpoint.headers = http.Header{}
+		if config.WebSocket != nil {
+			if config.WebSocket.Path != "" {
+				endpoint.url.Path = "/" + strings.TrimPrefix(config.WebSocket.Path, "/")
+			}
+			for key, value := range config.WebSocket.Headers {
+				endpoint.headers.Set(key, value)
+			}
+		}
+	}
+
+	return endpoint, nil
+}
+
+// dial 建立到broker的网络连接，TCP建连和TLS握手耗时单独统计。timeout为0时不限制时间
+func (e *brokerEndpoint) dial(ctx context.Context, timeout time.Duration) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	switch e.url.Scheme {
+	case broker.TransportSSL:
+		conn, err = e.dialTLS(ctx, e.url.Host, timeout)
+	case broker.TransportWS, broker.TransportWSS:
+		conn, err = e.dialWebSocket(ctx, timeout)
+	default:
+		conn, err = e.dialTCP(ctx, e.url.Host, timeout)
+	}
+	if err != nil || e.onConnection == nil {
+		return conn, err
+	}
+
+	wrapped := newChaosConn(conn)
+	e.onConnection(wrapped)
+	return wrapped, nil
+}
+
+// dialTCP 建立TCP连接，连接成功后回调建连耗时。timeout为0时不限制时间
+func (e *brokerEndpoint) dialTCP(ctx context.Context, address string, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if e.localAddr != nil {
+		dialer.LocalAddr = e.localAddr
+	}
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if e.onTCPConnect != nil {
+		e.onTCPConnect(time.Since(start))
+	}
+	return conn, nil
+}
+
+// dialWebSocket 建立WebSocket连接，wss的TLS握手由dialTLS完成
+func (e *brokerEndpoint) dialWebSocket(ctx context.Context, timeout time.Duration) (net.Conn, error) {
+	dialer := &websocket.Dialer{
+		Subprotocols:     []string{"mqtt"},
+		HandshakeTimeout: timeout,
+	}
+	if e.tlsConfig != nil {
+		dialer.NetDialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return e.dialTLS(ctx, addr, 0)
+		}
+	} else {
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return e.dialTCP(ctx, addr, 0)
+		}
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, e.url.String(), e.headers)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("WebSocket握手失败: %w (HTTP %d)", err, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("WebSocket握手失败: %w", err)
+	}
+	return &wsConn{Conn: conn}, nil
+}
+
+// wsConn 将WebSocket连接包装为net.Conn，MQTT报文以二进制消息传输，一个报文可以跨多个消息
+type wsConn struct {
+	*websocket.Conn
+	reader     io.Reader // 当前正在读取的消息
+	writeMutex sync.Mutex
+}
+
+// Read 读取二进制消息内容，当前消息读完后继续读取下一个消息
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			messageType, reader, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Write 将数据作为一个二进制消息发送
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if err := c.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetDeadline 同时设置读写超时
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
@@ -0,0 +1,361 @@
+package testplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"mqttbench/internal/ack"
+	"mqttbench/internal/broker"
+	"mqttbench/internal/credentials"
+	"mqttbench/internal/master"
+	"mqttbench/internal/models"
+	"mqttbench/internal/payload"
+	"mqttbench/internal/ramp"
+	"mqttbench/internal/topic"
+)
+
+// Config 应用到参与测试的slave的MQTT配置，多阶段计划和命令行计划共用。
+// 证书、凭据和消息样本从文件读取，相对路径相对于计划文件所在目录
+type Config struct {
+	MqttHost string `json:"mqtt_host"`
+	MqttPort int    `json:"mqtt_port"`
+	Topic    string `json:"topic"`
+	QoS      int    `json:"qos"`
+	AckTopic string `json:"ack_topic"` // ACK主题模板
+	PubTopic string `json:"pub_topic"` // 发布主题，为空时使用Topic
+
+	// 每个客户端的订阅列表，为空时订阅Topic；主题中可以使用{{client_id}}等占位符
+	Subscriptions  []models.Subscription `json:"subscriptions,omitempty"`
+	TopicGroupSize int                   `json:"topic_group_size"` // {{group}}占位符的分组大小
+
+	// 遗嘱消息，未设置时不设置遗嘱消息；主题中可以使用{{client_id}}等占位符
+	Will *topic.WillConfig `json:"will,omitempty"`
+
+	// broker集群的节点列表和客户端分配方式，未设置节点列表时连接mqtt_host:mqtt_port
+	Brokers      []models.BrokerNode `json:"brokers,omitempty"`
+	BrokerPolicy string              `json:"broker_policy"` // round_robin/random/weighted/hash，为空时为round_robin
+
+	// 客户端绑定的本地源地址，每项为IP或CIDR，应用到所有参与测试的slave，需在每台slave上都能绑定
+	SourceIPs []string `json:"source_ips,omitempty"`
+
+	ProtocolVersion int                 `json:"protocol_version"` // MQTT协议版本：3/4/5，为0时使用3.1.1
+	MQTT5           *broker.MQTT5Config `json:"mqtt5,omitempty"`  // MQTT 5.0连接参数
+
+	// TLS配置，未设置时使用明文TCP连接
+	TLS *TLS `json:"tls,omitempty"`
+	tls *broker.TLSConfig
+
+	// 传输方式：tcp/ssl/ws/wss，为空时按是否设置TLS选择tcp或ssl
+	Transport string                  `json:"transport"`
+	WebSocket *broker.WebSocketConfig `json:"websocket,omitempty"` // WebSocket路径和请求头
+
+	// ACK回复方式，未设置时按EEW协议回复
+	Ack *ack.Config `json:"ack,omitempty"`
+
+	// 认证方式，未设置时用户名和密码均为客户端ID
+	Credentials *Credentials `json:"credentials,omitempty"`
+
+	// 建连策略，未设置时同时建立所有连接；多阶段计划中由ramp_up和reconnect_storm阶段的rate决定
+	Ramp *ramp.Config `json:"ramp,omitempty"`
+
+	// 消息生成方式，未设置时为嵌入发送时间和序号的JSON消息
+	Payload *Payload `json:"payload,omitempty"`
+}
+
+// TLS 计划中的TLS配置，证书和私钥从PEM文件读取
+type TLS struct {
+	CAFile             string `json:"ca_file"`   // CA证书，为空时使用系统根证书
+	CertFile           string `json:"cert_file"` // 客户端证书，与KeyFile同时设置时启用双向认证
+	KeyFile            string `json:"key_file"`  // 客户端私钥
+	ServerName         string `json:"server_name"`
+	MinVersion         string `json:"min_version"` // 1.0/1.1/1.2/1.3，为空时为1.2
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// Credentials 计划中的认证方式，凭据文件从file_path读取
+type Credentials struct {
+	credentials.Config
+	FilePath string `json:"file_path"` // file：凭据文件，未设置file_format时按扩展名判断格式
+}
+
+// Payload 计划中的消息生成方式，样本从sample_files读取
+type Payload struct {
+	payload.Config
+	SampleFiles []string `json:"sample_files"` // file：样本文件，每个文件的内容为一条消息
+}
+
+// Decode 解析YAML或JSON格式的计划，字段名与JSON标签一致，不允许未知字段
+func Decode(data []byte, v interface{}) error {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	if document == nil {
+		return fmt.Errorf("plan is empty")
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// HasPhases 判断YAML或JSON格式的内容是否为包含阶段列表的多阶段计划，内容无法解析时返回false
+func HasPhases(data []byte) bool {
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return false
+	}
+	_, ok := document["phases"]
+	return ok
+}
+
+// Load 校验配置并读取证书、凭据和样本文件，dir为计划文件所在目录
+func (c *Config) Load(dir string) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	var err error
+	if c.TLS != nil {
+		if c.tls, err = c.TLS.load(dir); err != nil {
+			return err
+		}
+	}
+	if c.Credentials != nil {
+		if err := c.Credentials.load(dir); err != nil {
+			return err
+		}
+	}
+	if c.Payload != nil {
+		if err := c.Payload.load(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate 校验MQTT配置
+func (c *Config) validate() error {
+	switch {
+	case c.MqttHost == "" && len(c.Brokers) == 0:
+		return fmt.Errorf("mqtt_host or brokers is required")
+	case len(c.Brokers) == 0 && (c.MqttPort <= 0 || c.MqttPort > 65535):
+		return fmt.Errorf("invalid mqtt_port: %d", c.MqttPort)
+	case c.Topic == "" && c.PubTopic == "" && len(c.Subscriptions) == 0:
+		return fmt.Errorf("topic, pub_topic or subscriptions is required")
+	case c.QoS < 0 || c.QoS > 2:
+		return fmt.Errorf("invalid qos: %d", c.QoS)
+	}
+
+	if err := c.Ramp.Validate(); err != nil {
+		return err
+	}
+	if err := c.Ack.Validate(c.AckTopic); err != nil {
+		return err
+	}
+	topics := &models.Slave{Topic: c.Topic, PubTopic: c.PubTopic, Subscriptions: c.Subscriptions, TopicGroupSize: c.TopicGroupSize}
+	if c.Will != nil {
+		if c.Will.Topic == "" {
+			return fmt.Errorf("will topic is empty")
+		}
+		topics.WillTopic, topics.WillQoS = c.Will.Topic, c.Will.QoS
+	}
+	if err := master.ValidateTopics(topics); err != nil {
+		return err
+	}
+	if err := master.ValidateBrokers(&models.Slave{Brokers: c.Brokers, BrokerPolicy: c.BrokerPolicy}); err != nil {
+		return err
+	}
+	if err := broker.ValidateSourceIPs(c.SourceIPs); err != nil {
+		return err
+	}
+	if err := broker.ValidateProtocolVersion(c.ProtocolVersion); err != nil {
+		return err
+	}
+	if err := c.MQTT5.Validate(); err != nil {
+		return err
+	}
+	// 证书在校验通过后才读取，这里只需要知道是否启用TLS
+	return broker.ValidateTransport(c.Transport, &broker.TLSConfig{Enabled: c.TLS != nil}, c.WebSocket)
+}
+
+// load 读取证书文件并构造下发给slave的TLS配置
+func (t *TLS) load(dir string) (*broker.TLSConfig, error) {
+	readPEM := func(name string) (string, error) {
+		if name == "" {
+			return "", nil
+		}
+		data, err := os.ReadFile(resolve(dir, name))
+		if err != nil {
+			return "", fmt.Errorf("failed to read TLS file: %v", err)
+		}
+		return string(data), nil
+	}
+
+	config := &broker.TLSConfig{
+		Enabled:            true,
+		ServerName:         t.ServerName,
+		MinVersion:         t.MinVersion,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	var err error
+	if config.CACert, err = readPEM(t.CAFile); err != nil {
+		return nil, err
+	}
+	if config.ClientCert, err = readPEM(t.CertFile); err != nil {
+		return nil, err
+	}
+	if config.ClientKey, err = readPEM(t.KeyFile); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// load 读取凭据文件并校验认证方式
+func (c *Credentials) load(dir string) error {
+	if c.FilePath != "" {
+		name := resolve(dir, c.FilePath)
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read credential file: %v", err)
+		}
+		c.File = string(data)
+		if c.FileFormat == "" && strings.EqualFold(filepath.Ext(name), ".json") {
+			c.FileFormat = credentials.FileJSON
+		}
+	}
+	return c.Validate()
+}
+
+// load 读取样本文件并校验消息生成方式
+func (p *Payload) load(dir string) error {
+	for _, name := range p.SampleFiles {
+		data, err := os.ReadFile(resolve(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read payload sample: %v", err)
+		}
+		p.Samples = append(p.Samples, string(data))
+	}
+	return p.Validate()
+}
+
+// resolve 返回相对于dir的文件路径
+func resolve(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// Apply 将MQTT配置应用到slave记录，未设置的可选项清除slave原有的设置
+func (c *Config) Apply(slave *models.Slave) {
+	slave.MqttHost = c.MqttHost
+	slave.MqttPort = c.MqttPort
+	slave.Topic = c.Topic
+	slave.QoS = c.QoS
+	slave.AckTopic = c.AckTopic
+	slave.PubTopic = c.PubTopic
+	slave.Subscriptions = c.Subscriptions
+	slave.TopicGroupSize = c.TopicGroupSize
+	slave.Brokers = c.Brokers
+	slave.BrokerPolicy = c.BrokerPolicy
+	slave.SourceIPs = c.SourceIPs
+
+	will := topic.WillConfig{}
+	if c.Will != nil {
+		will = *c.Will
+	}
+	slave.WillTopic = will.Topic
+	slave.WillPayload = will.Payload
+	slave.WillQoS = will.QoS
+	slave.WillRetain = will.Retain
+
+	ackConfig := c.Ack
+	if ackConfig == nil {
+		ackConfig = &ack.Config{}
+	}
+	slave.AckMode = ackConfig.Mode
+	slave.AckFields = ackConfig.Fields
+	slave.AckQoS = ackConfig.QoS
+	slave.AckDelay = ackConfig.Delay
+
+	rampConfig := ramp.Config{}
+	if c.Ramp != nil {
+		rampConfig = *c.Ramp
+	}
+	slave.RampStrategy = rampConfig.Strategy
+	slave.RampRate = rampConfig.Rate
+	slave.RampDuration = rampConfig.Duration
+	slave.RampBatchSize = rampConfig.BatchSize
+	slave.RampBatchPause = rampConfig.BatchPause
+
+	mqtt5 := broker.MQTT5Config{}
+	if c.MQTT5 != nil {
+		mqtt5 = *c.MQTT5
+	}
+	slave.ProtocolVersion = c.ProtocolVersion
+	slave.SessionExpiry = int64(mqtt5.SessionExpiry)
+	slave.ReceiveMaximum = int(mqtt5.ReceiveMaximum)
+	slave.TopicAliasMaximum = int(mqtt5.TopicAliasMaximum)
+	slave.TopicAlias = mqtt5.TopicAlias
+	slave.UserProperties = mqtt5.UserProperties
+
+	tls := c.tls
+	if tls == nil {
+		tls = &broker.TLSConfig{}
+	}
+	slave.TLSEnabled = tls.Enabled
+	slave.TLSCACert = tls.CACert
+	slave.TLSClientCert = tls.ClientCert
+	slave.TLSClientKey = tls.ClientKey
+	slave.TLSServerName = tls.ServerName
+	slave.TLSMinVersion = tls.MinVersion
+	slave.TLSInsecureSkipVerify = tls.InsecureSkipVerify
+
+	webSocket := broker.WebSocketConfig{}
+	if c.WebSocket != nil {
+		webSocket = *c.WebSocket
+	}
+	slave.Transport = c.Transport
+	slave.WSPath = webSocket.Path
+	slave.WSHeaders = webSocket.Headers
+
+	credentialConfig := &credentials.Config{}
+	if c.Credentials != nil {
+		credentialConfig = &c.Credentials.Config
+	}
+	slave.CredentialMode = credentialConfig.Mode
+	slave.CredentialUsername = credentialConfig.Username
+	slave.CredentialPassword = credentialConfig.Password
+	slave.CredentialFile = credentialConfig.File
+	slave.CredentialFileFormat = credentialConfig.FileFormat
+	slave.TokenSecret = credentialConfig.TokenSecret
+	slave.TokenAlgorithm = credentialConfig.TokenAlgorithm
+	slave.TokenTTL = credentialConfig.TokenTTL
+	slave.TokenIssuer = credentialConfig.TokenIssuer
+	slave.TokenAudience = credentialConfig.TokenAudience
+
+	payloadConfig := payload.Config{}
+	if c.Payload != nil {
+		payloadConfig = c.Payload.Config
+	}
+	slave.PayloadType = payloadConfig.Type
+	slave.PayloadContent = payloadConfig.Content
+	slave.PayloadTemplate = payloadConfig.Template
+	slave.PayloadSamples = payloadConfig.Samples
+}
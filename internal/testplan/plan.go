@@ -0,0 +1,156 @@
+package testplan
+
+import (
+	"fmt"
+	"slices"
+
+	"mqttbench/internal/models"
+)
+
+// 阶段类型
+const (
+	PhaseRampUp         = "ramp_up"         // 按rate（连接/秒）建立连接，rate为0时同时建立所有连接
+	PhaseSteady         = "steady"          // 保持连接，按rate（消息/秒）持续发布，rate为0时只订阅不发布
+	PhaseBurst          = "burst"           // 按rate（消息/秒）突发发布，阶段结束后恢复之前的发布速率
+	PhaseReconnectStorm = "reconnect_storm" // 断开所有连接后按rate（连接/秒）重新连接，rate为0时同时重连
+	PhaseTeardown       = "teardown"        // 断开所有连接
+)
+
+// Plan 多阶段测试计划，YAML和JSON格式使用相同的字段名
+type Plan struct {
+	Name string `json:"name"`
+
+	// 运行前应用到所有参与slave的MQTT配置，未设置时使用slave自身的配置。
+	// 计划保存在数据库中，配置中文件的相对路径相对于master的工作目录
+	Config *Config `json:"config,omitempty"`
+
+	PayloadSize int   `json:"payload_size"` // 发布消息的大小，为0时使用slave自身的配置
+	PubQoS      *int  `json:"pub_qos"`
+	Subscribe   *bool `json:"subscribe"` // 客户端是否订阅主题，默认为true
+
+	// 客户端拆分，Total为0时使用slave已有的ClientID/Start/Step
+	Clients Clients `json:"clients"`
+
+	Phases []Phase `json:"phases"`
+}
+
+// Clients 运行计划前将客户端ID拆分到参与的slave
+type Clients struct {
+	Total    int    `json:"total"`
+	Prefix   string `json:"prefix"`
+	Weighted bool   `json:"weighted"` // 按slave的Capacity加权拆分
+}
+
+// Phase 计划中的一个阶段
+type Phase struct {
+	Name     string   `json:"name"`     // 为空时使用Type
+	Type     string   `json:"type"`     // 阶段类型
+	Duration int      `json:"duration"` // 阶段时长（秒），执行阶段动作后保持的时间
+	Rate     float64  `json:"rate"`     // ramp_up/reconnect_storm为所选slave合计的连接/秒，steady/burst为合计的消息/秒
+	Slaves   Selector `json:"slaves"`   // 阶段作用的slave，为空时作用于所有参与的slave
+}
+
+// Selector 按ID或名称选择slave，同时设置时满足任一条件即被选中
+type Selector struct {
+	IDs   []int64  `json:"ids"`
+	Names []string `json:"names"`
+}
+
+// Parse 解析并校验YAML或JSON格式的测试计划
+func Parse(data []byte) (*Plan, error) {
+	plan := &Plan{}
+	if err := Decode(data, plan); err != nil {
+		return nil, fmt.Errorf("failed to parse test plan: %v", err)
+	}
+
+	for i := range plan.Phases {
+		if plan.Phases[i].Name == "" {
+			plan.Phases[i].Name = plan.Phases[i].Type
+		}
+	}
+
+	if err := plan.validate(); err != nil {
+		return nil, err
+	}
+	if plan.Config != nil {
+		if err := plan.Config.Load(""); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// validate 校验测试计划
+func (p *Plan) validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("name is required")
+	case p.PubQoS != nil && (*p.PubQoS < 0 || *p.PubQoS > 2):
+		return fmt.Errorf("invalid pub_qos: %d", *p.PubQoS)
+	case p.PayloadSize < 0:
+		return fmt.Errorf("invalid payload_size: %d", p.PayloadSize)
+	case p.Clients.Total < 0:
+		return fmt.Errorf("invalid clients.total: %d", p.Clients.Total)
+	case p.Clients.Total > 0 && p.Clients.Prefix == "":
+		return fmt.Errorf("clients.prefix is required when clients.total is set")
+	case len(p.Phases) == 0:
+		return fmt.Errorf("at least one phase is required")
+	}
+
+	connected := false
+	for i, phase := range p.Phases {
+		if err := phase.validate(); err != nil {
+			return fmt.Errorf("phase %d (%s): %v", i+1, phase.Name, err)
+		}
+
+		// 发布和重连之前必须先建立连接
+		switch phase.Type {
+		case PhaseRampUp:
+			connected = true
+		case PhaseSteady, PhaseBurst, PhaseReconnectStorm:
+			if !connected {
+				return fmt.Errorf("phase %d (%s): %s requires a preceding %s phase", i+1, phase.Name, phase.Type, PhaseRampUp)
+			}
+		}
+	}
+	return nil
+}
+
+// validate 校验阶段
+func (p Phase) validate() error {
+	switch p.Type {
+	case PhaseRampUp, PhaseSteady, PhaseBurst, PhaseReconnectStorm:
+		if p.Duration <= 0 {
+			return fmt.Errorf("invalid duration: %d", p.Duration)
+		}
+	case PhaseTeardown:
+		if p.Duration < 0 {
+			return fmt.Errorf("invalid duration: %d", p.Duration)
+		}
+	case "":
+		return fmt.Errorf("type is required")
+	default:
+		return fmt.Errorf("unknown type: %s", p.Type)
+	}
+
+	if p.Rate < 0 {
+		return fmt.Errorf("invalid rate: %v", p.Rate)
+	}
+	if p.Type == PhaseBurst && p.Rate == 0 {
+		return fmt.Errorf("burst requires a rate")
+	}
+	return nil
+}
+
+// Empty 判断选择器是否未设置任何条件
+func (s Selector) Empty() bool {
+	return len(s.IDs) == 0 && len(s.Names) == 0
+}
+
+// Matches 判断slave是否被选中，未设置条件时选中所有slave
+func (s Selector) Matches(slave *models.Slave) bool {
+	if s.Empty() {
+		return true
+	}
+	return slices.Contains(s.IDs, slave.ID) || slices.Contains(s.Names, slave.Name)
+}
@@ -0,0 +1,413 @@
+package testplan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mqttbench/internal/db"
+	"mqttbench/internal/master"
+	"mqttbench/internal/models"
+	"mqttbench/internal/ramp"
+	"mqttbench/internal/workload"
+)
+
+// runner 一次计划运行的状态
+type runner struct {
+	service *Service
+	plan    *Plan
+	record  *models.TestPlan
+	slaves  []*models.Slave // 参与运行的slave，按ID排序
+
+	// 各slave的运行状态，阶段内并发下发命令时需要加锁
+	started  map[int64]bool    // 已建立连接的slave
+	pubRates map[int64]float64 // 每个slave当前每个客户端每秒发布的消息数
+	mutex    sync.Mutex
+}
+
+// run 依次执行计划的各个阶段，结束后断开所有slave的连接
+func (r *runner) run(ctx context.Context, slaveIDs []int64) {
+	defer r.service.finish(r.record.ID)
+
+	log.Printf("Test plan %d (%s) started: %d phases, slaves=%v", r.record.ID, r.plan.Name, len(r.plan.Phases), slaveIDs)
+
+	phases, err := r.prepare(slaveIDs)
+	if err != nil {
+		log.Printf("Test plan %d failed to start: %v", r.record.ID, err)
+		r.record.Status = models.TestPlanStatusFailed
+		r.record.ErrorMessage = err.Error()
+		r.record.EndTime = time.Now()
+		r.save()
+		return
+	}
+
+	status := models.TestPlanStatusCompleted
+	for i, phase := range r.plan.Phases {
+		record := phases[i]
+		if status != models.TestPlanStatusCompleted {
+			record.Status = models.TestPlanStatusSkipped
+			r.savePhase(record)
+			continue
+		}
+
+		r.record.CurrentPhase = i
+		r.save()
+
+		record.Status = models.TestPlanStatusRunning
+		record.StartTime = time.Now()
+		r.savePhase(record)
+		log.Printf("Test plan %d phase %d (%s) started: type=%s, duration=%ds, rate=%v",
+			r.record.ID, i+1, phase.Name, phase.Type, phase.Duration, phase.Rate)
+
+		err := r.runPhase(ctx, phase, record)
+		record.EndTime = time.Now()
+		switch {
+		case errors.Is(err, context.Canceled):
+			record.Status = models.TestPlanStatusStopped
+			status = models.TestPlanStatusStopped
+		case err != nil:
+			record.Status = models.TestPlanStatusFailed
+			record.ErrorMessage = err.Error()
+			status = models.TestPlanStatusFailed
+			r.record.ErrorMessage = fmt.Sprintf("phase %d (%s): %v", i+1, phase.Name, err)
+		default:
+			record.Status = models.TestPlanStatusCompleted
+		}
+		r.savePhase(record)
+		log.Printf("Test plan %d phase %d (%s) %s", r.record.ID, i+1, phase.Name, record.Status)
+	}
+
+	// 断开仍在运行的slave
+	for _, slave := range r.slaves {
+		if r.started[slave.ID] {
+			if err := r.service.masterServer.StopSlave(slave.ID); err != nil {
+				log.Printf("Test plan %d failed to stop slave %d: %v", r.record.ID, slave.ID, err)
+			}
+		}
+	}
+
+	r.record.Status = status
+	r.record.CurrentPhase = -1
+	r.record.EndTime = time.Now()
+	r.save()
+	log.Printf("Test plan %d (%s) %s", r.record.ID, r.plan.Name, status)
+}
+
+// prepare 应用计划的MQTT配置并拆分客户端，确定参与运行的slave，重新创建阶段记录
+func (r *runner) prepare(slaveIDs []int64) ([]*models.TestPlanPhase, error) {
+	if r.plan.Config != nil {
+		for _, slaveID := range slaveIDs {
+			if err := r.applyConfig(slaveID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var slaves []*models.Slave
+	if r.plan.Clients.Total > 0 {
+		partitioned, err := r.service.masterServer.PartitionClients(slaveIDs, r.plan.Clients.Total, r.plan.Clients.Prefix, r.plan.Clients.Weighted)
+		if err != nil {
+			return nil, err
+		}
+		slaves = partitioned
+	} else {
+		for _, slaveID := range slaveIDs {
+			slave, err := r.service.masterServer.GetSlaveModel().GetByID(slaveID)
+			if err != nil {
+				return nil, fmt.Errorf("error getting slave %d: %v", slaveID, err)
+			}
+			if slave == nil {
+				return nil, fmt.Errorf("slave %d not found", slaveID)
+			}
+			if slave.Status == "offline" {
+				log.Printf("Slave %d is offline, skipped from test plan %d", slaveID, r.record.ID)
+				continue
+			}
+			slaves = append(slaves, slave)
+		}
+	}
+
+	// 没有分配到客户端的slave不参与运行
+	for _, slave := range slaves {
+		if slave.Step > 0 {
+			r.slaves = append(r.slaves, slave)
+		}
+	}
+	if len(r.slaves) == 0 {
+		return nil, fmt.Errorf("no online slaves with clients selected")
+	}
+	sort.Slice(r.slaves, func(i, j int) bool { return r.slaves[i].ID < r.slaves[j].ID })
+
+	if err := r.service.phaseGorm.DeleteByPlanID(db.DB, r.record.ID); err != nil {
+		return nil, err
+	}
+	phases := make([]*models.TestPlanPhase, 0, len(r.plan.Phases))
+	for i, phase := range r.plan.Phases {
+		record := &models.TestPlanPhase{
+			PlanID:   r.record.ID,
+			Index:    i,
+			Name:     phase.Name,
+			Type:     phase.Type,
+			Duration: phase.Duration,
+			Rate:     phase.Rate,
+			Status:   models.TestPlanStatusPending,
+		}
+		if err := r.service.phaseGorm.Insert(db.DB, record); err != nil {
+			return nil, err
+		}
+		phases = append(phases, record)
+	}
+	return phases, nil
+}
+
+// applyConfig 将计划的MQTT配置保存到slave记录
+func (r *runner) applyConfig(slaveID int64) error {
+	slave, err := r.service.masterServer.GetSlaveModel().GetByID(slaveID)
+	if err != nil {
+		return fmt.Errorf("error getting slave %d: %v", slaveID, err)
+	}
+	if slave == nil {
+		return fmt.Errorf("slave %d not found", slaveID)
+	}
+
+	r.plan.Config.Apply(slave)
+	if err := r.service.masterServer.GetSlaveModel().UpdateWithoutConnections(slave); err != nil {
+		return fmt.Errorf("failed to save slave %d: %v", slaveID, err)
+	}
+	return nil
+}
+
+// runPhase 向阶段选中的slave下发命令，然后保持阶段时长。被停止时返回context.Canceled
+func (r *runner) runPhase(ctx context.Context, phase Phase, record *models.TestPlanPhase) error {
+	selected, err := r.selectSlaves(phase.Slaves)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(selected))
+	for _, slave := range selected {
+		ids = append(ids, strconv.FormatInt(slave.ID, 10))
+	}
+	record.SlaveIDs = strings.Join(ids, ",")
+	r.savePhase(record)
+
+	switch phase.Type {
+	case PhaseRampUp:
+		err = r.connect(selected, phase.Rate)
+	case PhaseReconnectStorm:
+		if err = r.requireStarted(selected); err == nil {
+			err = r.connect(selected, phase.Rate)
+		}
+	case PhaseSteady:
+		if err = r.requireStarted(selected); err == nil {
+			err = r.publish(selected, phase.Rate)
+		}
+	case PhaseBurst:
+		if err = r.requireStarted(selected); err != nil {
+			return err
+		}
+		previous := r.currentPubRates(selected)
+		if err := r.publish(selected, phase.Rate); err != nil {
+			return err
+		}
+		if err := wait(ctx, phase.Duration); err != nil {
+			return err
+		}
+		// 突发结束后恢复之前的发布速率
+		return r.setPubRates(selected, previous)
+	case PhaseTeardown:
+		err = r.teardown(selected)
+	}
+	if err != nil {
+		return err
+	}
+
+	return wait(ctx, phase.Duration)
+}
+
+// selectSlaves 返回阶段选择器选中的slave
+func (r *runner) selectSlaves(selector Selector) ([]*models.Slave, error) {
+	var selected []*models.Slave
+	for _, slave := range r.slaves {
+		if selector.Matches(slave) {
+			selected = append(selected, slave)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no slaves match the selector")
+	}
+	return selected, nil
+}
+
+// requireStarted 检查slave都已建立连接
+func (r *runner) requireStarted(slaves []*models.Slave) error {
+	for _, slave := range slaves {
+		if !r.started[slave.ID] {
+			return fmt.Errorf("slave %d is not connected", slave.ID)
+		}
+	}
+	return nil
+}
+
+// connect 向slave发送启动命令，rate按各slave的客户端数分配，slave会先断开已有的连接
+func (r *runner) connect(slaves []*models.Slave, rate float64) error {
+	total := totalClients(slaves)
+	return forEach(slaves, func(slave *models.Slave) error {
+		r.mutex.Lock()
+		configData := r.plan.configData(slave, r.pubRates[slave.ID])
+		r.mutex.Unlock()
+		// 阶段的rate决定建连速率，不使用slave自身的建连策略
+		configData.Ramp = nil
+		if rate > 0 {
+			configData.Ramp = &ramp.Config{
+				Strategy: ramp.Rate,
+				Rate:     rate * float64(slave.Step) / float64(total),
+			}
+		}
+
+		if err := r.service.masterServer.StartSlaveWithConfig(slave, configData); err != nil {
+			return err
+		}
+
+		r.mutex.Lock()
+		r.started[slave.ID] = true
+		r.mutex.Unlock()
+		return nil
+	})
+}
+
+// publish 将合计的发布速率平均分配到slave的所有客户端
+func (r *runner) publish(slaves []*models.Slave, rate float64) error {
+	perClientRate := rate / float64(totalClients(slaves))
+
+	rates := make(map[int64]float64, len(slaves))
+	for _, slave := range slaves {
+		rates[slave.ID] = perClientRate
+	}
+	return r.setPubRates(slaves, rates)
+}
+
+// setPubRates 将每个slave的发布速率设置为rates中的每个客户端速率
+func (r *runner) setPubRates(slaves []*models.Slave, rates map[int64]float64) error {
+	return forEach(slaves, func(slave *models.Slave) error {
+		configData := r.plan.configData(slave, rates[slave.ID])
+		if err := r.service.masterServer.SetPublishRate(slave, configData); err != nil {
+			return err
+		}
+
+		r.mutex.Lock()
+		r.pubRates[slave.ID] = rates[slave.ID]
+		r.mutex.Unlock()
+		return nil
+	})
+}
+
+// currentPubRates 返回slave当前的每个客户端发布速率
+func (r *runner) currentPubRates(slaves []*models.Slave) map[int64]float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rates := make(map[int64]float64, len(slaves))
+	for _, slave := range slaves {
+		rates[slave.ID] = r.pubRates[slave.ID]
+	}
+	return rates
+}
+
+// teardown 向slave发送停止命令，断开所有连接
+func (r *runner) teardown(slaves []*models.Slave) error {
+	return forEach(slaves, func(slave *models.Slave) error {
+		err := r.service.masterServer.StopSlave(slave.ID)
+
+		// 无论是否成功都不再视为已连接
+		r.mutex.Lock()
+		delete(r.started, slave.ID)
+		delete(r.pubRates, slave.ID)
+		r.mutex.Unlock()
+		return err
+	})
+}
+
+// save 保存计划记录
+func (r *runner) save() {
+	if err := r.service.planGorm.Update(db.DB, r.record); err != nil {
+		log.Printf("Failed to save test plan %d: %v", r.record.ID, err)
+	}
+}
+
+// savePhase 保存阶段记录
+func (r *runner) savePhase(phase *models.TestPlanPhase) {
+	if err := r.service.phaseGorm.Update(db.DB, phase); err != nil {
+		log.Printf("Failed to save phase %d of test plan %d: %v", phase.Index, phase.PlanID, err)
+	}
+}
+
+// configData 按计划的发布参数和阶段的发布速率构造下发的配置数据。
+// pubRate为每个客户端每秒发布的消息数，为0时客户端不发布
+func (p *Plan) configData(slave *models.Slave, pubRate float64) master.ConfigData {
+	configData := master.NewConfigData(slave)
+	if p.PayloadSize > 0 {
+		configData.PayloadSize = p.PayloadSize
+	}
+	if p.PubQoS != nil {
+		configData.PubQoS = *p.PubQoS
+	}
+
+	subscribe := p.Subscribe == nil || *p.Subscribe
+	switch {
+	case subscribe && pubRate > 0:
+		configData.Mode = workload.ModeBoth
+	case subscribe:
+		configData.Mode = workload.ModeSubscribe
+	case pubRate > 0:
+		configData.Mode = workload.ModePublish
+	default:
+		configData.Mode = workload.ModeConnect
+	}
+	configData.PubRate = pubRate
+	return configData
+}
+
+// totalClients 计算slave的客户端总数
+func totalClients(slaves []*models.Slave) int {
+	total := 0
+	for _, slave := range slaves {
+		total += slave.Step
+	}
+	return total
+}
+
+// forEach 对每个slave并发执行fn，返回所有失败的错误
+func forEach(slaves []*models.Slave, fn func(slave *models.Slave) error) error {
+	errs := make([]error, len(slaves))
+
+	var wg sync.WaitGroup
+	for i, slave := range slaves {
+		wg.Add(1)
+		go func(i int, slave *models.Slave) {
+			defer wg.Done()
+			errs[i] = fn(slave)
+		}(i, slave)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// wait 等待指定的秒数，被停止时返回context.Canceled
+func wait(ctx context.Context, seconds int) error {
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
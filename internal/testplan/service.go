@@ -0,0 +1,188 @@
+package testplan
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mqttbench/internal/db"
+	"mqttbench/internal/master"
+	"mqttbench/internal/models"
+)
+
+// Service 测试计划服务
+type Service struct {
+	planGorm     *models.TestPlanGorm
+	phaseGorm    *models.TestPlanPhaseGorm
+	masterServer *master.Server
+	// 正在运行的计划，用于停止计划
+	running      map[int64]context.CancelFunc
+	runningMutex sync.Mutex
+}
+
+// NewService 创建新的测试计划服务实例
+func NewService(masterServer *master.Server) *Service {
+	return &Service{
+		planGorm:     &models.TestPlanGorm{},
+		phaseGorm:    &models.TestPlanPhaseGorm{},
+		masterServer: masterServer,
+		running:      make(map[int64]context.CancelFunc),
+	}
+}
+
+// GetTestPlans 获取所有测试计划
+func (s *Service) GetTestPlans() ([]*models.TestPlan, error) {
+	return s.planGorm.GetAll(db.DB)
+}
+
+// GetTestPlan 获取指定的测试计划
+func (s *Service) GetTestPlan(id int64) (*models.TestPlan, error) {
+	return s.planGorm.GetByID(db.DB, id)
+}
+
+// GetTestPlanPhases 获取测试计划最近一次运行的各阶段状态
+func (s *Service) GetTestPlanPhases(id int64) ([]*models.TestPlanPhase, error) {
+	return s.phaseGorm.GetByPlanID(db.DB, id)
+}
+
+// IsRunning 检查测试计划是否正在运行
+func (s *Service) IsRunning(id int64) bool {
+	s.runningMutex.Lock()
+	defer s.runningMutex.Unlock()
+
+	_, exists := s.running[id]
+	return exists
+}
+
+// CreateTestPlan 解析并校验YAML或JSON格式的计划内容，保存为新的测试计划
+func (s *Service) CreateTestPlan(content string) (*models.TestPlan, error) {
+	plan, err := Parse([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.TestPlan{
+		Name:         plan.Name,
+		Content:      content,
+		Status:       models.TestPlanStatusPending,
+		CurrentPhase: -1,
+	}
+	if err := s.planGorm.Insert(db.DB, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// UpdateTestPlan 使用新的计划内容替换测试计划，运行中的计划不能修改
+func (s *Service) UpdateTestPlan(id int64, content string) (*models.TestPlan, error) {
+	if s.IsRunning(id) {
+		return nil, fmt.Errorf("test plan %d is running, stop it first", id)
+	}
+
+	plan, err := Parse([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.planGorm.GetByID(db.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	record.Name = plan.Name
+	record.Content = content
+	if err := s.planGorm.Update(db.DB, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// DeleteTestPlan 删除测试计划及其阶段记录，运行中的计划不能删除
+func (s *Service) DeleteTestPlan(id int64) error {
+	if s.IsRunning(id) {
+		return fmt.Errorf("test plan %d is running, stop it first", id)
+	}
+
+	return s.planGorm.Delete(db.DB, id)
+}
+
+// StartTestPlan 在指定的slave上按阶段运行测试计划，计划在后台运行
+func (s *Service) StartTestPlan(id int64, slaveIDs []int64) error {
+	if len(slaveIDs) == 0 {
+		return fmt.Errorf("no slaves selected")
+	}
+
+	record, err := s.planGorm.GetByID(db.DB, id)
+	if err != nil {
+		return err
+	}
+
+	plan, err := Parse([]byte(record.Content))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.runningMutex.Lock()
+	if _, exists := s.running[id]; exists {
+		s.runningMutex.Unlock()
+		cancel()
+		return fmt.Errorf("test plan %d is already running", id)
+	}
+	s.running[id] = cancel
+	s.runningMutex.Unlock()
+
+	// 重置上一次运行的状态
+	ids := make([]string, 0, len(slaveIDs))
+	for _, slaveID := range slaveIDs {
+		ids = append(ids, strconv.FormatInt(slaveID, 10))
+	}
+	record.Status = models.TestPlanStatusRunning
+	record.SlaveIDs = strings.Join(ids, ",")
+	record.CurrentPhase = -1
+	record.StartTime = time.Now()
+	record.EndTime = time.Time{}
+	record.ErrorMessage = ""
+	if err := s.planGorm.Update(db.DB, record); err != nil {
+		s.finish(id)
+		return err
+	}
+
+	r := &runner{
+		service:  s,
+		plan:     plan,
+		record:   record,
+		started:  make(map[int64]bool),
+		pubRates: make(map[int64]float64),
+	}
+	go r.run(ctx, slaveIDs)
+	return nil
+}
+
+// StopTestPlan 停止正在运行的测试计划，当前阶段被中止，之后的阶段不再执行
+func (s *Service) StopTestPlan(id int64) error {
+	s.runningMutex.Lock()
+	cancel, exists := s.running[id]
+	s.runningMutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("test plan %d is not running", id)
+	}
+
+	cancel()
+	return nil
+}
+
+// finish 将计划从运行列表中移除
+func (s *Service) finish(id int64) {
+	s.runningMutex.Lock()
+	defer s.runningMutex.Unlock()
+
+	if cancel, exists := s.running[id]; exists {
+		cancel()
+		delete(s.running, id)
+	}
+}
@@ -0,0 +1,168 @@
+package topic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 订阅和发布主题中的占位符，格式为{{名称}}，在创建客户端时展开：
+//
+//	{{client_id}}   客户端ID
+//	{{index}}       客户端序号，即客户端ID末尾的数字
+//	{{slave_id}}    slave的ID
+//	{{group}}       客户端所在的分组，按序号每GroupSize个客户端为一组，从0开始
+var placeholders = map[string]bool{
+	"client_id": true,
+	"index":     true,
+	"slave_id":  true,
+	"group":     true,
+}
+
+// Subscription 客户端的一个订阅，主题可以包含占位符和通配符
+type Subscription struct {
+	Topic string `json:"topic"`
+	QoS   int    `json:"qos"`
+}
+
+// WillConfig 遗嘱消息，客户端未发送DISCONNECT而断开时由broker发布，主题可以包含占位符
+type WillConfig struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	QoS     int    `json:"qos"`
+	Retain  bool   `json:"retain"`
+}
+
+// Vars 展开主题模板时使用的客户端信息
+type Vars struct {
+	ClientID string
+	Index    int // 客户端序号，即Start加上客户端在本slave中的序号
+	SlaveID  int
+}
+
+// Templates 一组客户端使用的订阅、发布和遗嘱主题模板，master和slave共用
+type Templates struct {
+	Topic         string         // 订阅主题，未设置订阅列表时订阅该主题
+	QoS           int            // Topic的QoS
+	PubTopic      string         // 发布主题
+	Subscriptions []Subscription // 订阅列表，为空时订阅Topic
+	Will          *WillConfig    // 遗嘱消息，为空时不设置
+	GroupSize     int            // {{group}}占位符的分组大小
+}
+
+// Validate 校验订阅、发布和遗嘱主题模板
+func (t *Templates) Validate() error {
+	if t.GroupSize < 0 {
+		return fmt.Errorf("invalid topic group size %d, must not be negative", t.GroupSize)
+	}
+
+	for _, subscription := range t.Subscriptions {
+		if subscription.Topic == "" {
+			return fmt.Errorf("subscription topic is empty")
+		}
+		if subscription.QoS < 0 || subscription.QoS > 2 {
+			return fmt.Errorf("invalid qos %d for subscription %s", subscription.QoS, subscription.Topic)
+		}
+		if err := t.validate(subscription.Topic, true); err != nil {
+			return err
+		}
+	}
+	if err := t.validate(t.Topic, true); err != nil {
+		return err
+	}
+	if t.Will != nil {
+		if t.Will.Topic == "" {
+			return fmt.Errorf("will topic is empty")
+		}
+		if t.Will.QoS < 0 || t.Will.QoS > 2 {
+			return fmt.Errorf("invalid qos %d for will topic %s", t.Will.QoS, t.Will.Topic)
+		}
+		if err := t.validate(t.Will.Topic, false); err != nil {
+			return err
+		}
+	}
+	return t.validate(t.PubTopic, false)
+}
+
+// validate 检查主题模板的占位符，filter为true时允许通配符
+func (t *Templates) validate(topic string, filter bool) error {
+	rest := topic
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return fmt.Errorf("unclosed placeholder in topic %s", topic)
+		}
+		name := rest[start+2 : start+end]
+		if !placeholders[name] {
+			return fmt.Errorf("unknown placeholder in topic %s: %s", topic, name)
+		}
+		if name == "group" && t.GroupSize == 0 {
+			return fmt.Errorf("topic %s uses {{group}} but topic group size is not set", topic)
+		}
+		rest = rest[start+end+2:]
+	}
+
+	// +必须占据整个层级，#必须是最后一个层级
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		if !strings.ContainsAny(level, "+#") {
+			continue
+		}
+		if !filter {
+			return fmt.Errorf("publish topic %s must not contain wildcards", topic)
+		}
+		if (level != "+" && level != "#") || (level == "#" && i != len(levels)-1) {
+			return fmt.Errorf("invalid wildcard in topic filter %s", topic)
+		}
+	}
+	return nil
+}
+
+// SubscriptionsFor 返回客户端展开后的订阅列表，未设置订阅列表时订阅Topic
+func (t *Templates) SubscriptionsFor(vars Vars) []Subscription {
+	subscriptions := t.Subscriptions
+	if len(subscriptions) == 0 {
+		if t.Topic == "" {
+			return nil
+		}
+		subscriptions = []Subscription{{Topic: t.Topic, QoS: t.QoS}}
+	}
+
+	expanded := make([]Subscription, len(subscriptions))
+	for i, subscription := range subscriptions {
+		expanded[i] = Subscription{Topic: t.Expand(subscription.Topic, vars), QoS: subscription.QoS}
+	}
+	return expanded
+}
+
+// WillFor 返回客户端展开主题后的遗嘱消息，未设置时返回nil
+func (t *Templates) WillFor(vars Vars) *WillConfig {
+	if t.Will == nil {
+		return nil
+	}
+	will := *t.Will
+	will.Topic = t.Expand(will.Topic, vars)
+	return &will
+}
+
+// Expand 将主题模板中的占位符替换为客户端的信息
+func (t *Templates) Expand(topic string, vars Vars) string {
+	if !strings.Contains(topic, "{{") {
+		return topic
+	}
+
+	group := 0
+	if t.GroupSize > 0 {
+		group = vars.Index / t.GroupSize
+	}
+	return strings.NewReplacer(
+		"{{client_id}}", vars.ClientID,
+		"{{index}}", strconv.Itoa(vars.Index),
+		"{{slave_id}}", strconv.Itoa(vars.SlaveID),
+		"{{group}}", strconv.Itoa(group),
+	).Replace(topic)
+}
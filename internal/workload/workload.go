@@ -0,0 +1,35 @@
+package workload
+
+import (
+	"fmt"
+	"math"
+)
+
+// 客户端模式
+const (
+	ModeSubscribe = "subscribe" // 只订阅并回复ACK（默认）
+	ModePublish   = "publish"   // 只按配置速率发布消息
+	ModeBoth      = "both"      // 同时订阅和发布
+	ModeConnect   = "connect"   // 只建立连接，不订阅也不发布，可通过publish命令开始发布
+)
+
+// IsSubscribeMode 判断模式是否需要订阅主题
+func IsSubscribeMode(mode string) bool {
+	return mode == "" || mode == ModeSubscribe || mode == ModeBoth
+}
+
+// IsPublishMode 判断模式是否需要发布消息
+func IsPublishMode(mode string) bool {
+	return mode == ModePublish || mode == ModeBoth
+}
+
+// ValidatePublishRate 校验每个客户端每秒发布的消息数，allowZero为true时0表示停止发布
+func ValidatePublishRate(rate float64, allowZero bool) error {
+	if math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return fmt.Errorf("invalid pub rate %v, must be a finite number", rate)
+	}
+	if rate < 0 || (rate == 0 && !allowZero) {
+		return fmt.Errorf("invalid pub rate %v, must be greater than 0", rate)
+	}
+	return nil
+}